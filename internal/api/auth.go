@@ -0,0 +1,257 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrUnauthenticated is returned when a request has no bearer token, or one that is not valid
+var ErrUnauthenticated = errors.New("a valid bearer token is required")
+
+// Authenticator checks the bearer token of a request, returning who made it
+type Authenticator interface {
+	Authenticate(r *http.Request) (string, error)
+}
+
+// bearerToken returns the token from a request's `Authorization` header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return strings.TrimSpace(token), true
+}
+
+// StaticToken authenticates requests carrying a single shared token
+type StaticToken struct {
+	Token string
+}
+
+// Authenticate checks the request's bearer token matches, in constant time
+func (s StaticToken) Authenticate(r *http.Request) (string, error) {
+	token, ok := bearerToken(r)
+	if !ok || s.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+		return "", ErrUnauthenticated
+	}
+
+	return "static-token", nil
+}
+
+// minimumKeyRefresh stops a stream of tokens signed by unknown keys from refetching the provider's
+// keys on every request
+const minimumKeyRefresh = time.Minute
+
+// OIDC authenticates requests carrying a JWT issued by an OpenID Connect provider, such as Entra ID.
+// The token's signature is checked against the keys the provider publishes, and its issuer, audience
+// and expiry are validated.
+type OIDC struct {
+	// Issuer is the provider's issuer URL, its discovery document is read from
+	// `<issuer>/.well-known/openid-configuration`
+	Issuer   string
+	Audience string
+	Client   *http.Client
+
+	keys      map[string]any
+	refreshed time.Time
+	mu        sync.Mutex
+}
+
+// Authenticate validates the request's bearer token, returning its username, application ID or
+// subject
+func (o *OIDC) Authenticate(r *http.Request) (string, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(token, claims, o.key,
+		jwt.WithIssuer(o.Issuer),
+		jwt.WithAudience(o.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384",
+			"ES512"}),
+	)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+
+	for _, claim := range []string{"preferred_username", "upn", "appid", "azp", "sub"} {
+		if value, ok := claims[claim].(string); ok && value != "" {
+			return value, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: token does not identify a user or application", ErrUnauthenticated)
+}
+
+// key returns the public key a token was signed with, refreshing the provider's keys when the token
+// names one that is not known yet
+func (o *OIDC) key(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(o.refreshed) < minimumKeyRefresh {
+		return nil, fmt.Errorf("unknown signing key '%s'", kid)
+	}
+
+	keys, err := o.fetchKeys()
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch signing keys: %w", err)
+	}
+
+	o.keys, o.refreshed = keys, time.Now()
+
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown signing key '%s'", kid)
+}
+
+// jsonWebKey is a single key of a JSON Web Key Set, only RSA and elliptic curve keys are used
+type jsonWebKey struct {
+	KeyID   string `json:"kid"`
+	KeyType string `json:"kty"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// fetchKeys reads the provider's discovery document, then the signing keys it points to
+func (o *OIDC) fetchKeys() (map[string]any, error) {
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := o.getJSON(strings.TrimSuffix(o.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document has no jwks_uri")
+	}
+
+	if err := o.getJSON(discovery.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+
+		keys[jwk.KeyID] = key
+	}
+
+	return keys, nil
+}
+
+func (o *OIDC) getJSON(url string, v any) error {
+	client := o.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// publicKey converts the key to an `*rsa.PublicKey` or `*ecdsa.PublicKey`
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve '%s'", k.Curve)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type '%s'", k.KeyType)
+	}
+}
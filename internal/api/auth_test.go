@@ -0,0 +1,112 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TestOIDCAuthenticate checks tokens are validated against the provider's published keys, issuer,
+// audience and expiry
+func TestOIDCAuthenticate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+
+	var provider *httptest.Server
+	provider = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{"jwks_uri": provider.URL + "/keys"})
+		case "/keys":
+			_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+				"kid": "key-1",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer provider.Close()
+
+	sign := func(signer *rsa.PrivateKey, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "key-1"
+
+		signed, err := token.SignedString(signer)
+		if err != nil {
+			t.Fatalf("unable to sign token: %v", err)
+		}
+
+		return signed
+	}
+
+	claims := func(audience string, expires time.Time) jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":                provider.URL,
+			"aud":                audience,
+			"exp":                expires.Unix(),
+			"preferred_username": "jo@example.com",
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{name: "valid", token: sign(key, claims("api://scheduler", time.Now().Add(time.Hour))),
+			want: "jo@example.com"},
+		{name: "wrong audience", token: sign(key, claims("api://other", time.Now().Add(time.Hour))), wantErr: true},
+		{name: "expired", token: sign(key, claims("api://scheduler", time.Now().Add(-time.Hour))), wantErr: true},
+		{name: "wrong key", token: sign(other, claims("api://scheduler", time.Now().Add(time.Hour))),
+			wantErr: true},
+	}
+
+	oidc := &OIDC{Issuer: provider.URL, Audience: "api://scheduler"}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/instances", nil)
+			req.Header.Set("Authorization", "Bearer "+test.token)
+
+			got, err := oidc.Authenticate(req)
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got: %v, want error: %v", err, test.wantErr)
+			}
+
+			if got != test.want {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,384 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"instancescheduler/internal/audit"
+	"instancescheduler/internal/azure"
+	"instancescheduler/internal/override"
+	"instancescheduler/internal/report"
+	"instancescheduler/internal/scheduler"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultMaxExtend is the longest an instance may be kept running by a single extend request
+const DefaultMaxExtend = 24 * time.Hour
+
+// Scheduler is what the API needs from the scheduler, it is satisfied by `*scheduler.Scheduler`
+type Scheduler interface {
+	LastReport() (*report.Report, time.Time)
+	Explain(ctx context.Context, nameOrID string) (*report.Report, error)
+	Extend(ctx context.Context, nameOrID string, until time.Time) (azure.Instance, time.Time, error)
+}
+
+// Server is the HTTP API served alongside the reconcile loop
+type Server struct {
+	Scheduler Scheduler
+	// Auth authenticates every request other than the health checks
+	Auth Authenticator
+	// ReadOnly rejects requests that change instances
+	ReadOnly bool
+	// MaxExtend is the longest an instance may be kept running by a single extend request,
+	// `DefaultMaxExtend` is used when it is unset
+	MaxExtend time.Duration
+}
+
+// Instance is the state of a scheduled instance as of the latest reconcile
+type Instance struct {
+	ID             string        `json:"id"`
+	SubscriptionID string        `json:"subscriptionId"`
+	ResourceGroup  string        `json:"resourceGroup"`
+	Name           string        `json:"name"`
+	DesiredState   string        `json:"desiredState,omitempty"`
+	ActualState    string        `json:"actualState,omitempty"`
+	Action         report.Action `json:"action"`
+	Reason         string        `json:"reason,omitempty"`
+	NextTransition *time.Time    `json:"nextTransition,omitempty"`
+	NextAction     report.Action `json:"nextAction,omitempty"`
+	Error          string        `json:"error,omitempty"`
+}
+
+// InstanceList is the response of `GET /instances`
+type InstanceList struct {
+	LastReconcile time.Time  `json:"lastReconcile"`
+	Instances     []Instance `json:"instances"`
+}
+
+// ExtendRequest is the body of `POST /instances/{id}/extend`, one of `until` or `duration` is
+// required
+type ExtendRequest struct {
+	// Until is when the override ends, in any format accepted by the override tag
+	Until string `json:"until,omitempty"`
+	// Duration is how long from now the override lasts, such as `2h`
+	Duration string `json:"duration,omitempty"`
+}
+
+// ExtendResponse is the response of `POST /instances/{id}/extend`
+type ExtendResponse struct {
+	ID             string    `json:"id"`
+	SubscriptionID string    `json:"subscriptionId"`
+	ResourceGroup  string    `json:"resourceGroup"`
+	Name           string    `json:"name"`
+	Until          time.Time `json:"until"`
+}
+
+// Handler returns the API's routes:
+//
+//   - `GET /healthz` – the process is up
+//   - `GET /readyz` – a reconcile has finished, so there is state to serve
+//   - `GET /instances` – every scheduled instance as of the latest reconcile
+//   - `GET /instances/{id}/explain` – a fresh decision trace for an instance
+//   - `POST /instances/{id}/extend` – keep an instance running with its override tag
+//
+// The instance is given by name or resource ID, a resource ID may be given as is or escaped. The
+// instance routes are served ahead of the `http.ServeMux`, which would redirect the uncleaned path of
+// a resource ID such as `/instances//subscriptions/.../explain`.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.Handle("/instances", s.authenticate(http.HandlerFunc(s.listInstances)))
+
+	instance := s.authenticate(http.HandlerFunc(s.instance))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.EscapedPath(), "/instances/") {
+			instance.ServeHTTP(w, r)
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Serve exposes the API at `addr` until `ctx` is cancelled
+func (s *Server) Serve(ctx context.Context, addr string) error {
+	server := &http.Server{Addr: addr, Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	log.Info().Str("addr", addr).Bool("readOnly", s.ReadOnly).Msg("Serving API")
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+type callerKey struct{}
+
+// authenticate rejects requests without a valid bearer token, passing who made the request on to
+// the handler in its context
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, err := s.Auth.Authenticate(r)
+		if err != nil {
+			log.Debug().Err(err).Str("path", r.URL.Path).Msg("Rejected unauthenticated API request")
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, ErrUnauthenticated)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, caller)))
+	})
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	if runReport, _ := s.Scheduler.LastReport(); runReport == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "waiting for the first reconcile"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+func (s *Server) listInstances(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+
+	runReport, at := s.Scheduler.LastReport()
+	if runReport == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("no reconcile has finished yet"))
+		return
+	}
+
+	runReport.Sort()
+
+	list := InstanceList{LastReconcile: at, Instances: []Instance{}}
+
+	for _, result := range runReport.Results {
+		instance := Instance{
+			ID:             result.InstanceID,
+			SubscriptionID: result.SubscriptionID,
+			ResourceGroup:  result.ResourceGroup,
+			Name:           result.Instance,
+			DesiredState:   result.DesiredState,
+			ActualState:    result.PowerState,
+			Action:         result.Action,
+			Reason:         result.Reason,
+			NextAction:     result.NextAction,
+		}
+
+		if !result.NextTransition.IsZero() {
+			next := result.NextTransition
+			instance.NextTransition = &next
+		}
+
+		if result.Err != nil {
+			instance.Error = result.Err.Error()
+		}
+
+		list.Instances = append(list.Instances, instance)
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// instance routes `/instances/{id}/explain` and `/instances/{id}/extend`. The escaped path is
+// routed on, so that an escaped resource ID is only unescaped once its route has been found.
+func (s *Server) instance(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/instances/")
+
+	if id, ok := instanceID(path, "/explain"); ok {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+			return
+		}
+
+		s.explain(w, r, id)
+
+		return
+	}
+
+	if id, ok := instanceID(path, "/extend"); ok {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+			return
+		}
+
+		s.extend(w, r, id)
+
+		return
+	}
+
+	writeError(w, http.StatusNotFound, errors.New("not found"))
+}
+
+// instanceID returns the unescaped instance name or resource ID of an escaped path ending in
+// `suffix`
+func instanceID(path, suffix string) (string, bool) {
+	escaped, ok := strings.CutSuffix(path, suffix)
+	if !ok || escaped == "" {
+		return "", false
+	}
+
+	id, err := url.PathUnescape(escaped)
+	if err != nil || id == "" {
+		return "", false
+	}
+
+	return id, true
+}
+
+func (s *Server) explain(w http.ResponseWriter, r *http.Request, id string) {
+	runReport, err := s.Scheduler.Explain(r.Context(), id)
+	if err != nil {
+		log.Error().Err(err).Str("instance", id).Msg("Failed to explain instance")
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	explanations := runReport.Explanations()
+	if len(explanations) == 0 {
+		writeError(w, http.StatusNotFound, scheduler.ErrInstanceNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, explanations)
+}
+
+func (s *Server) extend(w http.ResponseWriter, r *http.Request, id string) {
+	var body ExtendRequest
+
+	if s.ReadOnly {
+		writeError(w, http.StatusForbidden, errors.New("the API is read-only"))
+		return
+	}
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	until, err := s.until(body, time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, _ := r.Context().Value(callerKey{}).(string)
+	ctx := audit.WithRun(r.Context(), audit.Run{ID: audit.NewRunID(), Identity: caller})
+
+	instance, until, err := s.Scheduler.Extend(ctx, id, until)
+
+	switch {
+	case errors.Is(err, scheduler.ErrInstanceNotFound):
+		writeError(w, http.StatusNotFound, err)
+		return
+	case errors.Is(err, scheduler.ErrAmbiguousInstance):
+		writeError(w, http.StatusConflict, err)
+		return
+	case err != nil:
+		log.Error().Err(err).Str("instance", id).Msg("Failed to extend instance")
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	log.Info().Str("instance", instance.Name).Str("caller", caller).Time("until", until).
+		Msg("Extended instance through the API")
+
+	writeJSON(w, http.StatusOK, ExtendResponse{
+		ID:             instance.ID,
+		SubscriptionID: instance.SubscriptionID,
+		ResourceGroup:  instance.ResourceGroup,
+		Name:           instance.Name,
+		Until:          until,
+	})
+}
+
+// until returns when an extend request's override ends, which must be in the future and within the
+// maximum extension
+func (s *Server) until(body ExtendRequest, now time.Time) (time.Time, error) {
+	var until time.Time
+
+	switch {
+	case body.Until != "" && body.Duration != "":
+		return time.Time{}, errors.New("only one of until or duration may be given")
+	case body.Until != "":
+		var err error
+
+		until, err = override.ParseTime(body.Until)
+		if err != nil {
+			return time.Time{}, err
+		}
+	case body.Duration != "":
+		duration, err := time.ParseDuration(body.Duration)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid duration '%s': %w", body.Duration, err)
+		}
+
+		until = now.Add(duration)
+	default:
+		return time.Time{}, errors.New("one of until or duration is required")
+	}
+
+	maxExtend := s.MaxExtend
+	if maxExtend <= 0 {
+		maxExtend = DefaultMaxExtend
+	}
+
+	if !until.After(now) {
+		return time.Time{}, errors.New("the override must end in the future")
+	}
+
+	if until.Sub(now) > maxExtend {
+		return time.Time{}, fmt.Errorf("the override may last at most %s", maxExtend)
+	}
+
+	return until.Truncate(time.Second), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error().Err(err).Msg("Failed to write API response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,137 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"instancescheduler/internal/azure"
+	"instancescheduler/internal/report"
+	"instancescheduler/internal/scheduler"
+)
+
+// vmA is the resource ID of the one instance the fake scheduler knows of
+const vmA = "/subscriptions/1/resourceGroups/rg-a/providers/Microsoft.Compute/virtualMachines/vm-a"
+
+// fakeScheduler serves a fixed report and explains and extends the one instance it knows of, by its
+// name or resource ID
+type fakeScheduler struct {
+	report *report.Report
+}
+
+func (f *fakeScheduler) LastReport() (*report.Report, time.Time) {
+	return f.report, time.Now()
+}
+
+func (f *fakeScheduler) Explain(ctx context.Context, nameOrID string) (*report.Report, error) {
+	explained := report.New()
+
+	if nameOrID == "vm-a" || nameOrID == vmA {
+		explained.Add(report.Result{InstanceID: vmA, Instance: "vm-a", Trace: &report.Trace{Rule: "within-schedule"}})
+	}
+
+	return explained, nil
+}
+
+func (f *fakeScheduler) Extend(ctx context.Context, nameOrID string, until time.Time) (azure.Instance, time.Time,
+	error) {
+	if nameOrID != "vm-a" && nameOrID != vmA {
+		return azure.Instance{}, time.Time{}, scheduler.ErrInstanceNotFound
+	}
+
+	return azure.Instance{ID: vmA, Name: "vm-a"}, until, nil
+}
+
+// TestHandler checks the routes' authentication, read-only mode and validation
+func TestHandler(t *testing.T) {
+	ready := report.New()
+	ready.Add(report.Result{InstanceID: "/subscriptions/1/vm-a", Instance: "vm-a", DesiredState: "running"})
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		token      string
+		readOnly   bool
+		report     *report.Report
+		want       int
+		wantInBody string
+	}{
+		{name: "health without token", method: http.MethodGet, path: "/healthz", want: http.StatusOK},
+		{name: "not ready", method: http.MethodGet, path: "/readyz", want: http.StatusServiceUnavailable},
+		{name: "ready", method: http.MethodGet, path: "/readyz", report: ready, want: http.StatusOK},
+		{name: "instances without token", method: http.MethodGet, path: "/instances", report: ready,
+			want: http.StatusUnauthorized},
+		{name: "instances with wrong token", method: http.MethodGet, path: "/instances", token: "wrong",
+			report: ready, want: http.StatusUnauthorized},
+		{name: "instances", method: http.MethodGet, path: "/instances", token: "secret", report: ready,
+			want: http.StatusOK, wantInBody: `"desiredState":"running"`},
+		{name: "explain unknown instance", method: http.MethodGet, path: "/instances/vm-z/explain",
+			token: "secret", want: http.StatusNotFound},
+		{name: "explain", method: http.MethodGet, path: "/instances/vm-a/explain", token: "secret",
+			want: http.StatusOK, wantInBody: `"rule":"within-schedule"`},
+		{name: "explain resource ID", method: http.MethodGet, path: "/instances/" + vmA + "/explain",
+			token: "secret", want: http.StatusOK, wantInBody: `"rule":"within-schedule"`},
+		{name: "explain escaped resource ID", method: http.MethodGet,
+			path: "/instances/" + url.PathEscape(vmA) + "/explain", token: "secret", want: http.StatusOK,
+			wantInBody: `"rule":"within-schedule"`},
+		{name: "extend", method: http.MethodPost, path: "/instances/vm-a/extend", body: `{"duration":"2h"}`,
+			token: "secret", want: http.StatusOK, wantInBody: `"name":"vm-a"`},
+		{name: "extend resource ID", method: http.MethodPost, path: "/instances/" + vmA + "/extend",
+			body: `{"duration":"2h"}`, token: "secret", want: http.StatusOK, wantInBody: `"name":"vm-a"`},
+		{name: "extend escaped resource ID", method: http.MethodPost,
+			path: "/instances/" + url.PathEscape(vmA) + "/extend", body: `{"duration":"2h"}`, token: "secret",
+			want: http.StatusOK, wantInBody: `"name":"vm-a"`},
+		{name: "instance without route", method: http.MethodGet, path: "/instances/vm-a", token: "secret",
+			want: http.StatusNotFound},
+		{name: "extend read-only", method: http.MethodPost, path: "/instances/vm-a/extend",
+			body: `{"duration":"2h"}`, token: "secret", readOnly: true, want: http.StatusForbidden},
+		{name: "extend beyond maximum", method: http.MethodPost, path: "/instances/vm-a/extend",
+			body: `{"duration":"48h"}`, token: "secret", want: http.StatusBadRequest},
+		{name: "extend unknown instance", method: http.MethodPost, path: "/instances/vm-z/extend",
+			body: `{"duration":"1h"}`, token: "secret", want: http.StatusNotFound},
+		{name: "extend with get", method: http.MethodGet, path: "/instances/vm-a/extend", token: "secret",
+			want: http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			server := &Server{
+				Scheduler: &fakeScheduler{report: test.report},
+				Auth:      StaticToken{Token: "secret"},
+				ReadOnly:  test.readOnly,
+			}
+
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != test.want {
+				t.Errorf("got: %v, want: %v (%s)", rec.Code, test.want, rec.Body.String())
+			}
+
+			if !strings.Contains(rec.Body.String(), test.wantInBody) {
+				t.Errorf("got: %v, want: a body containing %v", rec.Body.String(), test.wantInBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"time"
+)
+
+// Kind is what an audit record describes
+type Kind string
+
+const (
+	// KindEvaluation records the decision made for an instance
+	KindEvaluation Kind = "evaluation"
+	// KindAction records a start or stop sent to an instance, and its outcome
+	KindAction Kind = "action"
+	// KindOverride records a keep-running override applied on request, such as through the API
+	KindOverride Kind = "override"
+)
+
+// Record is a single line of the audit log
+type Record struct {
+	// Time is when the evaluation or action started
+	Time           time.Time `json:"time"`
+	Kind           Kind      `json:"kind"`
+	RunID          string    `json:"runId"`
+	Identity       string    `json:"identity,omitempty"`
+	InstanceID     string    `json:"instanceId"`
+	SubscriptionID string    `json:"subscriptionId"`
+	ResourceGroup  string    `json:"resourceGroup"`
+	Instance       string    `json:"instance"`
+	// TagsHash is a hash of the instance's tags when it was evaluated, so that a change to its tags
+	// between two records can be spotted
+	TagsHash    string `json:"tagsHash"`
+	Action      string `json:"action"`
+	Rule        string `json:"rule,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Description string `json:"description,omitempty"`
+	// PreviousState is the power state the instance was in when it was evaluated or actioned
+	PreviousState string `json:"previousState,omitempty"`
+	// NewState is the power state a successful action left the instance in, or is taking it to when
+	// the scheduler does not wait for actions to finish
+	NewState   string `json:"newState,omitempty"`
+	DurationMS int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Duration returns how long the evaluation or action took
+func (r Record) Duration() time.Duration {
+	return time.Duration(r.DurationMS) * time.Millisecond
+}
+
+// Run identifies a single run of the scheduler, and the identity it acted as, in the records it
+// writes
+type Run struct {
+	ID       string
+	Identity string
+}
+
+type runKey struct{}
+
+// WithRun returns a context carrying the run, for records written by calls made with it
+func WithRun(ctx context.Context, run Run) context.Context {
+	return context.WithValue(ctx, runKey{}, run)
+}
+
+// RunFrom returns the run carried by `ctx`, or an empty run when there is none
+func RunFrom(ctx context.Context) Run {
+	run, _ := ctx.Value(runKey{}).(Run)
+
+	return run
+}
+
+// NewRunID returns a random run ID
+func NewRunID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// HashTags returns a SHA-256 hash of an instance's tags that does not depend on their order
+func HashTags(tags map[string]*string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	h := sha256.New()
+
+	for _, key := range keys {
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+
+		if tags[key] != nil {
+			h.Write([]byte(*tags[key]))
+		}
+
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
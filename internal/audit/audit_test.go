@@ -0,0 +1,93 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestHashTags checks the hash of an instance's tags depends on their keys and values, but not their
+// order
+func TestHashTags(t *testing.T) {
+	on, off := "on", "off"
+
+	base := HashTags(map[string]*string{"Schedule": &on, "Owner": &off})
+
+	testCases := []struct {
+		name string
+		tags map[string]*string
+		want bool
+	}{
+		{name: "same tags", tags: map[string]*string{"Owner": &off, "Schedule": &on}, want: true},
+		{name: "changed value", tags: map[string]*string{"Owner": &on, "Schedule": &on}, want: false},
+		{name: "extra tag", tags: map[string]*string{"Owner": &off, "Schedule": &on, "Extra": nil}, want: false},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			got := HashTags(test.tags) == base
+
+			if got != test.want {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestQuery checks records written to the log are read back for a single instance, oldest first,
+// skipping a truncated line
+func TestQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	now := time.Now().UTC().Truncate(time.Second)
+
+	log := New(path)
+
+	records := []Record{
+		{Time: now, Kind: KindAction, InstanceID: "/subscriptions/1/vm-a", Instance: "vm-a", Action: "stop"},
+		{Time: now.Add(-time.Minute), Kind: KindEvaluation, InstanceID: "/subscriptions/1/vm-a", Instance: "vm-a",
+			Action: "stop"},
+		{Time: now, Kind: KindEvaluation, InstanceID: "/subscriptions/1/vm-b", Instance: "vm-b", Action: "none"},
+	}
+
+	for _, record := range records {
+		if err := log.Write(record); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if err := log.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, _ = file.WriteString(`{"time":"2024-`)
+	file.Close()
+
+	got, err := Query(path, "VM-A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got: %v records, want: %v", len(got), 2)
+	}
+
+	if got[0].Kind != KindEvaluation || got[1].Kind != KindAction {
+		t.Errorf("got: %v then %v, want: %v then %v", got[0].Kind, got[1].Kind, KindEvaluation, KindAction)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"instancescheduler/internal/report"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Log is an append-only audit log of JSON Lines, it is safe for concurrent use. The file is only
+// opened once the first record is written, so that runs that write nothing do not create it.
+type Log struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// New returns the audit log at `path`, it is created when the first record is written
+func New(path string) *Log {
+	return &Log{path: path}
+}
+
+// Write appends a record to the log, syncing it to disk before returning so that a record is not
+// lost when the process dies straight after an action
+func (l *Log) Write(record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		l.file, err = os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	return l.file.Sync()
+}
+
+// Close closes the log, a later write opens it again
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	return err
+}
+
+// Query returns the records in the audit log at `path` for an instance, matched by its resource ID
+// or, case-insensitively, by its name, oldest first. A line that cannot be parsed, such as one
+// truncated by the process dying mid-write, is logged and skipped.
+func Query(path, nameOrID string) ([]Record, error) {
+	var records []Record
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		var record Record
+
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			log.Warn().Err(err).Str("path", path).Int("line", line).Msg("Skipping unreadable audit record")
+			continue
+		}
+
+		if strings.EqualFold(record.InstanceID, nameOrID) || strings.EqualFold(record.Instance, nameOrID) {
+			records = append(records, record)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+
+	return records, nil
+}
+
+// Write writes audit records, either as a table or JSON. A `limit` above zero keeps only the most
+// recent records.
+func Write(w io.Writer, records []Record, format string, limit int) error {
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+
+	switch format {
+	case report.FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		if records == nil {
+			records = []Record{}
+		}
+
+		return encoder.Encode(records)
+	case report.FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+		fmt.Fprintln(tw, "TIME\tKIND\tACTION\tREASON\tPREVIOUS STATE\tNEW STATE\tIDENTITY\tRUN\tERROR")
+
+		for _, record := range records {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", record.Time.Format(time.RFC3339),
+				record.Kind, record.Action, record.Reason, record.PreviousState, record.NewState, record.Identity,
+				record.RunID, record.Error)
+		}
+
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format '%s', expected one of table or json", format)
+	}
+}
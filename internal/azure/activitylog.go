@@ -0,0 +1,118 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+const activityLogAPIVersion = "2015-04-01"
+
+// powerOperations are the activity log operations that change an instance's power state
+var powerOperations = []string{
+	"microsoft.compute/virtualmachines/start/action",
+	"microsoft.compute/virtualmachines/restart/action",
+	"microsoft.compute/virtualmachines/poweroff/action",
+	"microsoft.compute/virtualmachines/deallocate/action",
+}
+
+// PowerChange is a change to an instance's power state recorded in the activity log
+type PowerChange struct {
+	Operation string
+	Caller    string
+	At        time.Time
+}
+
+type activityLogPage struct {
+	Value []struct {
+		OperationName struct {
+			Value string `json:"value"`
+		} `json:"operationName"`
+		Status struct {
+			Value string `json:"value"`
+		} `json:"status"`
+		Caller         string    `json:"caller"`
+		EventTimestamp time.Time `json:"eventTimestamp"`
+	} `json:"value"`
+	NextLink string `json:"nextLink"`
+}
+
+// LastPowerChange returns the most recent successful power operation on an instance since `since`
+// from the subscription's activity log, or nil when there was none
+func (c *ComputeClient) LastPowerChange(instance Instance, since time.Time) (*PowerChange, error) {
+	var last *PowerChange
+
+	filter := fmt.Sprintf("eventTimestamp ge '%s' and resourceUri eq '%s'", since.UTC().Format(time.RFC3339),
+		instance.ID)
+
+	query := url.Values{}
+	query.Set("api-version", activityLogAPIVersion)
+	query.Set("$filter", filter)
+	query.Set("$select", "operationName,status,caller,eventTimestamp")
+
+	endpoint := fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Insights/eventtypes/management/values?%s",
+		strings.TrimSuffix(c.armClient.Endpoint(), "/"), url.PathEscape(c.SubscriptionID), query.Encode())
+
+	for endpoint != "" {
+		var page activityLogPage
+
+		err := retry(c.ctx, c.options.Retry, "activity log", func() error {
+			request, err := runtime.NewRequest(c.ctx, http.MethodGet, endpoint)
+			if err != nil {
+				return err
+			}
+
+			response, err := c.armClient.Pipeline().Do(request)
+			if err != nil {
+				return err
+			}
+
+			if !runtime.HasStatusCode(response, http.StatusOK) {
+				return runtime.NewResponseError(response)
+			}
+
+			return runtime.UnmarshalAsJSON(response, &page)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, event := range page.Value {
+			if !strings.EqualFold(event.Status.Value, "Succeeded") || !isPowerOperation(event.OperationName.Value) {
+				continue
+			}
+
+			if last == nil || event.EventTimestamp.After(last.At) {
+				last = &PowerChange{Operation: event.OperationName.Value, Caller: event.Caller, At: event.EventTimestamp}
+			}
+		}
+
+		endpoint = page.NextLink
+	}
+
+	return last, nil
+}
+
+func isPowerOperation(operation string) bool {
+	for _, powerOperation := range powerOperations {
+		if strings.EqualFold(operation, powerOperation) {
+			return true
+		}
+	}
+
+	return false
+}
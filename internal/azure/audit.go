@@ -0,0 +1,110 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"time"
+
+	"instancescheduler/internal/audit"
+	"instancescheduler/internal/decision"
+	"instancescheduler/internal/report"
+
+	"github.com/rs/zerolog/log"
+)
+
+// writeAudit appends a record about an instance to the audit log, when there is one, filling in the
+// run carried by the client's context. Nothing is written on a dry run, and a failure to write is
+// logged rather than failing the instance.
+func (c *ComputeClient) writeAudit(instance Instance, record audit.Record, started time.Time) {
+	if c.options.Audit == nil || c.options.DryRun {
+		return
+	}
+
+	run := audit.RunFrom(c.ctx)
+
+	record.Time = started.UTC()
+	record.DurationMS = time.Since(started).Milliseconds()
+	record.RunID, record.Identity = run.ID, run.Identity
+	record.InstanceID, record.SubscriptionID = instance.ID, instance.SubscriptionID
+	record.ResourceGroup, record.Instance = instance.ResourceGroup, instance.Name
+	record.TagsHash = audit.HashTags(instance.Tags)
+
+	if err := c.options.Audit.Write(record); err != nil {
+		log.Error().Err(err).Str("instance", instance.Name).Msg("Failed to write audit record")
+	}
+}
+
+// auditEvaluation records the decision made for an instance, or why one could not be made
+func (c *ComputeClient) auditEvaluation(instance Instance, result report.Result, started time.Time) {
+	record := audit.Record{
+		Kind:          audit.KindEvaluation,
+		Action:        string(result.Action),
+		Reason:        result.ReasonCode,
+		Description:   result.Reason,
+		PreviousState: result.PowerState,
+	}
+
+	if result.Trace != nil {
+		record.Rule = result.Trace.Rule
+	}
+
+	if result.Err != nil {
+		record.Error = result.Err.Error()
+	}
+
+	c.writeAudit(instance, record, started)
+}
+
+// auditAction records a start or stop sent to an instance and its outcome
+func (c *ComputeClient) auditAction(instance Instance, d decision.Decision, previous PowerState, stopMode StopMode,
+	started time.Time, err error) {
+	if d.Action != report.ActionStart && d.Action != report.ActionStop {
+		return
+	}
+
+	record := audit.Record{
+		Kind:          audit.KindAction,
+		Action:        string(d.Action),
+		Rule:          d.Rule,
+		Reason:        string(d.Reason),
+		Description:   d.Reason.Description(),
+		PreviousState: previous.String(),
+	}
+
+	if err != nil {
+		record.Error = err.Error()
+	} else {
+		record.NewState = c.expectedPowerState(d.Action, stopMode).String()
+	}
+
+	c.writeAudit(instance, record, started)
+}
+
+// expectedPowerState returns the power state a successful action leaves an instance in, or the one it
+// is on its way through when the client does not wait for actions to finish
+func (c *ComputeClient) expectedPowerState(action report.Action, stopMode StopMode) PowerState {
+	waits := !c.options.NoWait || c.options.State == nil
+
+	switch {
+	case action == report.ActionStart && waits:
+		return PowerStateRunning
+	case action == report.ActionStart:
+		return PowerStateStarting
+	case stopMode == StopModePowerOff && waits:
+		return PowerStateStopped
+	case stopMode == StopModePowerOff:
+		return PowerStateStopping
+	case waits:
+		return PowerStateDeallocated
+	default:
+		return PowerStateDeallocating
+	}
+}
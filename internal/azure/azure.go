@@ -12,61 +12,214 @@ package azure
 
 import (
 	"context"
+	"instancescheduler/internal/audit"
+	"instancescheduler/internal/decision"
+	"instancescheduler/internal/events"
+	"instancescheduler/internal/metrics"
+	"instancescheduler/internal/notify"
+	"instancescheduler/internal/override"
 	"instancescheduler/internal/patchwindow"
+	"instancescheduler/internal/pool"
+	"instancescheduler/internal/report"
 	"instancescheduler/internal/schedule"
+	"instancescheduler/internal/state"
+	"instancescheduler/internal/telemetry"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func NewComputeClient(subscriptionID, tagsConfigPath string) (*ComputeClient, error) {
+// NewCredential returns the credential shared by every client created during a run
+func NewCredential() (azcore.TokenCredential, error) {
+	return azidentity.NewDefaultAzureCredential(nil)
+}
+
+// NewComputeClient returns a client scoped to a single subscription. Calls made by the client are
+// cancelled when `ctx` is done.
+func NewComputeClient(ctx context.Context, subscriptionID string, credential azcore.TokenCredential, tags *Tags,
+	options *Options) (*ComputeClient, error) {
 	var computeClient ComputeClient
 
-	credential, err := azidentity.NewDefaultAzureCredential(nil)
+	// the options are shared between clients, so defaults are applied to a copy
+	var opts Options
+	if options != nil {
+		opts = *options
+	}
+
+	if opts.Pool == nil {
+		opts.Pool = pool.New(1, 0)
+	}
+
+	clientOptions := opts.clientOptions()
+
+	client, err := compute.NewVirtualMachinesClient(subscriptionID, credential, clientOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := compute.NewVirtualMachinesClient(subscriptionID, credential, nil)
+	tagsClient, err := armresources.NewTagsClient(subscriptionID, credential, clientOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	tags, err := NewTagsFromConfig(tagsConfigPath)
+	armClient, err := arm.NewClient("instancescheduler", "v1.0.0", credential, clientOptions)
 	if err != nil {
 		return nil, err
 	}
 
 	computeClient.client = client
-	computeClient.ctx = context.Background()
+	computeClient.tagsClient = tagsClient
+	computeClient.armClient = armClient
+	computeClient.ctx = ctx
+	computeClient.options = opts
+	computeClient.SubscriptionID = subscriptionID
 	computeClient.Tags = tags
 
 	return &computeClient, nil
 }
 
-type ComputeClient struct {
-	Tags *Tags
+const (
+	// ConcurrencyScopeSubscription limits concurrency per subscription
+	ConcurrencyScopeSubscription = "subscription"
+	// ConcurrencyScopeResourceGroup limits concurrency per resource group
+	ConcurrencyScopeResourceGroup = "resourcegroup"
+)
 
-	client *compute.VirtualMachinesClient
-	ctx    context.Context
+// Options controls how a compute client assesses and actions instances
+type Options struct {
+	// Pool bounds how many instances are assessed and actioned at once, it should be shared between
+	// clients so that the limits apply across the whole run. A client without one uses a single worker.
+	Pool *pool.Pool
+	// ConcurrencyScope is the scope the pool's per key limit applies to, either
+	// `ConcurrencyScopeSubscription` or `ConcurrencyScopeResourceGroup`
+	ConcurrencyScope string
+	// ActionTimeout is the maximum time a power action may take, including polling for completion.
+	// Zero means no timeout.
+	ActionTimeout time.Duration
+	// State is where in-flight operations are tracked between runs
+	State *state.Store
+	// NoWait issues power actions without waiting for them to finish, their resume tokens are saved
+	// to the state so that a later run can check on them
+	NoWait bool
+	// StopMode is how instances are stopped when their tags do not set a stop mode
+	StopMode StopMode
+	// Retry controls how failed calls are retried, a single attempt is made when it is unset
+	Retry RetryOptions
+	// DryRun assesses instances without starting or stopping them, or changing the state
+	DryRun bool
+	// InstanceFilter limits which instances are assessed, every instance is assessed when it is nil
+	InstanceFilter func(Instance) bool
+	// StatusTags writes the outcome of assessing each instance back to its tags
+	StatusTags bool
+	// ManualChanges is how power state changes the scheduler did not make are treated when an
+	// instance's tags do not say, `ManualChangesRespect` is used when it is unset
+	ManualChanges ManualChanges
+	// ManualGrace is how long a respected manual change is left alone for, zero leaves it alone until
+	// the instance's next transition
+	ManualGrace time.Duration
+	// Limits stop instances flapping between started and stopped, they rely on the history kept in
+	// the state
+	Limits decision.Limits
+	// Warner warns an instance's owner ahead of it being stopped, no warnings are sent when it is nil
+	Warner *notify.Warner
+	// Events publishes an event for each action attempted and each outcome, no events are published
+	// when it is nil
+	Events *events.Publisher
+	// Metrics records the outcome of power actions and every request made by the client, nothing is
+	// recorded when it is nil
+	Metrics *metrics.Metrics
+	// Tracing records the client's requests as OpenTelemetry spans and passes the trace context on
+	// to Azure
+	Tracing bool
+	// Audit records every evaluation and action, nothing is recorded when it is nil
+	Audit *audit.Log
+}
+
+// clientOptions returns the options for the Azure clients, retrying throttled requests and server
+// errors with the retry options, adding the metrics policy to their pipelines when metrics are
+// enabled, and recording their requests as spans when tracing is
+func (o *Options) clientOptions() *arm.ClientOptions {
+	options := &arm.ClientOptions{}
+	options.Retry = pipelineRetryOptions(o.Retry)
+
+	if o.Metrics != nil {
+		options.PerRetryPolicies = append(options.PerRetryPolicies, o.Metrics.Policy())
+	}
+
+	if o.Tracing {
+		options.TracingProvider = telemetry.AzureProvider()
+		options.PerRetryPolicies = append(options.PerRetryPolicies, telemetry.PropagationPolicy())
+	}
+
+	return options
+}
+
+// withContext returns a copy of the client whose calls are made with `ctx`, such as one carrying the
+// span of the instance being assessed
+func (c *ComputeClient) withContext(ctx context.Context) *ComputeClient {
+	client := *c
+	client.ctx = ctx
+
+	return &client
+}
+
+// instanceAttributes returns the span attributes identifying an instance
+func instanceAttributes(instance Instance) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		telemetry.AttributeSubscription.String(instance.SubscriptionID),
+		telemetry.AttributeResourceGroup.String(instance.ResourceGroup),
+		telemetry.AttributeInstance.String(instance.Name),
+		telemetry.AttributeInstanceID.String(instance.ID),
+	}
+}
+
+type ComputeClient struct {
+	SubscriptionID string
+	Tags           *Tags
+
+	client     *compute.VirtualMachinesClient
+	tagsClient *armresources.TagsClient
+	armClient  *arm.Client
+	ctx        context.Context
+	options    Options
 }
 
 // ListInstances returns a list of all instances within an Azure subscription
-func (c *ComputeClient) ListInstances() ([]*compute.VirtualMachine, error) {
-	var instances []*compute.VirtualMachine
+func (c *ComputeClient) ListInstances() (instances []Instance, err error) {
+	ctx, span := telemetry.Start(c.ctx, "list instances", telemetry.AttributeSubscription.String(c.SubscriptionID))
+	defer func() { telemetry.End(span, err) }()
+
 	pager := c.client.NewListAllPager(nil)
 
 	for pager.More() {
-		page, err := pager.NextPage(c.ctx)
+		var page compute.VirtualMachinesClientListAllResponse
+
+		err := retry(ctx, c.options.Retry, "list instances", func() error {
+			var err error
+			page, err = pager.NextPage(ctx)
+			return err
+		})
 		if err != nil {
 			return nil, err
 		}
 
-		for _, instance := range page.Value {
+		for _, vm := range page.Value {
+			instance, err := NewInstanceFromVirtualMachine(vm)
+			if err != nil {
+				log.Error().Stack().Err(err).Str("instance", *vm.Name).Msg("Unable to parse resource ID")
+				continue
+			}
+
 			instances = append(instances, instance)
 		}
 	}
@@ -75,146 +228,620 @@ func (c *ComputeClient) ListInstances() ([]*compute.VirtualMachine, error) {
 }
 
 // AssessInstancesAndAction iterates through the `instances` passed into the method to ascertain
-// if the instance should be; powered-off, powered-on, or no action
-func (c *ComputeClient) AssessInstancesAndAction(instances []*compute.VirtualMachine) {
+// if the instance should be; powered-off, powered-on, or no action. Instances are assessed
+// concurrently within the limits of the client's pool, and a result is returned for every instance
+// that has scheduling enabled.
+func (c *ComputeClient) AssessInstancesAndAction(instances []Instance) []report.Result {
+	var results []report.Result
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
 	for _, instance := range instances {
-		var isWithinPatchWindow bool
-		var isCurrentTimeWithinPatchWindow bool
+		values := c.Tags.LoadValues(instance.Tags)
+		if !values.Enabled {
+			continue
+		}
 
-		resourceID, err := arm.ParseResourceID(*instance.ID)
-		if err != nil {
-			log.Error().Stack().Err(err).Str("instance", *instance.Name).Msg("Unable to parse resource ID")
+		if c.options.InstanceFilter != nil && !c.options.InstanceFilter(instance) {
 			continue
 		}
 
-		enabled, stringSchedule, stringPatchWindow := c.Tags.LoadValues(instance.Tags)
+		wg.Add(1)
+		go func(instance Instance, values TagValues) {
+			defer wg.Done()
 
-		log.Debug().Msgf("String patch window: %s", stringPatchWindow)
+			result := c.assessInstance(instance, values)
+			c.writeStatus(instance, result)
+			c.publishResult(instance, result)
 
-		if enabled {
-			schedule, err := schedule.NewSchedule([]byte(stringSchedule))
-			if err != nil {
-				log.Error().Stack().Err(err).Msg("Unable to create a schedule based on input")
-			}
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}(instance, values)
+	}
 
-			patchWindow, err := patchwindow.New([]byte(stringPatchWindow))
-			if err != nil {
-				log.Error().Stack().Err(err).Msg("Failed to get patch window")
-			}
+	wg.Wait()
 
-			nextPatchWindowStart, err := patchWindow.NextWindowStart()
-			if err != nil {
-				log.Error().Stack().Err(err).Msg("Failed to get the next patch window start date")
-			}
+	return results
+}
 
-			log.Debug().Msgf("Next patch window start: %s", nextPatchWindowStart.String())
+// assessInstance assesses and actions a single instance, whose tag values have already been loaded,
+// once a slot in the pool is available. Every step of the decision is recorded in the result's trace,
+// which is also written to the debug log.
+func (c *ComputeClient) assessInstance(instance Instance, values TagValues) report.Result {
+	var isWithinPatchWindow bool
+	var isCurrentTimeWithinPatchWindow bool
+
+	trace := report.NewTrace(instance.Tags)
+
+	result := report.Result{
+		InstanceID:     instance.ID,
+		SubscriptionID: c.SubscriptionID,
+		ResourceGroup:  instance.ResourceGroup,
+		Instance:       instance.Name,
+		Action:         report.ActionNone,
+		Trace:          trace,
+	}
 
-			if !schedule.Validate() || !schedule.ValidateOverrides() {
-				continue
-			}
+	defer func() {
+		trace.Action, trace.Reason = result.Action, result.Reason
+		if result.Err != nil {
+			trace.Step("error", "%v", result.Err)
+		}
 
-			isInstanceRunning := c.IsInstanceRunning(resourceID.ResourceGroupName, resourceID.Name)
-			shouldShutdown := schedule.ShouldShutdown()
+		log.Debug().Str("instance", instance.Name).Interface("trace", trace).Msg("Decision trace")
+	}()
 
-			if patchWindow != nil {
-				isWithinPatchWindow = schedule.IsWithinPatchWindow(
-					patchWindow.Timeslice.Start, patchWindow.Timeslice.End, patchWindow.IsToday(),
-				)
-				isCurrentTimeWithinPatchWindow = patchWindow.CurrentTimeWithinRange()
-			} else {
-				isWithinPatchWindow = false
-			}
+	release, err := c.options.Pool.Acquire(c.ctx, c.concurrencyKey(instance))
+	defer release()
+	if err != nil {
+		result.Action, result.Err = report.ActionError, err
+		return result
+	}
+
+	ctx, span := telemetry.Start(c.ctx, "evaluate", instanceAttributes(instance)...)
+	c = c.withContext(ctx)
+
+	defer func() {
+		span.SetAttributes(telemetry.AttributeAction.String(string(result.Action)),
+			telemetry.AttributeRule.String(trace.Rule), telemetry.AttributeReason.String(result.ReasonCode))
+		telemetry.End(span, result.Err)
+	}()
+
+	started := time.Now()
+	defer func() { c.auditEvaluation(instance, result, started) }()
+
+	if c.options.State != nil {
+		if operation, ok := c.options.State.Operation(instance.ID); ok {
+			log.Info().Str("instance", instance.Name).Str("method", operation.Method).
+				Msg("Skipping instance as an earlier operation is still in progress")
+			result.Action = report.ActionInProgress
+			result.Reason = "An earlier " + operation.Method + " operation is still in progress"
+			trace.Rule = "operation-in-progress"
+			trace.Step("state", "%s operation started at %s is still in progress", operation.Method,
+				operation.StartedAt.Format(time.RFC3339))
+			return result
+		}
 
-			c.ManagePowerState(isInstanceRunning, isWithinPatchWindow, isCurrentTimeWithinPatchWindow,
-				shouldShutdown, resourceID.ResourceGroupName, resourceID.Name)
+		if failure, ok := c.options.State.Failure(instance.ID); ok {
+			log.Info().Str("instance", instance.Name).Int("attempts", failure.Attempts).
+				Str("lastError", failure.Error).Msg("Retrying instance that failed on an earlier run")
+			trace.Step("state", "retrying after %d failed attempt(s), last error: %s", failure.Attempts, failure.Error)
 		}
 	}
-}
 
-// ManagePowerState will power-off, power-on or leave an instance alone
-func (c *ComputeClient) ManagePowerState(isInstanceRunning, isWithinPatchWindow,
-	isCurrentTimeWithinPatchWindow, shouldShutdown bool, resourceGroupName, instanceName string) {
-	if shouldShutdown && isInstanceRunning && !isWithinPatchWindow {
-		c.ShutdownInstance(resourceGroupName, instanceName)
-	} else if !shouldShutdown && !isInstanceRunning {
-		c.StartInstance(resourceGroupName, instanceName)
-	} else if isCurrentTimeWithinPatchWindow && !isInstanceRunning {
-		log.Info().Str("instance", instanceName).Msg("Instance is starting as its within 1 hour of the patch window.")
-		c.StartInstance(resourceGroupName, instanceName)
+	trace.Step("tags", "enabled=%t schedule=%q patchWindow=%q stopMode=%q", values.Enabled, values.Schedule,
+		values.PatchWindow, values.StopMode)
+
+	log.Debug().Msgf("String patch window: %s", values.PatchWindow)
+
+	stopMode, err := c.stopMode(instance, values)
+	if err != nil {
+		log.Error().Err(err).Str("instance", instance.Name).Msg("Invalid stop mode")
+		result.Action, result.Err, result.InvalidTags = report.ActionError, err, true
+		return result
+	}
+
+	trace.StopMode = stopMode.String()
+	trace.Step("stop mode", "instance is stopped with %s", stopMode)
+
+	schedule, err := schedule.NewSchedule([]byte(values.Schedule))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("Unable to create a schedule based on input")
+		result.Action, result.Err, result.InvalidTags = report.ActionError, err, true
+		return result
+	}
+
+	trace.Schedule = schedule
+
+	patchWindow, err := patchwindow.New([]byte(values.PatchWindow))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("Failed to get patch window")
+		if values.PatchWindow != "" {
+			trace.PatchWindow.Error = err.Error()
+		}
+	}
+
+	nextPatchWindowStart, err := patchWindow.NextWindowStart()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("Failed to get the next patch window start date")
 	} else {
-		log.Info().Str("instance", instanceName).Msg("No action required")
+		trace.PatchWindow.NextStart = &nextPatchWindowStart
 	}
-}
 
-// ShutdownInstance will shutdown a given instance
-func (c *ComputeClient) ShutdownInstance(resourceGroupName string, instanceName string) {
-	opts := &compute.VirtualMachinesClientBeginPowerOffOptions{
-		SkipShutdown: to.Ptr(false),
+	log.Debug().Msgf("Next patch window start: %s", nextPatchWindowStart.String())
+
+	if !schedule.Validate() || !schedule.ValidateOverrides() {
+		result.Reason, result.InvalidTags = "Schedule is invalid", true
+		trace.Rule = "invalid-schedule"
+		trace.Step("schedule", "schedule failed validation, no action is taken")
+		return result
 	}
 
-	log.Info().Str("instance", instanceName).Msg("Shutting down instance")
+	now := time.Now().Local()
+
+	if shouldOverride, overrideKey := schedule.UseOverride(now.Weekday()); shouldOverride {
+		trace.ScheduleSource = "override:" + overrideKey
+	} else {
+		trace.ScheduleSource = "default"
+	}
 
-	poller, err := c.client.BeginPowerOff(c.ctx, resourceGroupName, instanceName, opts)
+	trace.Windows = schedule.WindowsFor(now.Weekday())
+	trace.Step("schedule", "%s applies on %s with windows %v", trace.ScheduleSource, now.Weekday(), trace.Windows)
+
+	activeOverride, err := c.override(instance, values, now)
 	if err != nil {
-		log.Error().Stack().Err(err).Str("instance", instanceName).Msg("Failed to execute power off")
-		return
+		log.Error().Err(err).Str("instance", instance.Name).Msg("Invalid override")
+		result.Action, result.Err, result.InvalidTags = report.ActionError, err, true
+		c.recordFailure(instance, err)
+		return result
+	}
+
+	if activeOverride != nil {
+		trace.Step("override", "instance is kept %s until %s", activeOverride.State,
+			activeOverride.Until.Format(time.RFC3339))
 	}
 
-	_, err = poller.PollUntilDone(c.ctx, nil)
+	snoozedUntil, err := c.snooze(instance, values, now)
 	if err != nil {
-		log.Error().Stack().Err(err).Str("instance", instanceName).Msg("Failed to complete power off")
+		log.Error().Err(err).Str("instance", instance.Name).Msg("Invalid snooze")
+		result.Action, result.Err, result.InvalidTags = report.ActionError, err, true
+		c.recordFailure(instance, err)
+		return result
+	}
+
+	if !snoozedUntil.IsZero() {
+		trace.Step("snooze", "stopping the instance is snoozed until %s", snoozedUntil.Format(time.RFC3339))
+	}
+
+	result.NextTransition = nextTransition(now, schedule, patchWindow)
+	if activeOverride != nil && (result.NextTransition.IsZero() || activeOverride.Until.Before(result.NextTransition)) {
+		result.NextTransition = activeOverride.Until
+	}
+
+	if !result.NextTransition.IsZero() {
+		result.NextAction = report.ActionStop
+		if !schedule.ShouldShutdownAt(result.NextTransition) || patchWindow.ActiveAt(result.NextTransition) {
+			result.NextAction = report.ActionStart
+		}
+	}
+
+	powerState := instance.PowerState
+	if powerState == "" || c.stalePowerState(instance) {
+		ctx, span := telemetry.Start(c.ctx, "instance view", instanceAttributes(instance)...)
+		powerState, err = c.withContext(ctx).InstancePowerState(instance.ResourceGroup, instance.Name)
+		telemetry.End(span, err)
+
+		if err != nil {
+			log.Error().Err(err).Str("instance", instance.Name).Msg("Failed to get instance power state")
+			result.Action, result.Err = report.ActionError, err
+			c.recordFailure(instance, err)
+			return result
+		}
+	}
+
+	result.PowerState = powerState.String()
+	trace.PowerState = powerState.String()
+	trace.Step("power state", "instance is %s", powerState)
+
+	shouldShutdown := schedule.ShouldShutdownAt(now)
+	trace.ShouldShutdown = shouldShutdown
+	trace.Step("desired state", "schedule wants the instance %s at %s", desiredState(shouldShutdown),
+		now.Format("Mon 15:04"))
+
+	if patchWindow != nil {
+		isWithinPatchWindow = schedule.IsWithinPatchWindow(
+			patchWindow.Timeslice.Start, patchWindow.Timeslice.End, patchWindow.IsToday(),
+		)
+		isCurrentTimeWithinPatchWindow = patchWindow.CurrentTimeWithinRange()
+
+		trace.PatchWindow.Configured = true
+		trace.PatchWindow.IsToday = patchWindow.IsToday()
+		trace.PatchWindow.Within = isWithinPatchWindow
+		trace.PatchWindow.PreStart = isCurrentTimeWithinPatchWindow
+		trace.Step("patch window", "today=%t withinPatchWindow=%t withinPreStart=%t", trace.PatchWindow.IsToday,
+			isWithinPatchWindow, isCurrentTimeWithinPatchWindow)
+	} else {
+		isWithinPatchWindow = false
+		trace.Step("patch window", "no patch window configured")
+	}
+
+	result.DesiredState = desiredState(shouldShutdown && !isWithinPatchWindow)
+	if activeOverride != nil {
+		result.DesiredState = string(activeOverride.State)
+	}
+
+	input := decision.Input{
+		Running:           powerState.IsRunning(),
+		StoppedAllocated:  powerState == PowerStateStopped,
+		ShouldShutdown:    shouldShutdown,
+		WithinPatchWindow: isWithinPatchWindow,
+		WithinPreStart:    isCurrentTimeWithinPatchWindow,
+		Deallocates:       stopMode != StopModePowerOff,
+		NextTransition:    result.NextTransition,
+	}
+
+	if activeOverride != nil {
+		input.Override = activeOverride.State
+	}
+
+	input.RespectManualChange, err = c.manualChange(instance, values, powerState, now, result.NextTransition, trace)
+	if err != nil {
+		log.Error().Err(err).Str("instance", instance.Name).Msg("Invalid manual changes mode")
+		result.Action, result.Err, result.InvalidTags = report.ActionError, err, true
+		c.recordFailure(instance, err)
+		return result
+	}
+
+	input.Now, input.Limits, input.SnoozedUntil = now, c.options.Limits, snoozedUntil
+	if c.options.State != nil {
+		if history, ok := c.options.State.History(instance.ID); ok {
+			input.StateSince = history.RunningSince
+			input.LastAction, input.LastActionAt = report.Action(history.LastAction), history.LastActionAt
+		}
+	}
+
+	d := decision.Evaluate(input)
+	trace.Rule = d.Rule
+
+	if d.Suppressed != "" {
+		trace.Suppressed = append(trace.Suppressed, report.SuppressedAction{
+			Action: d.Suppressed,
+			Rule:   d.SuppressedRule,
+			Reason: string(d.Reason),
+		})
+		trace.Step("suppressed", "rule %s chose %s but it was suppressed: %s", d.SuppressedRule, d.Suppressed,
+			d.Reason.Description())
+	}
+
+	trace.Step("decision", "rule %s chose %s: %s", d.Rule, d.Action, d.Reason)
+
+	// A snooze moves the instance's stop to when the snooze ends
+	if d.Reason == decision.ReasonSnoozed && (result.NextTransition.IsZero() || snoozedUntil.Before(result.NextTransition)) {
+		result.NextTransition, result.NextAction = snoozedUntil, report.ActionStop
+	} else if result.NextAction == report.ActionStop && snoozedUntil.After(result.NextTransition) {
+		result.NextTransition = snoozedUntil
+	}
+
+	if d.Action == report.ActionNone && powerState.IsRunning() && result.NextAction == report.ActionStop {
+		result.WarnAt = c.warn(instance, result.NextTransition, now, trace)
+	}
+
+	result.Action, result.Reason, result.ReasonCode = d.Action, d.Reason.Description(), string(d.Reason)
+
+	if d.Action == report.ActionStart || d.Action == report.ActionStop {
+		c.publishAttempt(instance, d, powerState, stopMode)
+	}
+
+	actionStarted := time.Now()
+	result.Err = c.ApplyDecision(d, stopMode, instance.ResourceGroup, instance.Name)
+	c.auditAction(instance, d, powerState, stopMode, actionStarted, result.Err)
+
+	if result.Err != nil {
+		result.Action = report.ActionError
+		c.recordFailure(instance, result.Err)
+		return result
+	}
+
+	if c.tracksOperations() {
+		c.describeOperation(instance, d)
+	}
+
+	c.recordAction(instance, d.Action, now)
+	c.clearFailure(instance)
+
+	return result
+}
+
+func desiredState(shouldShutdown bool) string {
+	if shouldShutdown {
+		return "stopped"
+	}
+
+	return "running"
+}
+
+// nextTransition returns the earliest time after `now` that either the schedule or the patch window
+// changes an instance's desired state
+func nextTransition(now time.Time, schedule *schedule.Schedule, patchWindow *patchwindow.PatchWindow) time.Time {
+	next := schedule.NextTransition(now)
+
+	if patchWindowNext := patchWindow.NextTransition(now); !patchWindowNext.IsZero() &&
+		(next.IsZero() || patchWindowNext.Before(next)) {
+		next = patchWindowNext
+	}
+
+	return next
+}
+
+// recordFailure saves a failed instance to the state so that it is reported, and retried, on the
+// next run
+func (c *ComputeClient) recordFailure(instance Instance, err error) {
+	if c.options.State == nil || c.options.DryRun {
+		return
+	}
+
+	if err := c.options.State.RecordFailure(instance.ID, err); err != nil {
+		log.Error().Err(err).Str("instance", instance.Name).Msg("Failed to save state")
+	}
+}
+
+// clearFailure removes an instance's earlier failure from the state once it has been assessed
+// successfully
+func (c *ComputeClient) clearFailure(instance Instance) {
+	if c.options.State == nil || c.options.DryRun {
 		return
 	}
 
+	if err := c.options.State.ClearFailure(instance.ID); err != nil {
+		log.Error().Err(err).Str("instance", instance.Name).Msg("Failed to save state")
+	}
+}
+
+// stopMode returns how an instance should be stopped, the instance's tag takes precedence over the
+// client's default. Hibernation falls back to deallocation when the instance does not support it.
+func (c *ComputeClient) stopMode(instance Instance, values TagValues) (StopMode, error) {
+	stopMode := c.options.StopMode
+	if stopMode == "" {
+		stopMode = StopModeDeallocate
+	}
+
+	if values.StopMode != "" {
+		var err error
+
+		stopMode, err = ParseStopMode(values.StopMode)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if stopMode == StopModeHibernate && !instance.HibernationEnabled {
+		log.Warn().Str("instance", instance.Name).Msg("Hibernation is not enabled for instance, deallocating instead")
+		return StopModeDeallocate, nil
+	}
+
+	return stopMode, nil
+}
+
+// override returns the instance's override when it is still active. An expired override is removed
+// from the instance's tags, unless the client is a dry run.
+func (c *ComputeClient) override(instance Instance, values TagValues, now time.Time) (*override.Override, error) {
+	if values.OverrideUntil == "" {
+		return nil, nil
+	}
+
+	o, err := override.Parse(values.OverrideUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Active(now) {
+		return o, nil
+	}
+
+	log.Info().Str("instance", instance.Name).Time("until", o.Until).Bool("dryRun", c.options.DryRun).
+		Msg("Removing expired override")
+
+	if key, value, ok := c.Tags.Lookup(instance.Tags, TagOverrideUntil); ok && !c.options.DryRun {
+		if err := c.DeleteTags(instance, map[string]*string{key: &value}); err != nil {
+			log.Error().Err(err).Str("instance", instance.Name).Msg("Failed to remove expired override")
+		}
+	}
+
+	return nil, nil
+}
+
+// concurrencyKey returns the key used to apply the pool's per key limit to an instance
+func (c *ComputeClient) concurrencyKey(instance Instance) string {
+	if c.options.ConcurrencyScope == ConcurrencyScopeResourceGroup {
+		return strings.ToLower(c.SubscriptionID + "/" + instance.ResourceGroup)
+	}
+
+	return strings.ToLower(c.SubscriptionID)
+}
+
+// actionContext returns the context used for a single power action, bounded by the action timeout
+func (c *ComputeClient) actionContext() (context.Context, context.CancelFunc) {
+	if c.options.ActionTimeout <= 0 {
+		return context.WithCancel(c.ctx)
+	}
+
+	return context.WithTimeout(c.ctx, c.options.ActionTimeout)
+}
+
+// ApplyDecision carries out a decision for an instance, stopping it with the stop mode or starting
+// it. When the client is a dry run the decision is logged without being carried out.
+func (c *ComputeClient) ApplyDecision(d decision.Decision, stopMode StopMode, resourceGroupName,
+	instanceName string) error {
+	log.Info().Str("instance", instanceName).Str("action", string(d.Action)).Str("reason", string(d.Reason)).
+		Bool("dryRun", c.options.DryRun).Msg(d.Reason.Description())
+
+	if c.options.DryRun {
+		return nil
+	}
+
+	var err error
+
+	if d.Action != report.ActionStop && d.Action != report.ActionStart {
+		return nil
+	}
+
+	ctx, span := telemetry.Start(c.ctx, string(d.Action),
+		telemetry.AttributeSubscription.String(c.SubscriptionID),
+		telemetry.AttributeResourceGroup.String(resourceGroupName), telemetry.AttributeInstance.String(instanceName),
+		telemetry.AttributeRule.String(d.Rule), telemetry.AttributeReason.String(string(d.Reason)))
+
+	if d.Action == report.ActionStop {
+		err = c.withContext(ctx).ShutdownInstance(resourceGroupName, instanceName, stopMode)
+	} else {
+		err = c.withContext(ctx).StartInstance(resourceGroupName, instanceName)
+	}
+
+	telemetry.End(span, err)
+	c.options.Metrics.ObserveAction(d.Action, err)
+
+	return err
+}
+
+// ShutdownInstance will stop a given instance using the stop mode
+func (c *ComputeClient) ShutdownInstance(resourceGroupName string, instanceName string, stopMode StopMode) error {
+	log.Info().Str("instance", instanceName).Str("stopMode", stopMode.String()).Msg("Shutting down instance")
+
+	ctx, cancel := c.actionContext()
+	defer cancel()
+
+	var err error
+
+	switch stopMode {
+	case StopModePowerOff:
+		opts := &compute.VirtualMachinesClientBeginPowerOffOptions{
+			SkipShutdown: to.Ptr(false),
+		}
+
+		var poller *runtime.Poller[compute.VirtualMachinesClientPowerOffResponse]
+		err = retry(ctx, c.options.Retry, "power off", func() error {
+			var err error
+			poller, err = c.client.BeginPowerOff(ctx, resourceGroupName, instanceName, opts)
+			return err
+		})
+		if err != nil {
+			log.Error().Stack().Err(err).Str("instance", instanceName).Msg("Failed to execute power off")
+			return err
+		}
+
+		err = waitOrTrack(c, ctx, poller, OperationMethodPowerOff, resourceGroupName, instanceName)
+		if err != nil {
+			err = newError("power off", err)
+		}
+	default:
+		opts := &compute.VirtualMachinesClientBeginDeallocateOptions{
+			Hibernate: to.Ptr(stopMode == StopModeHibernate),
+		}
+
+		var poller *runtime.Poller[compute.VirtualMachinesClientDeallocateResponse]
+		err = retry(ctx, c.options.Retry, "deallocate", func() error {
+			var err error
+			poller, err = c.client.BeginDeallocate(ctx, resourceGroupName, instanceName, opts)
+			return err
+		})
+		if err != nil {
+			log.Error().Stack().Err(err).Str("instance", instanceName).Msg("Failed to execute deallocate")
+			return err
+		}
+
+		err = waitOrTrack(c, ctx, poller, OperationMethodDeallocate, resourceGroupName, instanceName)
+		if err != nil {
+			err = newError("deallocate", err)
+		}
+	}
+
+	if err != nil {
+		log.Error().Stack().Err(err).Str("instance", instanceName).Msg("Failed to complete shutdown")
+		return err
+	}
+
 	log.Info().Str("instance", instanceName).Msg("Shutting down successful")
+
+	return nil
 }
 
 // StartInstance will power-on a given instance
-func (c *ComputeClient) StartInstance(resourceGroupName string, instanceName string) {
+func (c *ComputeClient) StartInstance(resourceGroupName string, instanceName string) error {
 	opts := &compute.VirtualMachinesClientBeginStartOptions{}
 
 	log.Info().Str("instance", instanceName).Msg("Starting up instance")
 
-	poller, err := c.client.BeginStart(c.ctx, resourceGroupName, instanceName, opts)
+	ctx, cancel := c.actionContext()
+	defer cancel()
+
+	var poller *runtime.Poller[compute.VirtualMachinesClientStartResponse]
+	err := retry(ctx, c.options.Retry, "start", func() error {
+		var err error
+		poller, err = c.client.BeginStart(ctx, resourceGroupName, instanceName, opts)
+		return err
+	})
 	if err != nil {
 		log.Error().Stack().Err(err).Str("instance", instanceName).Msg("Failed to execute startup")
-		return
+		return err
 	}
 
-	_, err = poller.PollUntilDone(c.ctx, nil)
+	err = waitOrTrack(c, ctx, poller, OperationMethodStart, resourceGroupName, instanceName)
 	if err != nil {
+		err = newError("start", err)
 		log.Error().Stack().Err(err).Str("instance", instanceName).Msg("Failed to complete startup")
-		return
+		return err
 	}
 
 	log.Info().Str("instance", instanceName).Msg("Startup successful")
+
+	return nil
 }
 
-// IsInstanceRunning determines if a given instance is in a running state
+// InstancePowerState returns the power state of a given instance from its instance view
 //
 // parameters:
 //   - `resourceGroupName` – the name of the resource group
 //   - `instanceName` - name of the instance in Azure
 //
 // returns:
-//   - `bool`
-func (c *ComputeClient) IsInstanceRunning(resourceGroupName string, instanceName string) bool {
-	instance, err := c.client.InstanceView(c.ctx, resourceGroupName, instanceName, nil)
+//   - `PowerState`
+//   - `error`
+func (c *ComputeClient) InstancePowerState(resourceGroupName string, instanceName string) (PowerState, error) {
+	var instance compute.VirtualMachinesClientInstanceViewResponse
+
+	err := retry(c.ctx, c.options.Retry, "instance view", func() error {
+		var err error
+		instance, err = c.client.InstanceView(c.ctx, resourceGroupName, instanceName, nil)
+		return err
+	})
 	if err != nil {
-
+		return PowerStateUnknown, err
 	}
 
 	for _, status := range instance.Statuses {
-		if strings.Contains(*status.Code, "PowerState/") {
+		if status.Code != nil && strings.Contains(*status.Code, "PowerState/") {
 			powerState := ParsePowerState(*status.Code)
 
 			log.Debug().Str("parsed", powerState.String()).Str("raw", *status.Code).Msg("Instance Power State")
 
-			if powerState == PowerStateRunning || powerState == PowerStateStarting {
-				return true
-			}
+			return powerState, nil
 		}
 	}
 
-	return false
+	return PowerStateUnknown, nil
+}
+
+// IsInstanceRunning determines if a given instance is in a running state
+//
+// parameters:
+//   - `resourceGroupName` – the name of the resource group
+//   - `instanceName` - name of the instance in Azure
+//
+// returns:
+//   - `bool`
+//   - `error`
+func (c *ComputeClient) IsInstanceRunning(resourceGroupName string, instanceName string) (bool, error) {
+	powerState, err := c.InstancePowerState(resourceGroupName, instanceName)
+
+	return powerState.IsRunning(), err
 }
@@ -0,0 +1,53 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// TestNewComputeClient checks a client keeps the retry options it was given, even when they make a
+// single attempt, and defaults its pool without changing the options shared with other clients
+func TestNewComputeClient(t *testing.T) {
+	testCases := []struct {
+		name  string
+		retry RetryOptions
+	}{
+		{name: "single attempt", retry: RetryOptions{}},
+		{name: "default", retry: DefaultRetryOptions},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			options := &Options{Retry: test.retry}
+			want := *options
+
+			client, err := NewComputeClient(context.Background(), "sub-1", fakeCredential{}, testTags(), options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if client.options.Retry != test.retry {
+				t.Errorf("got: %+v, want: %+v", client.options.Retry, test.retry)
+			}
+
+			if client.options.Pool == nil {
+				t.Error("got: no pool, want: a single worker pool")
+			}
+
+			if !reflect.DeepEqual(*options, want) {
+				t.Errorf("got: %+v, want: %+v", *options, want)
+			}
+		})
+	}
+}
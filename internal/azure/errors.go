@@ -0,0 +1,140 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// ErrorKind classifies a failed Azure Resource Manager call
+type ErrorKind string
+
+const (
+	ErrorKindThrottled ErrorKind = "throttled"
+	ErrorKindServer    ErrorKind = "server"
+	ErrorKindConflict  ErrorKind = "conflict"
+	ErrorKindNotFound  ErrorKind = "not-found"
+	ErrorKindCancelled ErrorKind = "cancelled"
+	ErrorKindOther     ErrorKind = "other"
+)
+
+// Error is a failed Azure Resource Manager call, along with the information needed to decide if and
+// when the call should be retried
+type Error struct {
+	Kind       ErrorKind
+	Operation  string
+	StatusCode int
+	Code       string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s failed (%s, status %d, code %s): %v", e.Operation, e.Kind, e.StatusCode, e.Code, e.Err)
+	}
+
+	return fmt.Sprintf("%s failed (%s): %v", e.Operation, e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// transientConflictCodes are the error codes of conflicts that clear once another operation on the
+// instance has finished. Other conflicts, such as `OperationNotAllowed`, fail the same way every time.
+var transientConflictCodes = []string{"AnotherOperationInProgress", "OperationPreempted", "RetryableError"}
+
+// Retryable determines if the call may succeed when retried, this covers conflicts caused by another
+// operation still being in progress on the instance. Throttling and server errors are not, as the
+// clients' pipeline has already retried them.
+func (e *Error) Retryable() bool {
+	if e.Kind != ErrorKindConflict {
+		return false
+	}
+
+	for _, code := range transientConflictCodes {
+		if strings.EqualFold(e.Code, code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newError classifies `err` returned by the Azure SDK for the named operation
+func newError(operation string, err error) *Error {
+	var azureErr *Error
+	if errors.As(err, &azureErr) {
+		return azureErr
+	}
+
+	result := &Error{
+		Kind:      ErrorKindOther,
+		Operation: operation,
+		Err:       err,
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		result.Kind = ErrorKindCancelled
+		return result
+	}
+
+	var responseErr *azcore.ResponseError
+	if !errors.As(err, &responseErr) {
+		return result
+	}
+
+	result.StatusCode = responseErr.StatusCode
+	result.Code = responseErr.ErrorCode
+
+	switch {
+	case responseErr.StatusCode == http.StatusTooManyRequests:
+		result.Kind = ErrorKindThrottled
+	case responseErr.StatusCode == http.StatusConflict:
+		result.Kind = ErrorKindConflict
+	case responseErr.StatusCode == http.StatusNotFound:
+		result.Kind = ErrorKindNotFound
+	case responseErr.StatusCode >= http.StatusInternalServerError:
+		result.Kind = ErrorKindServer
+	}
+
+	if responseErr.RawResponse != nil {
+		result.RetryAfter = parseRetryAfter(responseErr.RawResponse.Header.Get("Retry-After"))
+	}
+
+	return result
+}
+
+// parseRetryAfter parses a `Retry-After` header, which is either a number of seconds or a HTTP date
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return max(time.Until(date), 0)
+	}
+
+	return 0
+}
@@ -0,0 +1,155 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"instancescheduler/internal/decision"
+	"instancescheduler/internal/events"
+	"instancescheduler/internal/report"
+	"instancescheduler/internal/state"
+
+	"github.com/rs/zerolog/log"
+)
+
+// eventData describes an instance in the events published about it
+func eventData(instance Instance) events.Data {
+	tags := make(map[string]string, len(instance.Tags))
+
+	for key, value := range instance.Tags {
+		if value != nil {
+			tags[key] = *value
+		}
+	}
+
+	return events.Data{
+		InstanceID:     instance.ID,
+		SubscriptionID: instance.SubscriptionID,
+		ResourceGroup:  instance.ResourceGroup,
+		Instance:       instance.Name,
+		Tags:           tags,
+		PowerState:     instance.PowerState.String(),
+	}
+}
+
+// publish sends an event about an instance, when events are configured. Events are not published on
+// a dry run, and a failure to deliver them is logged rather than failing the instance.
+func (c *ComputeClient) publish(eventType, reason string, data events.Data) {
+	if c.options.Events == nil || c.options.DryRun {
+		return
+	}
+
+	event := events.New(c.options.Events.Source, eventType, reason, data)
+
+	if err := c.options.Events.Publish(c.ctx, event); err != nil {
+		log.Error().Err(err).Str("instance", data.Instance).Str("type", eventType).Msg("Failed to publish event")
+	}
+}
+
+// publishAttempt publishes that a start or stop is about to be sent to an instance
+func (c *ComputeClient) publishAttempt(instance Instance, d decision.Decision, powerState PowerState,
+	stopMode StopMode) {
+	data := eventData(instance)
+	data.Action, data.Reason = string(d.Action), d.Reason.Description()
+	data.PowerState, data.StopMode = powerState.String(), stopMode.String()
+
+	c.publish(events.TypeActionAttempted, string(d.Reason), data)
+}
+
+// publishResult publishes the outcome of assessing an instance: started, stopped, failed, or skipped
+// when the schedule wanted an action that was held back. An operation left for a later run has only
+// been attempted, it is published as started or stopped once tracking finds it has finished. A
+// skipped or failed event is only published again once the action or reason code changes.
+func (c *ComputeClient) publishResult(instance Instance, result report.Result) {
+	var eventType string
+
+	data := eventData(instance)
+	data.Action, data.Reason, data.PowerState = string(result.Action), result.Reason, result.PowerState
+
+	switch {
+	case (result.Action == report.ActionStart || result.Action == report.ActionStop) && c.tracksOperations():
+		return
+	case result.Action == report.ActionStart:
+		eventType = events.TypeInstanceStarted
+	case result.Action == report.ActionStop:
+		eventType = events.TypeInstanceStopped
+	case result.Action == report.ActionError:
+		if result.Err != nil {
+			data.Error = result.Err.Error()
+		}
+
+		eventType = events.TypeActionFailed
+	case result.ReasonCode == string(decision.ReasonPatchWindowKeepsRunning):
+		data.Action = string(report.ActionStop)
+		eventType = events.TypeActionSkipped
+	case result.Trace != nil && len(result.Trace.Suppressed) > 0:
+		data.Action = string(result.Trace.Suppressed[0].Action)
+		eventType = events.TypeActionSkipped
+	}
+
+	var heldBack string
+	if eventType == events.TypeActionSkipped || eventType == events.TypeActionFailed {
+		heldBack = eventType + " " + data.Action + " " + result.ReasonCode
+	}
+
+	if c.repeatsHeldBack(instance, heldBack) || eventType == "" {
+		return
+	}
+
+	c.publish(eventType, result.ReasonCode, data)
+}
+
+// repeatsHeldBack reports whether `heldBack` is the skipped or failed event last published for an
+// instance, recording it otherwise. Any other outcome clears it, so that a decision held back again
+// later is published again. Without a state file events are not deduplicated.
+func (c *ComputeClient) repeatsHeldBack(instance Instance, heldBack string) bool {
+	if c.options.Events == nil || c.options.State == nil || c.options.DryRun {
+		return false
+	}
+
+	history, _ := c.options.State.History(instance.ID)
+	if history.HeldBack == heldBack {
+		return heldBack != ""
+	}
+
+	c.updateHistory(instance, func(h *state.History) {
+		h.HeldBack = heldBack
+	})
+
+	return false
+}
+
+// publishOperation publishes the outcome of an operation issued by an earlier run once it has
+// finished: started or stopped when it succeeded, failed otherwise
+func (c *ComputeClient) publishOperation(operation state.Operation, err error) {
+	data := events.Data{
+		InstanceID:     operation.InstanceID,
+		SubscriptionID: operation.SubscriptionID,
+		ResourceGroup:  operation.ResourceGroup,
+		Instance:       operation.Instance,
+		Tags:           operation.Tags,
+		Action:         string(report.ActionStop),
+		Reason:         decision.Reason(operation.Reason).Description(),
+	}
+
+	if operation.Method == OperationMethodStart {
+		data.Action = string(report.ActionStart)
+	}
+
+	switch {
+	case err != nil:
+		data.Error = err.Error()
+		c.publish(events.TypeActionFailed, operation.Reason, data)
+	case operation.Method == OperationMethodStart:
+		c.publish(events.TypeInstanceStarted, operation.Reason, data)
+	default:
+		c.publish(events.TypeInstanceStopped, operation.Reason, data)
+	}
+}
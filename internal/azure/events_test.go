@@ -0,0 +1,188 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"instancescheduler/internal/decision"
+	"instancescheduler/internal/events"
+	"instancescheduler/internal/report"
+	"instancescheduler/internal/state"
+)
+
+// TestPublishTrackedOperation checks a stop that is not waited for is only published as attempted,
+// and as stopped or failed by the run that finds it has finished
+func TestPublishTrackedOperation(t *testing.T) {
+	// every day is off, so that the schedule wants the instance stopped whenever the test runs
+	const alwaysOff = `{"default": "09:00-17:00", "overrides": {"Monday": ["-"], "Tuesday": ["-"],
+		"Wednesday": ["-"], "Thursday": ["-"], "Friday": ["-"], "Saturday": ["-"], "Sunday": ["-"]}}`
+
+	testCases := []struct {
+		name      string
+		status    string
+		wantTypes []string
+	}{
+		{
+			name:      "succeeded",
+			status:    `{"status": "Succeeded"}`,
+			wantTypes: []string{events.TypeActionAttempted, events.TypeInstanceStopped},
+		},
+		{
+			name:      "failed",
+			status:    `{"status": "Failed", "error": {"code": "InternalExecutionError", "message": "failed"}}`,
+			wantTypes: []string{events.TypeActionAttempted, events.TypeActionFailed},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var published []events.Event
+			var mu sync.Mutex
+
+			endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var event events.Event
+				if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+					t.Errorf("unable to decode event: %v", err)
+				}
+
+				mu.Lock()
+				published = append(published, event)
+				mu.Unlock()
+			}))
+			defer endpoint.Close()
+
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+
+				if r.Method == http.MethodPost {
+					w.Header().Set("Azure-AsyncOperation", fmt.Sprintf("https://%s/operations/stop", r.URL.Host))
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+
+				fmt.Fprint(w, test.status)
+			}
+
+			store, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tags := map[string]string{"AutoShutdownEnabled": "true", "AutoShutdownScheduleV2": alwaysOff}
+			instance := Instance{
+				ID:             "/subscriptions/sub-1/resourceGroups/rg-1/providers/Microsoft.Compute/virtualMachines/vm-1",
+				SubscriptionID: "sub-1",
+				ResourceGroup:  "rg-1",
+				Name:           "vm-1",
+				Tags:           tagMap(tags),
+				PowerState:     PowerStateRunning,
+			}
+
+			err = store.UpdateHistory(instance.ID, func(h *state.History) {
+				h.Running, h.RunningSince = true, time.Now().Add(-2*time.Hour)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := fakeComputeClient(t, handler, Options{
+				NoWait: true,
+				State:  store,
+				Events: &events.Publisher{Endpoints: []events.Endpoint{{URL: endpoint.URL}}},
+			})
+
+			results := client.AssessInstancesAndAction([]Instance{instance})
+			if len(results) != 1 || results[0].Err != nil {
+				t.Fatalf("got: %+v, want: a single result without an error", results)
+			}
+
+			if _, ok := store.Operation(instance.ID); !ok {
+				t.Fatal("got: no tracked operation, want: the stop to be tracked")
+			}
+
+			client.TrackOperations()
+
+			var types []string
+			for _, event := range published {
+				types = append(types, event.Type)
+			}
+
+			if !reflect.DeepEqual(types, test.wantTypes) {
+				t.Fatalf("got: %v, want: %v", types, test.wantTypes)
+			}
+
+			finished := published[len(published)-1]
+
+			if finished.Reason != string(decision.ReasonOutsideSchedule) {
+				t.Errorf("got: %v, want: %v", finished.Reason, decision.ReasonOutsideSchedule)
+			}
+
+			if !reflect.DeepEqual(finished.Data.Tags, tags) {
+				t.Errorf("got: %v, want: %v", finished.Data.Tags, tags)
+			}
+		})
+	}
+}
+
+// TestPublishResultHeldBack checks a decision held back on every run is only published again once
+// the action or reason changes, or after the instance was no longer held back
+func TestPublishResultHeldBack(t *testing.T) {
+	var published []string
+
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event events.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("unable to decode event: %v", err)
+		}
+
+		published = append(published, event.Type+" "+event.Reason)
+	}))
+	defer endpoint.Close()
+
+	store, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fakeComputeClient(t, func(w http.ResponseWriter, r *http.Request) {}, Options{
+		State:  store,
+		Events: &events.Publisher{Endpoints: []events.Endpoint{{URL: endpoint.URL}}},
+	})
+
+	patchWindow := report.Result{Action: report.ActionNone, ReasonCode: string(decision.ReasonPatchWindowKeepsRunning)}
+	failed := report.Result{Action: report.ActionError, ReasonCode: "error", Err: errors.New("failed")}
+	inSchedule := report.Result{Action: report.ActionNone, ReasonCode: string(decision.ReasonAlreadyInDesiredState)}
+
+	instance := Instance{ID: "/subscriptions/sub-1/resourceGroups/rg-1/providers/Microsoft.Compute/virtualMachines/vm-1"}
+	for _, result := range []report.Result{patchWindow, patchWindow, failed, failed, inSchedule, patchWindow} {
+		client.publishResult(instance, result)
+	}
+
+	want := []string{
+		events.TypeActionSkipped + " " + string(decision.ReasonPatchWindowKeepsRunning),
+		events.TypeActionFailed + " error",
+		events.TypeActionSkipped + " " + string(decision.ReasonPatchWindowKeepsRunning),
+	}
+
+	if !reflect.DeepEqual(published, want) {
+		t.Errorf("got: %v, want: %v", published, want)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"instancescheduler/internal/audit"
+	"instancescheduler/internal/decision"
+	"instancescheduler/internal/override"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ActionExtend is the action recorded in the audit log when an instance's keep-running override is
+// extended on request
+const ActionExtend = "extend"
+
+// Extend keeps an instance running until `until` by writing its override tag, unless it already has
+// a keep-running override that lasts longer. It returns when the instance's override now ends. On a
+// dry run the tag is not written.
+func (c *ComputeClient) Extend(instance Instance, until time.Time) (time.Time, error) {
+	started := time.Now()
+
+	key, value, ok := c.Tags.Lookup(instance.Tags, TagOverrideUntil)
+	if !ok {
+		key = c.Tags.Name(TagOverrideUntil)
+	}
+
+	if key == "" {
+		return time.Time{}, errors.New("no override tag is configured")
+	}
+
+	if ok {
+		if existing, err := override.Parse(value); err == nil && existing.State == override.StateRunning &&
+			existing.Until.After(until) {
+			return existing.Until, nil
+		}
+	}
+
+	value = until.Format(time.RFC3339)
+
+	log.Info().Str("instance", instance.Name).Str("tag", key).Str("until", value).Bool("dryRun", c.options.DryRun).
+		Msg("Extending instance with a keep-running override")
+
+	if c.options.DryRun {
+		return until, nil
+	}
+
+	err := c.MergeTags(instance, map[string]*string{key: &value})
+
+	record := audit.Record{
+		Kind:        audit.KindOverride,
+		Action:      ActionExtend,
+		Reason:      string(decision.ReasonOverrideRunning),
+		Description: fmt.Sprintf("Instance is kept running until %s", value),
+	}
+
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	c.writeAudit(instance, record, started)
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return until, nil
+}
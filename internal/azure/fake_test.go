@@ -0,0 +1,91 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"instancescheduler/internal/pool"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+)
+
+// fakeCredential always returns the same token
+type fakeCredential struct{}
+
+func (fakeCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// fakeTransport answers the requests of an Azure client with a handler, rather than calling Azure
+type fakeTransport http.HandlerFunc
+
+func (f fakeTransport) Do(req *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	f(recorder, req)
+
+	resp := recorder.Result()
+	resp.Request = req
+
+	return resp, nil
+}
+
+// fakeClientOptions returns client options that send every request to `handler`, without retries
+func fakeClientOptions(handler http.HandlerFunc) *arm.ClientOptions {
+	return &arm.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Transport: fakeTransport(handler),
+			Retry:     policy.RetryOptions{MaxRetries: -1},
+		},
+	}
+}
+
+// fakeComputeClient returns a compute client for `sub-1` whose requests are answered by `handler`
+func fakeComputeClient(t *testing.T, handler http.HandlerFunc, options Options) *ComputeClient {
+	clientOptions := fakeClientOptions(handler)
+
+	client, err := compute.NewVirtualMachinesClient("sub-1", fakeCredential{}, clientOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	armClient, err := arm.NewClient("instancescheduler", "v1.0.0", fakeCredential{}, clientOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tagsClient, err := armresources.NewTagsClient("sub-1", fakeCredential{}, clientOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if options.Pool == nil {
+		options.Pool = pool.New(1, 0)
+	}
+
+	return &ComputeClient{
+		client:         client,
+		armClient:      armClient,
+		tagsClient:     tagsClient,
+		ctx:            context.Background(),
+		options:        options,
+		SubscriptionID: "sub-1",
+		Tags:           testTags(),
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// managementScope is the scope of tokens for Azure Resource Manager
+const managementScope = "https://management.azure.com/.default"
+
+// Identity returns who the credential authenticates to Azure as, read from the claims of its token.
+// It is the user principal name for a user, or the application ID for a service principal or
+// managed identity, followed by the object ID.
+func Identity(ctx context.Context, credential azcore.TokenCredential) (string, error) {
+	token, err := credential.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{managementScope}})
+	if err != nil {
+		return "", err
+	}
+
+	return identityFromToken(token.Token)
+}
+
+// identityFromToken reads the identity from an access token's claims. The token is not verified, it
+// was just issued to the scheduler by Entra ID.
+func identityFromToken(token string) (string, error) {
+	var claims struct {
+		UPN        string `json:"upn"`
+		UniqueName string `json:"unique_name"`
+		AppID      string `json:"appid"`
+		ObjectID   string `json:"oid"`
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("access token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("unable to decode access token claims: %w", err)
+	}
+
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("unable to parse access token claims: %w", err)
+	}
+
+	var name string
+	for _, claim := range []string{claims.UPN, claims.UniqueName, claims.AppID} {
+		if claim != "" {
+			name = claim
+			break
+		}
+	}
+
+	switch {
+	case name != "" && claims.ObjectID != "":
+		return fmt.Sprintf("%s (%s)", name, claims.ObjectID), nil
+	case name != "":
+		return name, nil
+	case claims.ObjectID != "":
+		return claims.ObjectID, nil
+	default:
+		return "", errors.New("access token does not identify a user or application")
+	}
+}
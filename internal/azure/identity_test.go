@@ -0,0 +1,50 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+// TestIdentityFromToken checks the identity is read from a user's or application's token claims
+func TestIdentityFromToken(t *testing.T) {
+	token := func(claims string) string {
+		return "e30." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2ln"
+	}
+
+	testCases := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{name: "user", token: token(`{"upn":"jo@example.com","oid":"1111"}`), want: "jo@example.com (1111)"},
+		{name: "application", token: token(`{"appid":"2222","oid":"3333"}`), want: "2222 (3333)"},
+		{name: "object ID only", token: token(`{"oid":"4444"}`), want: "4444"},
+		{name: "no identity", token: token(`{}`), wantErr: true},
+		{name: "not a JWT", token: "opaque", wantErr: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := identityFromToken(test.token)
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got: %v, want error: %v", err, test.wantErr)
+			}
+
+			if got != test.want {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
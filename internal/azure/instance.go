@@ -0,0 +1,78 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+)
+
+// Instance is the subset of a virtual machine that the scheduler needs to make a decision,
+// independent of how the instance was discovered
+type Instance struct {
+	ID             string
+	Name           string
+	ResourceGroup  string
+	SubscriptionID string
+	Tags           map[string]*string
+	// Location is the instance's region, such as `australiaeast`
+	Location string
+	// Size is the instance's VM size, such as `Standard_D2s_v3`
+	Size string
+
+	// PowerState is empty when the discovery method does not return it, in which case it is looked
+	// up from the instance view
+	PowerState PowerState
+
+	// HibernationEnabled determines if the instance supports being hibernated
+	HibernationEnabled bool
+}
+
+// NewInstanceFromVirtualMachine converts a virtual machine returned by the compute API
+func NewInstanceFromVirtualMachine(vm *compute.VirtualMachine) (Instance, error) {
+	resourceID, err := arm.ParseResourceID(*vm.ID)
+	if err != nil {
+		return Instance{}, err
+	}
+
+	instance := Instance{
+		ID:             *vm.ID,
+		Name:           resourceID.Name,
+		ResourceGroup:  resourceID.ResourceGroupName,
+		SubscriptionID: resourceID.SubscriptionID,
+		Tags:           vm.Tags,
+	}
+
+	if vm.Location != nil {
+		instance.Location = *vm.Location
+	}
+
+	if vm.Properties != nil && vm.Properties.HardwareProfile != nil && vm.Properties.HardwareProfile.VMSize != nil {
+		instance.Size = string(*vm.Properties.HardwareProfile.VMSize)
+	}
+
+	if vm.Properties != nil && vm.Properties.AdditionalCapabilities != nil &&
+		vm.Properties.AdditionalCapabilities.HibernationEnabled != nil {
+		instance.HibernationEnabled = *vm.Properties.AdditionalCapabilities.HibernationEnabled
+	}
+
+	return instance, nil
+}
+
+// MatchInstance returns a filter matching an instance by its resource ID or, case-insensitively, by
+// its name
+func MatchInstance(nameOrID string) func(Instance) bool {
+	return func(instance Instance) bool {
+		return strings.EqualFold(instance.ID, nameOrID) || strings.EqualFold(instance.Name, nameOrID)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"instancescheduler/internal/report"
+	"instancescheduler/internal/state"
+
+	"github.com/rs/zerolog/log"
+)
+
+// activityLogLookback is how far back the activity log is searched for a manual change when the
+// time the instance entered its previous power state is not known
+const activityLogLookback = 24 * time.Hour
+
+// ManualChanges is how the scheduler treats power state changes it did not make
+type ManualChanges string
+
+const (
+	// ManualChangesRespect leaves a manually changed instance alone for the grace period, or until
+	// its next transition
+	ManualChangesRespect ManualChanges = "respect"
+	// ManualChangesOverride returns a manually changed instance to its scheduled state straight away
+	ManualChangesOverride ManualChanges = "override"
+)
+
+// ParseManualChanges converts a string into `ManualChanges`
+func ParseManualChanges(data string) (ManualChanges, error) {
+	switch mode := ManualChanges(strings.ToLower(strings.TrimSpace(data))); mode {
+	case ManualChangesRespect, ManualChangesOverride:
+		return mode, nil
+	}
+
+	return "", fmt.Errorf("invalid manual changes mode '%s', expected one of respect or override", data)
+}
+
+// respectUntil returns when the scheduler stops leaving alone an instance changed manually at `at`,
+// which is the earlier of the grace period ending and the next transition. The zero time is
+// returned when neither is known.
+func respectUntil(at, nextTransition time.Time, grace time.Duration) time.Time {
+	until := nextTransition
+
+	if grace > 0 && (until.IsZero() || at.Add(grace).Before(until)) {
+		until = at.Add(grace)
+	}
+
+	return until
+}
+
+// stalePowerState determines if an instance's discovered power state should be read again from its
+// instance view, as it disagrees with the power state its history expects. Resource Graph can lag
+// behind an action the scheduler has just taken, which would otherwise be mistaken for a manual
+// change.
+func (c *ComputeClient) stalePowerState(instance Instance) bool {
+	if instance.PowerState == "" || c.options.State == nil {
+		return false
+	}
+
+	history, ok := c.options.State.History(instance.ID)
+
+	return ok && history.Running != instance.PowerState.IsRunning()
+}
+
+// manualChange records the power state the instance was seen in, detecting changes the scheduler did
+// not make by comparing it with the instance's history. The activity log is used to find when, and
+// by whom, the change was made. It returns whether the instance should be left alone at `now`.
+func (c *ComputeClient) manualChange(instance Instance, values TagValues, powerState PowerState,
+	now, nextTransition time.Time, trace *report.Trace) (bool, error) {
+	if c.options.State == nil {
+		return false, nil
+	}
+
+	mode := c.options.ManualChanges
+	if mode == "" {
+		mode = ManualChangesRespect
+	}
+
+	if values.ManualChanges != "" {
+		var err error
+
+		mode, err = ParseManualChanges(values.ManualChanges)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	history, seen := c.options.State.History(instance.ID)
+	running := powerState.IsRunning()
+
+	if seen && history.Running != running {
+		change := PowerChange{At: now}
+
+		since := history.RunningSince
+		if since.IsZero() {
+			since = now.Add(-activityLogLookback)
+		}
+
+		found, err := c.LastPowerChange(instance, since)
+		if err != nil {
+			log.Warn().Err(err).Str("instance", instance.Name).Msg("Failed to read the activity log")
+		} else if found != nil {
+			change = *found
+		}
+
+		log.Info().Str("instance", instance.Name).Str("powerState", powerState.String()).Str("caller", change.Caller).
+			Time("at", change.At).Str("mode", string(mode)).Msg("Detected a manual power state change")
+
+		history.Running, history.RunningSince = running, change.At
+		history.ManualChangeAt, history.ManualChangeBy = change.At, change.Caller
+		history.RespectUntil = time.Time{}
+
+		if mode == ManualChangesRespect {
+			history.RespectUntil = respectUntil(change.At, nextTransition, c.options.ManualGrace)
+		}
+
+		trace.Step("manual change", "instance became %s at %s without the scheduler, caller=%q mode=%s",
+			powerState, change.At.Format(time.RFC3339), change.Caller, mode)
+	} else if !seen {
+		history.Running = running
+	}
+
+	respect := mode == ManualChangesRespect && now.Before(history.RespectUntil)
+	if respect {
+		trace.Step("manual change", "instance is left alone until %s", history.RespectUntil.Format(time.RFC3339))
+	}
+
+	c.updateHistory(instance, func(h *state.History) {
+		*h = history
+		h.InstanceID = instance.ID
+	})
+
+	return respect, nil
+}
+
+// recordAction records an action taken on an instance in its history, so that the power state it
+// leaves the instance in is not mistaken for a manual change
+func (c *ComputeClient) recordAction(instance Instance, action report.Action, now time.Time) {
+	if action != report.ActionStart && action != report.ActionStop {
+		return
+	}
+
+	c.updateHistory(instance, func(h *state.History) {
+		h.LastAction, h.LastActionAt = string(action), now
+		h.Running, h.RunningSince = action == report.ActionStart, now
+		h.RespectUntil = time.Time{}
+	})
+}
+
+func (c *ComputeClient) updateHistory(instance Instance, update func(*state.History)) {
+	if c.options.State == nil || c.options.DryRun {
+		return
+	}
+
+	if err := c.options.State.UpdateHistory(instance.ID, update); err != nil {
+		log.Error().Err(err).Str("instance", instance.Name).Msg("Failed to save state")
+	}
+}
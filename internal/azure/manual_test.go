@@ -0,0 +1,250 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"instancescheduler/internal/report"
+	"instancescheduler/internal/state"
+)
+
+// TestRespectUntil checks a manual change is respected until the earlier of the grace period and the
+// next transition
+func TestRespectUntil(t *testing.T) {
+	at := time.Date(2026, time.October, 19, 20, 0, 0, 0, time.UTC)
+	next := time.Date(2026, time.October, 20, 9, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name           string
+		nextTransition time.Time
+		grace          time.Duration
+		want           time.Time
+	}{
+		{name: "next transition", nextTransition: next, want: next},
+		{name: "grace ends first", nextTransition: next, grace: 2 * time.Hour, want: at.Add(2 * time.Hour)},
+		{name: "transition comes first", nextTransition: next, grace: 24 * time.Hour, want: next},
+		{name: "no transition", grace: time.Hour, want: at.Add(time.Hour)},
+		{name: "neither", want: time.Time{}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			got := respectUntil(at, test.nextTransition, test.grace)
+
+			if !got.Equal(test.want) {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestManualChange checks a power state that differs from the instance's history is detected as a
+// manual change, and respected until its window ends
+func TestManualChange(t *testing.T) {
+	now := time.Date(2026, time.October, 19, 20, 0, 0, 0, time.UTC)
+	next := time.Date(2026, time.October, 20, 9, 0, 0, 0, time.UTC)
+	changedAt := now.Add(-30 * time.Minute)
+
+	testCases := []struct {
+		name             string
+		history          *state.History
+		powerState       PowerState
+		manualChanges    string
+		wantRespect      bool
+		wantChangeAt     time.Time
+		wantRespectUntil time.Time
+	}{
+		{
+			name:       "first seen",
+			powerState: PowerStateRunning,
+		},
+		{
+			name:       "matches last action",
+			history:    &state.History{Running: false, LastAction: "stop", LastActionAt: now.Add(-time.Hour)},
+			powerState: PowerStateDeallocated,
+		},
+		{
+			name:             "differs from last action",
+			history:          &state.History{Running: false, LastAction: "stop", RunningSince: now.Add(-time.Hour)},
+			powerState:       PowerStateRunning,
+			wantRespect:      true,
+			wantChangeAt:     changedAt,
+			wantRespectUntil: next,
+		},
+		{
+			name:          "differs from last action overridden",
+			history:       &state.History{Running: false, LastAction: "stop", RunningSince: now.Add(-time.Hour)},
+			powerState:    PowerStateRunning,
+			manualChanges: "override",
+			wantChangeAt:  changedAt,
+		},
+		{
+			name: "within respect window",
+			history: &state.History{
+				Running: true, ManualChangeAt: changedAt, RespectUntil: next,
+			},
+			powerState:       PowerStateRunning,
+			wantRespect:      true,
+			wantChangeAt:     changedAt,
+			wantRespectUntil: next,
+		},
+		{
+			name: "respect window ended at next transition",
+			history: &state.History{
+				Running: true, ManualChangeAt: changedAt.Add(-24 * time.Hour), RespectUntil: now,
+			},
+			powerState:       PowerStateRunning,
+			wantChangeAt:     changedAt.Add(-24 * time.Hour),
+			wantRespectUntil: now,
+		},
+	}
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !strings.HasSuffix(r.URL.Path, "/eventtypes/management/values") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		fmt.Fprintf(w, `{"value": [{"operationName": {"value": "Microsoft.Compute/virtualMachines/start/action"},
+			"status": {"value": "Succeeded"}, "caller": "jo@example.com", "eventTimestamp": %q}]}`,
+			changedAt.Format(time.RFC3339))
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			store, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			instance := Instance{ID: "/subscriptions/sub-1/resourceGroups/rg-1/virtualMachines/vm-1", Name: "vm-1"}
+
+			if test.history != nil {
+				if err := store.UpdateHistory(instance.ID, func(h *state.History) { *h = *test.history }); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			client := fakeComputeClient(t, handler, Options{State: store})
+
+			got, err := client.manualChange(instance, TagValues{ManualChanges: test.manualChanges}, test.powerState,
+				now, next, report.NewTrace(nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != test.wantRespect {
+				t.Errorf("got: %v, want: %v", got, test.wantRespect)
+			}
+
+			history, _ := store.History(instance.ID)
+
+			if history.Running != test.powerState.IsRunning() {
+				t.Errorf("got running: %v, want: %v", history.Running, test.powerState.IsRunning())
+			}
+
+			if !history.ManualChangeAt.Equal(test.wantChangeAt) {
+				t.Errorf("got: %v, want: %v", history.ManualChangeAt, test.wantChangeAt)
+			}
+
+			if !history.RespectUntil.Equal(test.wantRespectUntil) {
+				t.Errorf("got: %v, want: %v", history.RespectUntil, test.wantRespectUntil)
+			}
+		})
+	}
+}
+
+// TestStalePowerState checks a Resource Graph power state that disagrees with the scheduler's last
+// action is read again from the instance view, rather than mistaken for a manual change
+func TestStalePowerState(t *testing.T) {
+	testCases := []struct {
+		name           string
+		historyRunning bool
+		discovered     PowerState
+		wantPowerState PowerState
+		wantRequests   int
+	}{
+		{
+			name:           "agrees with history",
+			historyRunning: false,
+			discovered:     PowerStateDeallocated,
+			wantPowerState: PowerStateDeallocated,
+		},
+		{
+			name:           "stale after stop",
+			historyRunning: false,
+			discovered:     PowerStateRunning,
+			wantPowerState: PowerStateDeallocated,
+			wantRequests:   1,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var requests int
+
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, `{"statuses": [{"code": "PowerState/deallocated"}]}`)
+			}
+
+			store, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			instance := Instance{
+				ID:            "/subscriptions/sub-1/resourceGroups/rg-1/virtualMachines/vm-1",
+				Name:          "vm-1",
+				ResourceGroup: "rg-1",
+				Tags: tagMap(map[string]string{
+					"AutoShutdownEnabled":    "true",
+					"AutoShutdownScheduleV2": `{"default": "09:00-17:00"}`,
+				}),
+				PowerState: test.discovered,
+			}
+
+			err = store.UpdateHistory(instance.ID, func(h *state.History) {
+				h.Running, h.LastAction = test.historyRunning, "stop"
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := fakeComputeClient(t, handler, Options{State: store, DryRun: true})
+
+			result := client.assessInstance(instance, client.Tags.LoadValues(instance.Tags))
+
+			if result.PowerState != test.wantPowerState.String() {
+				t.Errorf("got: %v, want: %v", result.PowerState, test.wantPowerState)
+			}
+
+			if requests != test.wantRequests {
+				t.Errorf("got: %v requests, want: %v", requests, test.wantRequests)
+			}
+
+			for _, step := range result.Trace.Steps {
+				if step.Name == "manual change" {
+					t.Errorf("got: %v, want no manual change", step.Detail)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TagMigration rewrites an instance's legacy scheduler tags to their current names and formats
+type TagMigration struct {
+	// Set are the tags to write under their current names
+	Set map[string]string `json:"set"`
+	// Remove are the legacy tag keys to delete
+	Remove []string `json:"remove"`
+}
+
+// Empty determines if the migration has nothing to change
+func (m TagMigration) Empty() bool {
+	return len(m.Set) == 0 && len(m.Remove) == 0
+}
+
+// Migrate plans the rewrite of an instance's scheduler tags. A tag found under an alias, or under
+// its current name in a different case, is moved to its current name, and values in a legacy
+// format are converted: `enabled` becomes `true` or `false`, and a schedule whose `default` is a
+// single element list becomes a string.
+func (t *Tags) Migrate(tags map[string]*string) TagMigration {
+	migration := TagMigration{Set: map[string]string{}}
+
+	for _, tag := range LogicalTags {
+		name := t.Name(tag)
+
+		key, value, ok := t.Lookup(tags, tag)
+		if !ok {
+			continue
+		}
+
+		migrated := migrateValue(tag, value)
+
+		if key != name || migrated != value {
+			migration.Set[name] = migrated
+		}
+
+		// Lower precedence names are ignored once the tag is found, so they are removed as well
+		for existing := range tags {
+			for _, alias := range t.Names(tag) {
+				if strings.EqualFold(existing, alias) && existing != name {
+					migration.Remove = append(migration.Remove, existing)
+				}
+			}
+		}
+	}
+
+	sort.Strings(migration.Remove)
+
+	return migration
+}
+
+// migrateValue converts a tag value from a legacy format to the current one, values already in the
+// current format, or that cannot be understood, are returned unchanged
+func migrateValue(tag, value string) string {
+	switch tag {
+	case TagEnabled:
+		if enabled, err := strconv.ParseBool(value); err == nil {
+			return strconv.FormatBool(enabled)
+		}
+	case TagSchedule:
+		var schedule map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(value), &schedule); err != nil {
+			return value
+		}
+
+		var windows []string
+		if err := json.Unmarshal(schedule["default"], &windows); err != nil || len(windows) != 1 {
+			return value
+		}
+
+		schedule["default"], _ = json.Marshal(windows[0])
+
+		data, err := json.Marshal(schedule)
+		if err != nil {
+			return value
+		}
+
+		return string(data)
+	}
+
+	return value
+}
@@ -0,0 +1,207 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"instancescheduler/internal/decision"
+	"instancescheduler/internal/report"
+	"instancescheduler/internal/state"
+	"instancescheduler/internal/telemetry"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// OperationMethodStart is a tracked `BeginStart` operation
+	OperationMethodStart = "start"
+	// OperationMethodPowerOff is a tracked `BeginPowerOff` operation
+	OperationMethodPowerOff = "poweroff"
+	// OperationMethodDeallocate is a tracked `BeginDeallocate` operation, with or without hibernation
+	OperationMethodDeallocate = "deallocate"
+)
+
+// instanceID returns the resource ID of an instance within the client's subscription
+func (c *ComputeClient) instanceID(resourceGroupName, instanceName string) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines/%s",
+		c.SubscriptionID, resourceGroupName, instanceName)
+}
+
+// TrackOperations checks on every operation issued by an earlier run within the client's
+// subscription. Finished operations are removed from the state, whether they succeeded or failed,
+// while those still running are left to be checked again on the next run. Nothing is checked for a
+// dry run, as finished operations would be removed from the state.
+func (c *ComputeClient) TrackOperations() []report.OperationResult {
+	var results []report.OperationResult
+
+	if c.options.State == nil || c.options.DryRun {
+		return nil
+	}
+
+	for _, operation := range c.options.State.PendingOperations(c.SubscriptionID) {
+		result := report.OperationResult{
+			SubscriptionID: operation.SubscriptionID,
+			ResourceGroup:  operation.ResourceGroup,
+			Instance:       operation.Instance,
+			Method:         operation.Method,
+			Status:         report.OperationInProgress,
+		}
+
+		done, err := c.pollOperation(operation)
+		if !done {
+			if err != nil {
+				log.Warn().Err(err).Str("instance", operation.Instance).Str("method", operation.Method).
+					Msg("Failed to check on operation, it will be checked again on the next run")
+			} else {
+				log.Info().Str("instance", operation.Instance).Str("method", operation.Method).
+					Time("startedAt", operation.StartedAt).Msg("Operation is still in progress")
+			}
+
+			results = append(results, result)
+			continue
+		}
+
+		if err != nil {
+			log.Error().Err(err).Str("instance", operation.Instance).Str("method", operation.Method).
+				Msg("Operation failed")
+			result.Status, result.Err = report.OperationFailed, err
+		} else {
+			log.Info().Str("instance", operation.Instance).Str("method", operation.Method).Msg("Operation succeeded")
+			result.Status = report.OperationSucceeded
+		}
+
+		c.publishOperation(operation, result.Err)
+
+		err = c.options.State.CompleteOperation(operation.InstanceID)
+		if err != nil {
+			log.Error().Err(err).Str("instance", operation.Instance).Msg("Failed to save state")
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// pollOperation resumes the poller for an operation and polls it once, returning whether it has
+// finished and, if so, its error. An operation that could not be polled has not finished, so that it
+// is checked again on the next run.
+func (c *ComputeClient) pollOperation(operation state.Operation) (bool, error) {
+	ctx, cancel := c.actionContext()
+	defer cancel()
+
+	switch operation.Method {
+	case OperationMethodStart:
+		poller, err := c.client.BeginStart(ctx, operation.ResourceGroup, operation.Instance,
+			&compute.VirtualMachinesClientBeginStartOptions{ResumeToken: operation.ResumeToken})
+		if err != nil {
+			return true, err
+		}
+
+		return pollOnce(ctx, poller)
+	case OperationMethodPowerOff:
+		poller, err := c.client.BeginPowerOff(ctx, operation.ResourceGroup, operation.Instance,
+			&compute.VirtualMachinesClientBeginPowerOffOptions{ResumeToken: operation.ResumeToken})
+		if err != nil {
+			return true, err
+		}
+
+		return pollOnce(ctx, poller)
+	case OperationMethodDeallocate:
+		poller, err := c.client.BeginDeallocate(ctx, operation.ResourceGroup, operation.Instance,
+			&compute.VirtualMachinesClientBeginDeallocateOptions{ResumeToken: operation.ResumeToken})
+		if err != nil {
+			return true, err
+		}
+
+		return pollOnce(ctx, poller)
+	default:
+		return true, fmt.Errorf("unknown operation method '%s'", operation.Method)
+	}
+}
+
+// pollOnce polls an operation once. A failure to poll, such as a network error or throttling, is
+// returned without the operation having finished, only the operation's own failure finishes it.
+func pollOnce[T any](ctx context.Context, poller *runtime.Poller[T]) (bool, error) {
+	if !poller.Done() {
+		_, err := poller.Poll(ctx)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if !poller.Done() {
+		return false, nil
+	}
+
+	_, err := poller.Result(ctx)
+
+	return true, err
+}
+
+// tracksOperations returns whether operations are left for a later run to check on, rather than
+// waited for
+func (c *ComputeClient) tracksOperations() bool {
+	return c.options.NoWait && c.options.State != nil
+}
+
+// describeOperation adds the instance's tags and the reason it was actioned to its tracked
+// operation, so that the events published once the operation finishes can describe it
+func (c *ComputeClient) describeOperation(instance Instance, d decision.Decision) {
+	operation, ok := c.options.State.Operation(instance.ID)
+	if !ok {
+		return
+	}
+
+	operation.Tags, operation.Reason = eventData(instance).Tags, string(d.Reason)
+
+	if err := c.options.State.TrackOperation(operation); err != nil {
+		log.Error().Err(err).Str("instance", instance.Name).Msg("Failed to save state")
+	}
+}
+
+// waitOrTrack either waits for an operation to finish or, when the client does not wait, saves its
+// resume token so that a later run can check on it
+func waitOrTrack[T any](c *ComputeClient, ctx context.Context, poller *runtime.Poller[T], method string,
+	resourceGroupName, instanceName string) error {
+	if !c.tracksOperations() {
+		start := time.Now()
+		ctx, span := telemetry.Start(ctx, "poll", telemetry.AttributeMethod.String(method))
+
+		_, err := poller.PollUntilDone(ctx, nil)
+		c.options.Metrics.ObserveActionDuration(method, time.Since(start))
+		telemetry.End(span, err)
+
+		return err
+	}
+
+	token, err := poller.ResumeToken()
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("instance", instanceName).Str("method", method).Msg("Tracking operation for a later run")
+
+	return c.options.State.TrackOperation(state.Operation{
+		InstanceID:     c.instanceID(resourceGroupName, instanceName),
+		SubscriptionID: c.SubscriptionID,
+		ResourceGroup:  resourceGroupName,
+		Instance:       instanceName,
+		Method:         method,
+		ResumeToken:    token,
+		StartedAt:      time.Now().UTC(),
+	})
+}
@@ -0,0 +1,91 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+)
+
+// TestPollOnce checks an operation only finishes when Azure reports its outcome, a failure to poll
+// leaves it to be checked again
+func TestPollOnce(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   int
+		body     string
+		wantDone bool
+		wantErr  bool
+	}{
+		{name: "in progress", status: http.StatusOK, body: `{"status": "InProgress"}`},
+		{name: "succeeded", status: http.StatusOK, body: `{"status": "Succeeded"}`, wantDone: true},
+		{
+			name:     "failed",
+			status:   http.StatusOK,
+			body:     `{"status": "Failed", "error": {"code": "InternalExecutionError", "message": "failed"}}`,
+			wantDone: true,
+			wantErr:  true,
+		},
+		{
+			name:    "throttled",
+			status:  http.StatusTooManyRequests,
+			body:    `{"error": {"code": "TooManyRequests", "message": "throttled"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "server error",
+			status:  http.StatusInternalServerError,
+			body:    `{"error": {"code": "InternalServerError", "message": "unavailable"}}`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+
+				if r.Method == http.MethodPost {
+					w.Header().Set("Azure-AsyncOperation", fmt.Sprintf("https://%s/operations/start", r.URL.Host))
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+
+				w.WriteHeader(test.status)
+				fmt.Fprint(w, test.body)
+			}
+
+			client, err := compute.NewVirtualMachinesClient("sub-1", fakeCredential{}, fakeClientOptions(handler))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			poller, err := client.BeginStart(context.Background(), "rg-1", "vm-1", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			done, err := pollOnce(context.Background(), poller)
+
+			if done != test.wantDone {
+				t.Errorf("got: %v, want: %v", done, test.wantDone)
+			}
+
+			if (err != nil) != test.wantErr {
+				t.Errorf("got: %v, want error: %v", err, test.wantErr)
+			}
+		})
+	}
+}
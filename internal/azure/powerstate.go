@@ -45,6 +45,11 @@ func (p PowerState) String() string {
 	}
 }
 
+// IsRunning determines if the power state is running, or is on its way to running
+func (p PowerState) IsRunning() bool {
+	return p == PowerStateRunning || p == PowerStateStarting
+}
+
 func ParsePowerState(data string) PowerState {
 	if strings.Contains(data, PowerStateDeallocated.String()) {
 		return PowerStateDeallocated
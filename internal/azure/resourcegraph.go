@@ -0,0 +1,160 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
+	"github.com/rs/zerolog/log"
+)
+
+// resourceGraphSubscriptionLimit is the maximum number of subscriptions that a single Resource
+// Graph query accepts
+const resourceGraphSubscriptionLimit = 1000
+
+// resourceGraphPageSize is the maximum number of rows Resource Graph returns per page
+const resourceGraphPageSize = 1000
+
+type resourceGraphRow struct {
+	ID             string             `json:"id"`
+	Name           string             `json:"name"`
+	ResourceGroup  string             `json:"resourceGroup"`
+	SubscriptionID string             `json:"subscriptionId"`
+	Tags           map[string]*string `json:"tags"`
+	Location       string             `json:"location"`
+	Size           string             `json:"vmSize"`
+	PowerState     string             `json:"powerState"`
+	Hibernation    *bool              `json:"hibernationEnabled"`
+}
+
+// DiscoverInstances uses a single Resource Graph query, such as `Tags.ResourceGraphQuery`, to find
+// instances across the given subscriptions, along with their tags and power state. The instances
+// are returned grouped by subscription ID. The query is retried and instrumented as the compute
+// client's calls are, according to `options`.
+func DiscoverInstances(ctx context.Context, credential azcore.TokenCredential, subscriptionIDs []string,
+	query string, options *Options) (map[string][]Instance, error) {
+	var opts Options
+	if options != nil {
+		opts = *options
+	}
+
+	return discoverInstances(ctx, credential, subscriptionIDs, query, opts.Retry, opts.clientOptions())
+}
+
+func discoverInstances(ctx context.Context, credential azcore.TokenCredential, subscriptionIDs []string,
+	query string, retryOptions RetryOptions, options *arm.ClientOptions) (map[string][]Instance, error) {
+	instances := make(map[string][]Instance)
+
+	client, err := armresourcegraph.NewClient(credential, options)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug().Str("query", query).Msg("Resource Graph discovery query")
+
+	for start := 0; start < len(subscriptionIDs); start += resourceGraphSubscriptionLimit {
+		end := min(start+resourceGraphSubscriptionLimit, len(subscriptionIDs))
+
+		rows, err := queryResourceGraph(ctx, client, retryOptions, query, subscriptionIDs[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range rows {
+			subscriptionID := strings.ToLower(row.SubscriptionID)
+			instances[subscriptionID] = append(instances[subscriptionID], row.instance())
+		}
+	}
+
+	return instances, nil
+}
+
+// instance converts a row to an instance. The power state is left empty when the row has none, or
+// one that is not recognised, so that it is read from the instance view instead.
+func (row resourceGraphRow) instance() Instance {
+	instance := Instance{
+		ID:             row.ID,
+		Name:           row.Name,
+		ResourceGroup:  row.ResourceGroup,
+		SubscriptionID: row.SubscriptionID,
+		Tags:           row.Tags,
+		Location:       row.Location,
+		Size:           row.Size,
+	}
+
+	if row.Hibernation != nil {
+		instance.HibernationEnabled = *row.Hibernation
+	}
+
+	if powerState := ParsePowerState(row.PowerState); powerState != PowerStateUnknown {
+		instance.PowerState = powerState
+	}
+
+	return instance
+}
+
+// queryResourceGraph runs the query against the subscriptions, following skip tokens until every
+// page has been read
+func queryResourceGraph(ctx context.Context, client *armresourcegraph.Client, retryOptions RetryOptions,
+	query string, subscriptionIDs []string) ([]resourceGraphRow, error) {
+	var rows []resourceGraphRow
+	var skipToken *string
+
+	for {
+		request := armresourcegraph.QueryRequest{
+			Query:         to.Ptr(query),
+			Subscriptions: to.SliceOfPtrs(subscriptionIDs...),
+			Options: &armresourcegraph.QueryRequestOptions{
+				ResultFormat: to.Ptr(armresourcegraph.ResultFormatObjectArray),
+				SkipToken:    skipToken,
+				Top:          to.Ptr(int32(resourceGraphPageSize)),
+			},
+		}
+
+		var response armresourcegraph.ClientResourcesResponse
+
+		err := retry(ctx, retryOptions, "resource graph query", func() error {
+			var err error
+			response, err = client.Resources(ctx, request, nil)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := json.Marshal(response.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []resourceGraphRow
+		if err := json.Unmarshal(data, &page); err != nil {
+			return nil, fmt.Errorf("unable to decode resource graph response: %w", err)
+		}
+
+		rows = append(rows, page...)
+
+		if response.SkipToken == nil || *response.SkipToken == "" {
+			break
+		}
+
+		skipToken = response.SkipToken
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,144 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestResourceGraphRowInstance checks a row without a recognised power state leaves it empty, so
+// that it is read from the instance view rather than treated as stopped
+func TestResourceGraphRowInstance(t *testing.T) {
+	testCases := []struct {
+		name            string
+		row             string
+		wantPowerState  PowerState
+		wantHibernation bool
+	}{
+		{
+			name:           "running",
+			row:            `{"name": "vm-1", "powerState": "PowerState/running"}`,
+			wantPowerState: PowerStateRunning,
+		},
+		{
+			name:           "deallocated",
+			row:            `{"name": "vm-1", "powerState": "PowerState/deallocated"}`,
+			wantPowerState: PowerStateDeallocated,
+		},
+		{
+			name:           "no power state",
+			row:            `{"name": "vm-1"}`,
+			wantPowerState: "",
+		},
+		{
+			name:           "empty power state",
+			row:            `{"name": "vm-1", "powerState": ""}`,
+			wantPowerState: "",
+		},
+		{
+			name:           "unrecognised power state",
+			row:            `{"name": "vm-1", "powerState": "PowerState/updating"}`,
+			wantPowerState: "",
+		},
+		{
+			name:            "hibernation enabled",
+			row:             `{"name": "vm-1", "powerState": "PowerState/running", "hibernationEnabled": true}`,
+			wantPowerState:  PowerStateRunning,
+			wantHibernation: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var row resourceGraphRow
+			if err := json.Unmarshal([]byte(test.row), &row); err != nil {
+				t.Fatal(err)
+			}
+
+			got := row.instance()
+
+			if got.PowerState != test.wantPowerState {
+				t.Errorf("got: %v, want: %v", got.PowerState, test.wantPowerState)
+			}
+
+			if got.HibernationEnabled != test.wantHibernation {
+				t.Errorf("got: %v, want: %v", got.HibernationEnabled, test.wantHibernation)
+			}
+		})
+	}
+}
+
+// TestDiscoverInstances checks every page is read and grouped by subscription, with the requests
+// made through the client options given, so that a server error is retried by their pipeline
+func TestDiscoverInstances(t *testing.T) {
+	var requests int
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Options struct {
+				SkipToken string `json:"$skipToken"`
+			} `json:"options"`
+		}
+
+		requests++
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("unable to decode query: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case requests == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"error": {"code": "ServiceUnavailable", "message": "unavailable"}}`)
+		case body.Options.SkipToken == "":
+			fmt.Fprint(w, `{"data": [{"name": "vm-1", "subscriptionId": "SUB-1"}], "$skipToken": "page-2"}`)
+		default:
+			fmt.Fprint(w, `{"data": [{"name": "vm-2", "subscriptionId": "sub-1"}, `+
+				`{"name": "vm-3", "subscriptionId": "sub-2"}]}`)
+		}
+	}
+
+	options := fakeClientOptions(handler)
+	options.Retry.MaxRetries, options.Retry.RetryDelay = 1, time.Millisecond
+
+	instances, err := discoverInstances(context.Background(), fakeCredential{}, []string{"sub-1", "sub-2"}, "query",
+		RetryOptions{}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 3 {
+		t.Errorf("got: %v, want: %v", requests, 3)
+	}
+
+	testCases := []struct {
+		subscriptionID string
+		want           int
+	}{
+		{subscriptionID: "sub-1", want: 2},
+		{subscriptionID: "sub-2", want: 1},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.subscriptionID, func(t *testing.T) {
+			if got := len(instances[test.subscriptionID]); got != test.want {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/rs/zerolog/log"
+)
+
+// RetryOptions controls how failed Azure Resource Manager calls are retried. Throttled requests and
+// server errors are retried by the clients' pipeline, conflicts with an operation in progress by
+// `retry`, both with these options.
+type RetryOptions struct {
+	// MaxAttempts is the total number of attempts, including the first. Values below one are
+	// treated as a single attempt.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubling for each retry after that
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts
+	MaxDelay time.Duration
+}
+
+// DefaultRetryOptions are the retry options used by the CLI, with `-max-attempts` in place of
+// `MaxAttempts` when it is given
+var DefaultRetryOptions = RetryOptions{
+	MaxAttempts: 5,
+	BaseDelay:   2 * time.Second,
+	MaxDelay:    time.Minute,
+}
+
+// retry calls `fn` until it succeeds, returns an error that is not retryable, or the attempts run
+// out. Throttling and server errors are not retried here, as the pipeline has already retried them.
+// The delay between attempts is exponential with full jitter, but never shorter than the
+// `Retry-After` returned by the service.
+func retry(ctx context.Context, options RetryOptions, operation string, fn func() error) error {
+	var err *Error
+
+	attempts := max(options.MaxAttempts, 1)
+
+	for attempt := 1; ; attempt++ {
+		callErr := fn()
+		if callErr == nil {
+			return nil
+		}
+
+		err = newError(operation, callErr)
+
+		if !err.Retryable() || attempt >= attempts {
+			return err
+		}
+
+		delay := backoff(options, attempt, err.RetryAfter)
+
+		log.Warn().Err(err).Str("operation", operation).Int("attempt", attempt).Dur("delay", delay).
+			Msg("Retrying Azure call")
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return newError(operation, ctx.Err())
+		}
+	}
+}
+
+// backoff returns the delay before the next attempt
+func backoff(options RetryOptions, attempt int, retryAfter time.Duration) time.Duration {
+	delay := options.BaseDelay << (attempt - 1)
+	if delay <= 0 || (options.MaxDelay > 0 && delay > options.MaxDelay) {
+		delay = options.MaxDelay
+	}
+
+	if delay > 0 {
+		delay = time.Duration(rand.Int63n(int64(delay) + 1))
+	}
+
+	return max(delay, retryAfter)
+}
+
+// pipelineRetryOptions returns the pipeline's retry policy for the options, which retries throttled
+// requests and server errors while honouring `Retry-After`
+func pipelineRetryOptions(options RetryOptions) policy.RetryOptions {
+	retries := int32(options.MaxAttempts - 1)
+	if retries <= 0 {
+		// zero would use the SDK's default number of retries
+		retries = -1
+	}
+
+	return policy.RetryOptions{
+		MaxRetries:    retries,
+		RetryDelay:    options.BaseDelay,
+		MaxRetryDelay: options.MaxDelay,
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+func responseError(statusCode int, code, retryAfter string) error {
+	header := http.Header{}
+	if retryAfter != "" {
+		header.Set("Retry-After", retryAfter)
+	}
+
+	return &azcore.ResponseError{
+		ErrorCode:   code,
+		StatusCode:  statusCode,
+		RawResponse: &http.Response{StatusCode: statusCode, Header: header},
+	}
+}
+
+func TestRetry(t *testing.T) {
+	testCases := []struct {
+		name      string
+		err       error
+		wantCalls int
+		wantKind  ErrorKind
+	}{
+		{
+			name:      "throttled",
+			err:       responseError(http.StatusTooManyRequests, "TooManyRequests", "0"),
+			wantCalls: 1,
+			wantKind:  ErrorKindThrottled,
+		},
+		{
+			name:      "server_error",
+			err:       responseError(http.StatusServiceUnavailable, "ServiceUnavailable", ""),
+			wantCalls: 1,
+			wantKind:  ErrorKindServer,
+		},
+		{
+			name:      "conflict_in_progress",
+			err:       responseError(http.StatusConflict, "AnotherOperationInProgress", ""),
+			wantCalls: 3,
+			wantKind:  ErrorKindConflict,
+		},
+		{
+			name:      "conflict_preempted",
+			err:       responseError(http.StatusConflict, "operationpreempted", ""),
+			wantCalls: 3,
+			wantKind:  ErrorKindConflict,
+		},
+		{
+			name:      "conflict_not_allowed",
+			err:       responseError(http.StatusConflict, "OperationNotAllowed", ""),
+			wantCalls: 1,
+			wantKind:  ErrorKindConflict,
+		},
+		{
+			name:      "conflict_without_code",
+			err:       responseError(http.StatusConflict, "", ""),
+			wantCalls: 1,
+			wantKind:  ErrorKindConflict,
+		},
+		{
+			name:      "not_found",
+			err:       responseError(http.StatusNotFound, "NotFound", ""),
+			wantCalls: 1,
+			wantKind:  ErrorKindNotFound,
+		},
+		{
+			name:      "other",
+			err:       errors.New("boom"),
+			wantCalls: 1,
+			wantKind:  ErrorKindOther,
+		},
+	}
+
+	options := RetryOptions{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var calls int
+
+			err := retry(context.Background(), options, "test", func() error {
+				calls++
+				return test.err
+			})
+
+			var azureErr *Error
+			if !errors.As(err, &azureErr) {
+				t.Fatalf("got: %v, want an *Error", err)
+			}
+
+			if azureErr.Kind != test.wantKind {
+				t.Errorf("got kind: %s, want: %s", azureErr.Kind, test.wantKind)
+			}
+
+			if calls != test.wantCalls {
+				t.Errorf("got calls: %d, want: %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestBackoffHonoursRetryAfter(t *testing.T) {
+	options := RetryOptions{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second}
+
+	got := backoff(options, 1, parseRetryAfter("30"))
+
+	if got != 30*time.Second {
+		t.Errorf("got: %s, want: %s", got, 30*time.Second)
+	}
+}
+
+// TestPipelineRetryOptions checks the pipeline retries as many times as the retry options allow, and
+// not at all for a single attempt rather than the SDK's default
+func TestPipelineRetryOptions(t *testing.T) {
+	testCases := []struct {
+		name        string
+		maxAttempts int
+		want        int32
+	}{
+		{name: "default", maxAttempts: DefaultRetryOptions.MaxAttempts, want: 4},
+		{name: "single_attempt", maxAttempts: 1, want: -1},
+		{name: "zero", maxAttempts: 0, want: -1},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			options := RetryOptions{MaxAttempts: test.maxAttempts, BaseDelay: time.Second, MaxDelay: time.Minute}
+
+			got := pipelineRetryOptions(options)
+
+			if got.MaxRetries != test.want {
+				t.Errorf("got: %v, want: %v", got.MaxRetries, test.want)
+			}
+
+			if got.RetryDelay != time.Second || got.MaxRetryDelay != time.Minute {
+				t.Errorf("got: %v and %v, want: %v and %v", got.RetryDelay, got.MaxRetryDelay, time.Second, time.Minute)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/managementgroups/armmanagementgroups"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
+	"github.com/rs/zerolog/log"
+)
+
+const managementGroupSubscriptionType = "/subscriptions"
+
+// Scope describes which subscriptions a run should cover. Exactly one of the fields is expected to
+// be set; `SubscriptionIDs` takes precedence, followed by `ManagementGroupID` and then
+// `AllSubscriptions`.
+type Scope struct {
+	SubscriptionIDs   []string
+	ManagementGroupID string
+	AllSubscriptions  bool
+}
+
+// ParseSubscriptionIDs splits a comma separated list of subscription IDs, dropping any empty
+// entries and duplicates
+func ParseSubscriptionIDs(data string) []string {
+	var subscriptionIDs []string
+	seen := make(map[string]bool)
+
+	for _, id := range strings.Split(data, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[strings.ToLower(id)] {
+			continue
+		}
+
+		seen[strings.ToLower(id)] = true
+		subscriptionIDs = append(subscriptionIDs, id)
+	}
+
+	return subscriptionIDs
+}
+
+// Resolve returns the list of subscription IDs covered by the scope
+func (s Scope) Resolve(ctx context.Context, credential azcore.TokenCredential) ([]string, error) {
+	return s.resolve(ctx, credential, nil)
+}
+
+func (s Scope) resolve(ctx context.Context, credential azcore.TokenCredential,
+	options *arm.ClientOptions) ([]string, error) {
+	switch {
+	case len(s.SubscriptionIDs) > 0:
+		return s.SubscriptionIDs, nil
+	case s.ManagementGroupID != "":
+		return listManagementGroupSubscriptions(ctx, credential, options, s.ManagementGroupID)
+	case s.AllSubscriptions:
+		return listAllSubscriptions(ctx, credential, options)
+	default:
+		return nil, errors.New("no subscriptions, management group or all subscriptions scope provided")
+	}
+}
+
+// listManagementGroupSubscriptions returns every subscription beneath a management group, including
+// those that belong to nested management groups
+func listManagementGroupSubscriptions(ctx context.Context, credential azcore.TokenCredential,
+	options *arm.ClientOptions, groupID string) ([]string, error) {
+	var subscriptionIDs []string
+
+	client, err := armmanagementgroups.NewClient(credential, options)
+	if err != nil {
+		return nil, err
+	}
+
+	pager := client.NewGetDescendantsPager(groupID, nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, descendant := range page.Value {
+			if descendant.Type == nil || descendant.Name == nil {
+				continue
+			}
+
+			if strings.EqualFold(*descendant.Type, managementGroupSubscriptionType) {
+				subscriptionIDs = append(subscriptionIDs, *descendant.Name)
+			}
+		}
+	}
+
+	log.Debug().Str("managementGroup", groupID).Int("subscriptions", len(subscriptionIDs)).
+		Msg("Resolved management group subscriptions")
+
+	return subscriptionIDs, nil
+}
+
+// listAllSubscriptions returns every enabled subscription that the credential has access to
+func listAllSubscriptions(ctx context.Context, credential azcore.TokenCredential,
+	options *arm.ClientOptions) ([]string, error) {
+	var subscriptionIDs []string
+
+	client, err := armsubscriptions.NewClient(credential, options)
+	if err != nil {
+		return nil, err
+	}
+
+	pager := client.NewListPager(nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, subscription := range page.Value {
+			if subscription.SubscriptionID == nil {
+				continue
+			}
+
+			if subscription.State != nil && *subscription.State != armsubscriptions.SubscriptionStateEnabled {
+				log.Debug().Str("subscription", *subscription.SubscriptionID).
+					Str("state", string(*subscription.State)).Msg("Skipping subscription that is not enabled")
+				continue
+			}
+
+			subscriptionIDs = append(subscriptionIDs, *subscription.SubscriptionID)
+		}
+	}
+
+	log.Debug().Int("subscriptions", len(subscriptionIDs)).Msg("Resolved visible subscriptions")
+
+	return subscriptionIDs, nil
+}
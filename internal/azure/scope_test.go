@@ -0,0 +1,132 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseSubscriptionIDs checks the list is trimmed and empty entries and duplicates are dropped
+func TestParseSubscriptionIDs(t *testing.T) {
+	testCases := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{name: "empty", data: "", want: nil},
+		{name: "single", data: "sub-1", want: []string{"sub-1"}},
+		{name: "list", data: "sub-1,sub-2", want: []string{"sub-1", "sub-2"}},
+		{name: "whitespace and empty entries", data: " sub-1 ,, sub-2 ,", want: []string{"sub-1", "sub-2"}},
+		{name: "duplicates in different case", data: "SUB-1,sub-2,sub-1", want: []string{"SUB-1", "sub-2"}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			got := ParseSubscriptionIDs(test.data)
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestResolve checks which subscriptions each kind of scope covers, following every page of the
+// management group and subscription listings
+func TestResolve(t *testing.T) {
+	var requests []string
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/managementGroups/mg-root/descendants") && r.URL.Query().Get("page") == "":
+			fmt.Fprintf(w, `{"value": [
+				{"type": "/subscriptions", "name": "sub-1"},
+				{"type": "Microsoft.Management/managementGroups", "name": "mg-child"}
+			], "nextLink": "https://%s%s?page=2"}`, r.URL.Host, r.URL.Path)
+		case strings.HasSuffix(r.URL.Path, "/managementGroups/mg-root/descendants"):
+			fmt.Fprint(w, `{"value": [{"type": "/subscriptions", "name": "sub-2"}]}`)
+		case r.URL.Path == "/subscriptions":
+			fmt.Fprint(w, `{"value": [
+				{"subscriptionId": "sub-1", "state": "Enabled"},
+				{"subscriptionId": "sub-2", "state": "Disabled"},
+				{"subscriptionId": "sub-3"}
+			]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error": {"code": "NotFound", "message": "not found"}}`)
+		}
+	}
+
+	testCases := []struct {
+		name         string
+		scope        Scope
+		want         []string
+		wantErr      bool
+		wantRequests int
+	}{
+		{
+			name:  "subscriptions take precedence",
+			scope: Scope{SubscriptionIDs: []string{"sub-9"}, ManagementGroupID: "mg-root", AllSubscriptions: true},
+			want:  []string{"sub-9"},
+		},
+		{
+			name:         "management group including nested groups",
+			scope:        Scope{ManagementGroupID: "mg-root", AllSubscriptions: true},
+			want:         []string{"sub-1", "sub-2"},
+			wantRequests: 2,
+		},
+		{
+			name:         "all enabled subscriptions",
+			scope:        Scope{AllSubscriptions: true},
+			want:         []string{"sub-1", "sub-3"},
+			wantRequests: 1,
+		},
+		{
+			name:         "unknown management group",
+			scope:        Scope{ManagementGroupID: "mg-missing"},
+			wantErr:      true,
+			wantRequests: 1,
+		},
+		{
+			name:    "empty",
+			scope:   Scope{},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			requests = nil
+
+			got, err := test.scope.resolve(context.Background(), fakeCredential{}, fakeClientOptions(handler))
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got: %v, want error: %v", err, test.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+
+			if len(requests) != test.wantRequests {
+				t.Errorf("got: %v requests, want: %v", requests, test.wantRequests)
+			}
+		})
+	}
+}
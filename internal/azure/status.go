@@ -0,0 +1,130 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"time"
+
+	"instancescheduler/internal/report"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxTagValueLength is the longest value Azure accepts for a tag on a resource
+const maxTagValueLength = 256
+
+// StatusTags are the names of the tags the scheduler writes its status to
+type StatusTags struct {
+	// LastAction is the last start or stop the scheduler took, or `error` when the last run failed
+	LastAction string `yaml:"lastAction"`
+	// LastRun is when the last action was taken
+	LastRun string `yaml:"lastRun"`
+	// NextAction is the action the instance needs at its next transition, and when
+	NextAction string `yaml:"nextAction"`
+	// Error summarises why the instance could not be assessed, it is removed once it can be
+	Error string `yaml:"error"`
+}
+
+// DefaultStatusTags are the status tag names used when the tags config does not set them
+var DefaultStatusTags = StatusTags{
+	LastAction: "InstanceSchedulerLastAction",
+	LastRun:    "InstanceSchedulerLastRun",
+	NextAction: "InstanceSchedulerNextAction",
+	Error:      "InstanceSchedulerError",
+}
+
+// StatusNames returns the status tag names, using the defaults for any that are not configured
+func (t *Tags) StatusNames() StatusTags {
+	names := t.Status
+
+	for _, name := range []struct {
+		value    *string
+		fallback string
+	}{
+		{value: &names.LastAction, fallback: DefaultStatusTags.LastAction},
+		{value: &names.LastRun, fallback: DefaultStatusTags.LastRun},
+		{value: &names.NextAction, fallback: DefaultStatusTags.NextAction},
+		{value: &names.Error, fallback: DefaultStatusTags.Error},
+	} {
+		if *name.value == "" {
+			*name.value = name.fallback
+		}
+	}
+
+	return names
+}
+
+// statusTagChanges returns the status tags to merge into, and remove from, an instance's existing
+// tags to reflect `result`. Tags that already hold the right value are left out so that unchanged
+// instances are not written to.
+func statusTagChanges(names StatusTags, existing map[string]*string, result report.Result,
+	now time.Time) (map[string]*string, map[string]*string) {
+	merge := make(map[string]*string)
+	remove := make(map[string]*string)
+
+	set := func(name, value string) {
+		if len(value) > maxTagValueLength {
+			value = value[:maxTagValueLength]
+		}
+
+		if key, current, ok := LookupTag(existing, name); ok && key == name && current == value {
+			return
+		}
+
+		merge[name] = &value
+	}
+
+	switch result.Action {
+	case report.ActionStart, report.ActionStop:
+		set(names.LastAction, string(result.Action))
+		set(names.LastRun, now.UTC().Format(time.RFC3339))
+	case report.ActionError:
+		set(names.LastAction, string(result.Action))
+	}
+
+	nextAction := string(report.ActionNone)
+	if !result.NextTransition.IsZero() {
+		nextAction = string(result.NextAction) + " at " + result.NextTransition.Format(time.RFC3339)
+	}
+
+	set(names.NextAction, nextAction)
+
+	if result.Err != nil {
+		set(names.Error, result.Err.Error())
+	} else if key, current, ok := LookupTag(existing, names.Error); ok {
+		remove[key] = &current
+	}
+
+	return merge, remove
+}
+
+// writeStatus writes the outcome of assessing an instance to its status tags, when enabled. Only
+// tags whose values have changed are written, and a failure to write them is logged rather than
+// failing the instance.
+func (c *ComputeClient) writeStatus(instance Instance, result report.Result) {
+	if !c.options.StatusTags || c.options.DryRun || result.Action == report.ActionInProgress {
+		return
+	}
+
+	merge, remove := statusTagChanges(c.Tags.StatusNames(), instance.Tags, result, time.Now())
+
+	if len(merge) > 0 {
+		if err := c.MergeTags(instance, merge); err != nil {
+			log.Error().Err(err).Str("instance", instance.Name).Msg("Failed to write status tags")
+		}
+	}
+
+	if len(remove) > 0 {
+		if err := c.DeleteTags(instance, remove); err != nil {
+			log.Error().Err(err).Str("instance", instance.Name).Msg("Failed to remove status tags")
+		}
+	}
+}
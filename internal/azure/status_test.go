@@ -0,0 +1,75 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"instancescheduler/internal/report"
+)
+
+// TestStatusTagChanges checks only the status tags whose values change are written
+func TestStatusTagChanges(t *testing.T) {
+	now := time.Date(2026, time.October, 19, 6, 0, 0, 0, time.UTC)
+	next := time.Date(2026, time.October, 19, 17, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name       string
+		existing   map[string]string
+		result     report.Result
+		wantMerge  map[string]string
+		wantRemove map[string]string
+	}{
+		{
+			name:   "stopped",
+			result: report.Result{Action: report.ActionStop, NextAction: report.ActionStart, NextTransition: next},
+			wantMerge: map[string]string{
+				"InstanceSchedulerLastAction": "stop",
+				"InstanceSchedulerLastRun":    "2026-10-19T06:00:00Z",
+				"InstanceSchedulerNextAction": "start at 2026-10-19T17:00:00Z",
+			},
+		},
+		{
+			name:     "unchanged",
+			existing: map[string]string{"InstanceSchedulerNextAction": "start at 2026-10-19T17:00:00Z"},
+			result:   report.Result{Action: report.ActionNone, NextAction: report.ActionStart, NextTransition: next},
+		},
+		{
+			name:      "error",
+			existing:  map[string]string{"InstanceSchedulerNextAction": "none"},
+			result:    report.Result{Action: report.ActionError, Err: errors.New("invalid schedule")},
+			wantMerge: map[string]string{"InstanceSchedulerLastAction": "error", "InstanceSchedulerError": "invalid schedule"},
+		},
+		{
+			name:       "error cleared",
+			existing:   map[string]string{"InstanceSchedulerNextAction": "none", "instanceschedulererror": "invalid schedule"},
+			result:     report.Result{Action: report.ActionNone},
+			wantRemove: map[string]string{"instanceschedulererror": "invalid schedule"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			merge, remove := statusTagChanges(DefaultStatusTags, tagMap(test.existing), test.result, now)
+
+			if !reflect.DeepEqual(merge, tagMap(test.wantMerge)) {
+				t.Errorf("got: %v, want: %v", merge, test.wantMerge)
+			}
+
+			if !reflect.DeepEqual(remove, tagMap(test.wantRemove)) {
+				t.Errorf("got: %v, want: %v", remove, test.wantRemove)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StopMode is how an instance is stopped outside of its schedule
+type StopMode string
+
+const (
+	// StopModeDeallocate releases the instance's compute so that it is no longer billed
+	StopModeDeallocate StopMode = "deallocate"
+	// StopModePowerOff stops the operating system but keeps the compute allocated, and billed
+	StopModePowerOff StopMode = "poweroff"
+	// StopModeHibernate hibernates and deallocates the instance, it falls back to
+	// `StopModeDeallocate` for instances without hibernation enabled
+	StopModeHibernate StopMode = "hibernate"
+)
+
+func (s StopMode) String() string {
+	return string(s)
+}
+
+// ParseStopMode parses a stop mode from a tag or config value
+func ParseStopMode(data string) (StopMode, error) {
+	switch strings.ToLower(strings.TrimSpace(data)) {
+	case "deallocate":
+		return StopModeDeallocate, nil
+	case "poweroff", "power-off":
+		return StopModePowerOff, nil
+	case "hibernate":
+		return StopModeHibernate, nil
+	default:
+		return "", fmt.Errorf("invalid stop mode '%s', expected one of deallocate, poweroff or hibernate", data)
+	}
+}
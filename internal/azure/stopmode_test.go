@@ -0,0 +1,84 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import "testing"
+
+// TestParseStopMode checks each stop mode is parsed regardless of case and surrounding whitespace
+func TestParseStopMode(t *testing.T) {
+	testCases := []struct {
+		name    string
+		data    string
+		want    StopMode
+		wantErr bool
+	}{
+		{name: "deallocate", data: "deallocate", want: StopModeDeallocate},
+		{name: "poweroff", data: "poweroff", want: StopModePowerOff},
+		{name: "power-off", data: "power-off", want: StopModePowerOff},
+		{name: "hibernate", data: "hibernate", want: StopModeHibernate},
+		{name: "mixed case", data: "PowerOff", want: StopModePowerOff},
+		{name: "whitespace", data: " Deallocate ", want: StopModeDeallocate},
+		{name: "invalid", data: "shutdown", wantErr: true},
+		{name: "empty", data: "", wantErr: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseStopMode(test.data)
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got: %v, want error: %v", err, test.wantErr)
+			}
+
+			if got != test.want {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestStopMode checks the tag takes precedence over the client's stop mode, and hibernation falls
+// back to deallocating an instance that does not support it
+func TestStopMode(t *testing.T) {
+	testCases := []struct {
+		name        string
+		defaultMode StopMode
+		tag         string
+		hibernation bool
+		want        StopMode
+		wantErr     bool
+	}{
+		{name: "unset", want: StopModeDeallocate},
+		{name: "client default", defaultMode: StopModePowerOff, want: StopModePowerOff},
+		{name: "tag", defaultMode: StopModePowerOff, tag: "Deallocate", want: StopModeDeallocate},
+		{name: "hibernate supported", tag: "hibernate", hibernation: true, want: StopModeHibernate},
+		{name: "hibernate not supported", tag: "hibernate", want: StopModeDeallocate},
+		{name: "client hibernate not supported", defaultMode: StopModeHibernate, want: StopModeDeallocate},
+		{name: "invalid tag", defaultMode: StopModePowerOff, tag: "sleep", wantErr: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			client := &ComputeClient{options: Options{StopMode: test.defaultMode}}
+			instance := Instance{Name: "vm-1", HibernationEnabled: test.hibernation}
+
+			got, err := client.stopMode(instance, TagValues{StopMode: test.tag})
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got: %v, want error: %v", err, test.wantErr)
+			}
+
+			if got != test.want {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
@@ -11,17 +11,63 @@ https://polyformproject.org/licenses/internal-use/1.0.0/
 package azure
 
 import (
+	"fmt"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 	yaml "gopkg.in/yaml.v3"
 )
 
+// Logical names of the scheduler's tags, as used to key `aliases` in the tags config
+const (
+	TagEnabled       = "enabled"
+	TagSchedule      = "schedule"
+	TagPatchWindow   = "patchWindow"
+	TagStopMode      = "stopMode"
+	TagOverrideUntil = "overrideUntil"
+	TagManualChanges = "manualChanges"
+	TagSnoozeUntil   = "snoozeUntil"
+)
+
+// LogicalTags are the logical names of every tag the scheduler reads
+var LogicalTags = []string{
+	TagEnabled, TagSchedule, TagPatchWindow, TagStopMode, TagOverrideUntil, TagManualChanges, TagSnoozeUntil,
+}
+
 type Tags struct {
 	InstanceSchedulingEnabled     string `yaml:"enabled"`
 	InstanceSchedulingSchedule    string `yaml:"schedule"`
 	InstanceSchedulingPatchWindow string `yaml:"patchWindow"`
+	InstanceSchedulingStopMode    string `yaml:"stopMode"`
+	// InstanceSchedulingOverrideUntil keeps an instance running, or stopped, until a given time
+	InstanceSchedulingOverrideUntil string `yaml:"overrideUntil"`
+	// InstanceSchedulingManualChanges sets whether manual power state changes are respected or
+	// overridden for an instance
+	InstanceSchedulingManualChanges string `yaml:"manualChanges"`
+	// InstanceSchedulingSnoozeUntil holds back an instance's stop until a given time, it is set by the
+	// instance's owner after being warned of the stop
+	InstanceSchedulingSnoozeUntil string `yaml:"snoozeUntil"`
+	// Aliases are earlier names of each tag keyed by its logical name, in order of precedence. The
+	// current name always takes precedence over its aliases.
+	Aliases map[string][]string `yaml:"aliases"`
+	// Status are the names of the tags the scheduler writes its status to
+	Status StatusTags `yaml:"status"`
+}
+
+// TagValues are the scheduler's values read from an instance's tags
+type TagValues struct {
+	Enabled     bool
+	Schedule    string
+	PatchWindow string
+	StopMode    string
+	// OverrideUntil is the raw override tag, see `override.Parse`
+	OverrideUntil string
+	ManualChanges string
+	// SnoozeUntil is the raw snooze tag, see `override.ParseTime`
+	SnoozeUntil string
 }
 
 func NewTagsFromConfig(path string) (*Tags, error) {
@@ -43,21 +89,120 @@ func NewTagsFromConfig(path string) (*Tags, error) {
 	return &tags, nil
 }
 
-func (t *Tags) LoadValues(tags map[string]*string) (bool, string, string) {
-	var enabled bool
-	var schedule string
-	var patchWindow string
+// Name returns the current name of a logical tag
+func (t *Tags) Name(tag string) string {
+	switch tag {
+	case TagEnabled:
+		return t.InstanceSchedulingEnabled
+	case TagSchedule:
+		return t.InstanceSchedulingSchedule
+	case TagPatchWindow:
+		return t.InstanceSchedulingPatchWindow
+	case TagStopMode:
+		return t.InstanceSchedulingStopMode
+	case TagOverrideUntil:
+		return t.InstanceSchedulingOverrideUntil
+	case TagManualChanges:
+		return t.InstanceSchedulingManualChanges
+	case TagSnoozeUntil:
+		return t.InstanceSchedulingSnoozeUntil
+	}
+
+	return ""
+}
+
+// Names returns every name of a logical tag in order of precedence, the current name followed by
+// its aliases. A tag without a current name has no names, so it is never read.
+func (t *Tags) Names(tag string) []string {
+	if t.Name(tag) == "" {
+		return nil
+	}
+
+	return append([]string{t.Name(tag)}, t.Aliases[tag]...)
+}
+
+// Lookup returns the key and value of a logical tag on an instance. Tag keys are matched
+// case-insensitively, as they are by Azure, and the first of the tag's names found is used.
+func (t *Tags) Lookup(tags map[string]*string, tag string) (string, string, bool) {
+	for _, name := range t.Names(tag) {
+		if key, value, ok := LookupTag(tags, name); ok {
+			return key, value, true
+		}
+	}
+
+	return "", "", false
+}
+
+// LookupTag returns the key and value of the tag `name` on an instance, matching its key
+// case-insensitively
+func LookupTag(tags map[string]*string, name string) (string, string, bool) {
+	if value, ok := tags[name]; ok && value != nil {
+		return name, *value, true
+	}
 
 	for key, value := range tags {
-		switch key {
-		case t.InstanceSchedulingEnabled:
-			enabled, _ = strconv.ParseBool(*value)
-		case t.InstanceSchedulingSchedule:
-			schedule = *value
-		case t.InstanceSchedulingPatchWindow:
-			patchWindow = *value
+		if value != nil && strings.EqualFold(key, name) {
+			return key, *value, true
 		}
 	}
 
-	return enabled, schedule, patchWindow
+	return "", "", false
+}
+
+func (t *Tags) LoadValues(tags map[string]*string) TagValues {
+	var values TagValues
+
+	if key, value, ok := t.Lookup(tags, TagEnabled); ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Warn().Str("tag", key).Str("value", value).Msg("Enabled tag is not a boolean, treating it as false")
+		}
+
+		values.Enabled = enabled
+	}
+
+	_, values.Schedule, _ = t.Lookup(tags, TagSchedule)
+	_, values.PatchWindow, _ = t.Lookup(tags, TagPatchWindow)
+	_, values.StopMode, _ = t.Lookup(tags, TagStopMode)
+	_, values.OverrideUntil, _ = t.Lookup(tags, TagOverrideUntil)
+	_, values.ManualChanges, _ = t.Lookup(tags, TagManualChanges)
+	_, values.SnoozeUntil, _ = t.Lookup(tags, TagSnoozeUntil)
+
+	return values
+}
+
+// resourceGraphProjection selects the fields of an instance read from Resource Graph
+const resourceGraphProjection = `| project id, name, resourceGroup, subscriptionId, tags, location,
+    vmSize = tostring(properties.hardwareProfile.vmSize),
+    powerState = tostring(properties.extended.instanceView.powerState.code),
+    hibernationEnabled = tobool(properties.additionalCapabilities.hibernationEnabled)`
+
+// ResourceGraphQuery returns the KQL query used to discover instances that have scheduling enabled.
+// The enabled tag, under any of its names and in any case, is filtered on the server side using the
+// values `strconv.ParseBool` treats as true. Precedence between the names is applied once the tags
+// are loaded.
+func (t *Tags) ResourceGraphQuery() string {
+	return fmt.Sprintf(`resources
+| where type =~ 'microsoft.compute/virtualmachines'
+| where tostring(tags) matches regex @'%s'
+%s`, strings.ReplaceAll(t.enabledPattern(), "'", "''"), resourceGraphProjection)
+}
+
+// enabledPattern returns the regular expression matching the enabled tag in an instance's tags as
+// JSON. Only the key is matched in any case, the value must be exactly one that `strconv.ParseBool`
+// treats as true, so that discovery agrees with `LoadValues`.
+func (t *Tags) enabledPattern() string {
+	names := make([]string, 0, len(t.Names(TagEnabled)))
+	for _, name := range t.Names(TagEnabled) {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+
+	return fmt.Sprintf(`"(?i:%s)"\s*:\s*"(1|t|T|TRUE|true|True)"`, strings.Join(names, "|"))
+}
+
+// InventoryQuery returns the KQL query used to discover every instance, regardless of its tags
+func InventoryQuery() string {
+	return `resources
+| where type =~ 'microsoft.compute/virtualmachines'
+` + resourceGraphProjection
 }
@@ -0,0 +1,180 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func testTags() *Tags {
+	return &Tags{
+		InstanceSchedulingEnabled:  "AutoShutdownEnabled",
+		InstanceSchedulingSchedule: "AutoShutdownScheduleV2",
+		Aliases: map[string][]string{
+			TagSchedule: {"AutoShutdownSchedule", "Schedule"},
+		},
+	}
+}
+
+func tagMap(tags map[string]string) map[string]*string {
+	result := make(map[string]*string, len(tags))
+
+	for key, value := range tags {
+		value := value
+		result[key] = &value
+	}
+
+	return result
+}
+
+// TestLoadValues checks tag keys are matched case-insensitively and aliases are used in order
+func TestLoadValues(t *testing.T) {
+	testCases := []struct {
+		name string
+		tags map[string]string
+		want TagValues
+	}{
+		{
+			name: "exact",
+			tags: map[string]string{"AutoShutdownEnabled": "true", "AutoShutdownScheduleV2": "current"},
+			want: TagValues{Enabled: true, Schedule: "current"},
+		},
+		{
+			name: "different case",
+			tags: map[string]string{"autoshutdownenabled": "true", "AUTOSHUTDOWNSCHEDULEV2": "current"},
+			want: TagValues{Enabled: true, Schedule: "current"},
+		},
+		{
+			name: "alias",
+			tags: map[string]string{"AutoShutdownEnabled": "true", "schedule": "second alias"},
+			want: TagValues{Enabled: true, Schedule: "second alias"},
+		},
+		{
+			name: "current name takes precedence",
+			tags: map[string]string{"AutoShutdownSchedule": "alias", "AutoShutdownScheduleV2": "current"},
+			want: TagValues{Schedule: "current"},
+		},
+		{
+			name: "earlier alias takes precedence",
+			tags: map[string]string{"Schedule": "second alias", "autoshutdownschedule": "first alias"},
+			want: TagValues{Schedule: "first alias"},
+		},
+		{
+			name: "unconfigured tag is ignored",
+			tags: map[string]string{"": "stop mode"},
+			want: TagValues{},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			got := testTags().LoadValues(tagMap(test.tags))
+
+			if got != test.want {
+				t.Errorf("got: %+v, want: %+v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestEnabledPattern checks Resource Graph discovery matches the enabled tag in any case but only
+// with the values that `LoadValues` treats as enabled
+func TestEnabledPattern(t *testing.T) {
+	testCases := []struct {
+		name string
+		tags map[string]string
+		want bool
+	}{
+		{name: "true", tags: map[string]string{"AutoShutdownEnabled": "true"}, want: true},
+		{name: "title case", tags: map[string]string{"AutoShutdownEnabled": "True"}, want: true},
+		{name: "upper case", tags: map[string]string{"AutoShutdownEnabled": "TRUE"}, want: true},
+		{name: "t", tags: map[string]string{"AutoShutdownEnabled": "T"}, want: true},
+		{name: "one", tags: map[string]string{"AutoShutdownEnabled": "1"}, want: true},
+		{name: "key in any case", tags: map[string]string{"autoshutdownENABLED": "true"}, want: true},
+		{name: "mixed case value", tags: map[string]string{"AutoShutdownEnabled": "tRuE"}},
+		{name: "yes", tags: map[string]string{"AutoShutdownEnabled": "yes"}},
+		{name: "false", tags: map[string]string{"AutoShutdownEnabled": "false"}},
+		{name: "other tag", tags: map[string]string{"Enabled": "true"}},
+	}
+
+	pattern := regexp.MustCompile(testTags().enabledPattern())
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(test.tags)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := pattern.Match(data)
+
+			if got != test.want {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+
+			if enabled := testTags().LoadValues(tagMap(test.tags)).Enabled; enabled != got {
+				t.Errorf("got: %v, want: %v, as loaded", got, enabled)
+			}
+		})
+	}
+}
+
+// TestMigrate checks legacy tag names and formats are rewritten to the current ones
+func TestMigrate(t *testing.T) {
+	testCases := []struct {
+		name string
+		tags map[string]string
+		want TagMigration
+	}{
+		{
+			name: "current",
+			tags: map[string]string{"AutoShutdownEnabled": "true", "AutoShutdownScheduleV2": `{"default":"09:00-17:00"}`},
+			want: TagMigration{Set: map[string]string{}},
+		},
+		{
+			name: "alias and case",
+			tags: map[string]string{"autoshutdownenabled": "true", "AutoShutdownSchedule": `{"default":"09:00-17:00"}`},
+			want: TagMigration{
+				Set: map[string]string{
+					"AutoShutdownEnabled":    "true",
+					"AutoShutdownScheduleV2": `{"default":"09:00-17:00"}`,
+				},
+				Remove: []string{"AutoShutdownSchedule", "autoshutdownenabled"},
+			},
+		},
+		{
+			name: "ignored alias",
+			tags: map[string]string{"AutoShutdownScheduleV2": `{"default":"09:00-17:00"}`, "Schedule": "stale"},
+			want: TagMigration{Set: map[string]string{}, Remove: []string{"Schedule"}},
+		},
+		{
+			name: "legacy formats",
+			tags: map[string]string{"AutoShutdownEnabled": "1", "AutoShutdownScheduleV2": `{"default":["09:00-17:00"]}`},
+			want: TagMigration{Set: map[string]string{
+				"AutoShutdownEnabled":    "true",
+				"AutoShutdownScheduleV2": `{"default":"09:00-17:00"}`,
+			}},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			got := testTags().Migrate(tagMap(test.tags))
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got: %+v, want: %+v", got, test.want)
+			}
+		})
+	}
+}
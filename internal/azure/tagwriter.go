@@ -0,0 +1,93 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	"github.com/rs/zerolog/log"
+)
+
+// MigrateTags applies a tag migration to an instance with patches, so that tags written since the
+// instance was listed are left untouched. Azure treats tag keys case-insensitively, so a tag whose
+// key only changes case is written once the legacy key has been deleted, every other tag is written
+// first so that a failure part way through never loses a value.
+func (c *ComputeClient) MigrateTags(instance Instance, migration TagMigration) error {
+	set := make(map[string]*string, len(migration.Set))
+	renamed := make(map[string]*string, len(migration.Set))
+	remove := make(map[string]*string, len(migration.Remove))
+
+	for key, value := range migration.Set {
+		value := value
+
+		if slices.ContainsFunc(migration.Remove, func(legacy string) bool { return strings.EqualFold(legacy, key) }) {
+			renamed[key] = &value
+		} else {
+			set[key] = &value
+		}
+	}
+
+	for _, key := range migration.Remove {
+		// deleting by name and value leaves a tag alone when its value has changed since it was listed
+		remove[key] = instance.Tags[key]
+	}
+
+	log.Info().Str("instance", instance.Name).Msg("Migrating instance tags")
+
+	if len(set) > 0 {
+		if err := c.MergeTags(instance, set); err != nil {
+			return err
+		}
+	}
+
+	if len(remove) > 0 {
+		if err := c.DeleteTags(instance, remove); err != nil {
+			return err
+		}
+	}
+
+	if len(renamed) > 0 {
+		return c.MergeTags(instance, renamed)
+	}
+
+	return nil
+}
+
+// MergeTags adds `tags` to an instance, replacing the values of existing tags with the same keys and
+// leaving every other tag untouched
+func (c *ComputeClient) MergeTags(instance Instance, tags map[string]*string) error {
+	return c.patchTags(instance, armresources.TagsPatchOperationMerge, tags, "merge tags")
+}
+
+// DeleteTags removes `tags` from an instance, leaving every other tag untouched
+func (c *ComputeClient) DeleteTags(instance Instance, tags map[string]*string) error {
+	return c.patchTags(instance, armresources.TagsPatchOperationDelete, tags, "delete tags")
+}
+
+func (c *ComputeClient) patchTags(instance Instance, operation armresources.TagsPatchOperation,
+	tags map[string]*string, op string) error {
+	log.Debug().Str("instance", instance.Name).Str("operation", string(operation)).Int("tags", len(tags)).
+		Msg("Updating instance tags")
+
+	ctx, cancel := c.actionContext()
+	defer cancel()
+
+	return retry(ctx, c.options.Retry, op, func() error {
+		_, err := c.tagsClient.UpdateAtScope(ctx, instance.ID, armresources.TagsPatchResource{
+			Operation:  to.Ptr(operation),
+			Properties: &armresources.Tags{Tags: tags},
+		}, nil)
+		return err
+	})
+}
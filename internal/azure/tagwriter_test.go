@@ -0,0 +1,90 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// TestMigrateTags checks a migration is written with merge and delete patches rather than by
+// replacing every tag, renaming a key that only changes case once the legacy key is deleted
+func TestMigrateTags(t *testing.T) {
+	testCases := []struct {
+		name string
+		tags map[string]string
+		want []string
+	}{
+		{
+			name: "alias",
+			tags: map[string]string{"AutoShutdownEnabled": "true", "Schedule": "09:00-17:00"},
+			want: []string{"Merge AutoShutdownScheduleV2=09:00-17:00", "Delete Schedule=09:00-17:00"},
+		},
+		{
+			name: "different case",
+			tags: map[string]string{"autoshutdownenabled": "True"},
+			want: []string{"Delete autoshutdownenabled=True", "Merge AutoShutdownEnabled=true"},
+		},
+		{
+			name: "legacy value",
+			tags: map[string]string{"AutoShutdownEnabled": "1"},
+			want: []string{"Merge AutoShutdownEnabled=true"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Operation  string `json:"operation"`
+					Properties struct {
+						Tags map[string]string `json:"tags"`
+					} `json:"properties"`
+				}
+
+				if r.Method != http.MethodPatch {
+					t.Errorf("got: %v, want: %v", r.Method, http.MethodPatch)
+				}
+
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("unable to decode patch: %v", err)
+				}
+
+				for key, value := range body.Properties.Tags {
+					got = append(got, fmt.Sprintf("%s %s=%s", body.Operation, key, value))
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, `{}`)
+			}
+
+			client := fakeComputeClient(t, handler, Options{})
+			instance := Instance{
+				ID:   "/subscriptions/sub-1/resourceGroups/rg-1/providers/Microsoft.Compute/virtualMachines/vm-1",
+				Name: "vm-1",
+				Tags: tagMap(test.tags),
+			}
+
+			if err := client.MigrateTags(instance, client.Tags.Migrate(instance.Tags)); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
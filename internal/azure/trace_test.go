@@ -0,0 +1,151 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"instancescheduler/internal/decision"
+	"instancescheduler/internal/pool"
+	"instancescheduler/internal/report"
+	"instancescheduler/internal/state"
+)
+
+// TestAssessInstanceTrace checks the decision trace shown by explain records the steps taken and the
+// rule that chose the action
+func TestAssessInstanceTrace(t *testing.T) {
+	// every day is off, so that the schedule wants the instance stopped whenever the test runs
+	const alwaysOff = `{"default": "09:00-17:00", "overrides": {"Monday": ["-"], "Tuesday": ["-"],
+		"Wednesday": ["-"], "Thursday": ["-"], "Friday": ["-"], "Saturday": ["-"], "Sunday": ["-"]}}`
+
+	tags := testTags()
+	tags.InstanceSchedulingOverrideUntil = "AutoShutdownOverrideUntil"
+	overrideUntil := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	testCases := []struct {
+		name           string
+		powerState     PowerState
+		tags           map[string]string
+		runningFor     time.Duration
+		wantAction     report.Action
+		wantRule       string
+		wantSteps      []string
+		wantSuppressed []report.SuppressedAction
+	}{
+		{
+			name:       "stop",
+			powerState: PowerStateRunning,
+			tags:       map[string]string{"AutoShutdownEnabled": "true", "AutoShutdownScheduleV2": alwaysOff},
+			runningFor: 2 * time.Hour,
+			wantAction: report.ActionStop,
+			wantRule:   decision.RuleStopOutsideSchedule,
+			wantSteps: []string{"tags", "stop mode", "schedule", "power state", "desired state", "patch window",
+				"decision"},
+		},
+		{
+			name:       "start",
+			powerState: PowerStateDeallocated,
+			tags: map[string]string{
+				"AutoShutdownEnabled":       "true",
+				"AutoShutdownScheduleV2":    alwaysOff,
+				"AutoShutdownOverrideUntil": fmt.Sprintf(`{"until": %q, "state": "running"}`, overrideUntil),
+			},
+			wantAction: report.ActionStart,
+			wantRule:   decision.RuleOverrideStart,
+			wantSteps: []string{"tags", "stop mode", "schedule", "override", "power state", "desired state",
+				"patch window", "decision"},
+		},
+		{
+			name:       "suppressed",
+			powerState: PowerStateRunning,
+			tags:       map[string]string{"AutoShutdownEnabled": "true", "AutoShutdownScheduleV2": alwaysOff},
+			runningFor: time.Minute,
+			wantAction: report.ActionNone,
+			wantRule:   decision.RuleSuppressed,
+			wantSteps: []string{"tags", "stop mode", "schedule", "power state", "desired state", "patch window",
+				"suppressed", "decision"},
+			wantSuppressed: []report.SuppressedAction{{
+				Action: report.ActionStop,
+				Rule:   decision.RuleStopOutsideSchedule,
+				Reason: string(decision.ReasonMinimumUptime),
+			}},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			store, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			instance := Instance{
+				ID:         "/subscriptions/sub-1/resourceGroups/rg-1/providers/Microsoft.Compute/virtualMachines/vm-1",
+				Name:       "vm-1",
+				Tags:       tagMap(test.tags),
+				PowerState: test.powerState,
+			}
+
+			err = store.UpdateHistory(instance.ID, func(h *state.History) {
+				h.Running, h.RunningSince = test.powerState.IsRunning(), time.Now().Add(-test.runningFor)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := &ComputeClient{
+				ctx:  context.Background(),
+				Tags: tags,
+				options: Options{
+					Pool:   pool.New(1, 0),
+					State:  store,
+					DryRun: true,
+					Limits: decision.Limits{MinimumUptime: time.Hour},
+				},
+			}
+
+			result := client.assessInstance(instance, client.Tags.LoadValues(instance.Tags))
+
+			if result.Err != nil {
+				t.Fatal(result.Err)
+			}
+
+			trace := result.Trace
+
+			if trace.Action != test.wantAction || trace.Rule != test.wantRule {
+				t.Errorf("got: %v by %v, want: %v by %v", trace.Action, trace.Rule, test.wantAction, test.wantRule)
+			}
+
+			var steps []string
+			for _, step := range trace.Steps {
+				steps = append(steps, step.Name)
+			}
+
+			if !reflect.DeepEqual(steps, test.wantSteps) {
+				t.Errorf("got: %v, want: %v", steps, test.wantSteps)
+			}
+
+			if decisionStep := trace.Steps[len(trace.Steps)-1]; !strings.Contains(decisionStep.Detail, test.wantRule) {
+				t.Errorf("got: %v, want the rule %v", decisionStep.Detail, test.wantRule)
+			}
+
+			if !reflect.DeepEqual(trace.Suppressed, test.wantSuppressed) {
+				t.Errorf("got: %v, want: %v", trace.Suppressed, test.wantSuppressed)
+			}
+		})
+	}
+}
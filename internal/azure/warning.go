@@ -0,0 +1,104 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package azure
+
+import (
+	"time"
+
+	"instancescheduler/internal/notify"
+	"instancescheduler/internal/override"
+	"instancescheduler/internal/report"
+	"instancescheduler/internal/state"
+
+	"github.com/rs/zerolog/log"
+)
+
+// snooze returns when the instance's snooze ends while it is still active, or the zero time when
+// there is none. An expired snooze is removed from the instance's tags, unless the client is a dry
+// run.
+func (c *ComputeClient) snooze(instance Instance, values TagValues, now time.Time) (time.Time, error) {
+	if values.SnoozeUntil == "" {
+		return time.Time{}, nil
+	}
+
+	until, err := override.ParseTime(values.SnoozeUntil)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if now.Before(until) {
+		return until, nil
+	}
+
+	log.Info().Str("instance", instance.Name).Time("until", until).Bool("dryRun", c.options.DryRun).
+		Msg("Removing expired snooze")
+
+	if key, value, ok := c.Tags.Lookup(instance.Tags, TagSnoozeUntil); ok && !c.options.DryRun {
+		if err := c.DeleteTags(instance, map[string]*string{key: &value}); err != nil {
+			log.Error().Err(err).Str("instance", instance.Name).Msg("Failed to remove expired snooze")
+		}
+	}
+
+	return time.Time{}, nil
+}
+
+// warn sends the instance's owner a warning once its stop at `stopAt` is within the warner's lead
+// time. Each stop is only warned of once, a snooze moves the stop and so is warned of again. It
+// returns when the warning is due, or the zero time when it has already been sent.
+func (c *ComputeClient) warn(instance Instance, stopAt, now time.Time, trace *report.Trace) time.Time {
+	warner := c.options.Warner
+	if warner == nil || c.options.State == nil {
+		return time.Time{}
+	}
+
+	if history, ok := c.options.State.History(instance.ID); ok && history.WarnedFor.Equal(stopAt) {
+		return time.Time{}
+	}
+
+	warnAt := stopAt.Add(-warner.Before)
+	if now.Before(warnAt) {
+		return warnAt
+	}
+
+	_, owner, _ := LookupTag(instance.Tags, warner.OwnerTag)
+
+	warning := notify.Warning{
+		InstanceID:     instance.ID,
+		SubscriptionID: instance.SubscriptionID,
+		ResourceGroup:  instance.ResourceGroup,
+		Instance:       instance.Name,
+		Owner:          owner,
+		StopAt:         stopAt,
+		SnoozeTag:      c.Tags.Name(TagSnoozeUntil),
+	}
+
+	if c.options.DryRun {
+		trace.Step("warning", "owner %q would be warned of the stop at %s", owner, stopAt.Format(time.RFC3339))
+		return time.Time{}
+	}
+
+	log.Info().Str("instance", instance.Name).Str("owner", owner).Time("stopAt", stopAt).
+		Msg("Warning owner of upcoming stop")
+
+	if err := warner.Warn(c.ctx, warning); err != nil {
+		log.Error().Err(err).Str("instance", instance.Name).Msg("Failed to warn owner of upcoming stop")
+		trace.Step("warning", "failed to warn owner %q of the stop at %s: %s", owner, stopAt.Format(time.RFC3339), err)
+		return time.Time{}
+	}
+
+	trace.Step("warning", "owner %q was warned of the stop at %s", owner, stopAt.Format(time.RFC3339))
+
+	c.updateHistory(instance, func(h *state.History) {
+		h.WarnedFor = stopAt
+	})
+
+	return time.Time{}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package cli
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"time"
+
+	"instancescheduler/internal/api"
+)
+
+// apiTokenEnv is the environment variable holding the API's static bearer token, so that it is not
+// passed on the command line
+const apiTokenEnv = "INSTANCESCHEDULER_API_TOKEN"
+
+// apiConfig holds the flags for the HTTP API served alongside the reconcile loop
+type apiConfig struct {
+	addr         string
+	oidcIssuer   string
+	oidcAudience string
+	readOnly     bool
+	maxExtend    time.Duration
+}
+
+func (c *apiConfig) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.addr, "api-addr", "", "address to serve the HTTP API on, such as ':8080', no API is served when unset")
+	fs.StringVar(&c.oidcIssuer, "api-oidc-issuer", "",
+		"issuer URL of the OpenID Connect provider whose tokens are accepted, a static token is read from "+
+			apiTokenEnv+" otherwise")
+	fs.StringVar(&c.oidcAudience, "api-oidc-audience", "", "audience the OpenID Connect tokens must be issued for")
+	fs.BoolVar(&c.readOnly, "api-read-only", false, "reject API requests that change instances")
+	fs.DurationVar(&c.maxExtend, "api-max-extend", api.DefaultMaxExtend,
+		"longest an instance may be kept running by a single extend request")
+}
+
+// newServer returns the API server for the scheduler, or nil when the API is disabled. Requests
+// must always be authenticated, so either an OpenID Connect issuer or a static token is required.
+func (c *apiConfig) newServer(s api.Scheduler, dryRun bool) (*api.Server, error) {
+	var auth api.Authenticator
+
+	if c.addr == "" {
+		return nil, nil
+	}
+
+	switch {
+	case c.oidcIssuer != "":
+		if c.oidcAudience == "" {
+			return nil, errors.New("-api-oidc-audience is required with -api-oidc-issuer")
+		}
+
+		auth = &api.OIDC{Issuer: c.oidcIssuer, Audience: c.oidcAudience}
+	case os.Getenv(apiTokenEnv) != "":
+		auth = api.StaticToken{Token: os.Getenv(apiTokenEnv)}
+	default:
+		return nil, errors.New("the API requires -api-oidc-issuer or a static token in " + apiTokenEnv)
+	}
+
+	return &api.Server{
+		Scheduler: s,
+		Auth:      auth,
+		ReadOnly:  c.readOnly || dryRun,
+		MaxExtend: c.maxExtend,
+	}, nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	ExitOK      = 0
+	ExitFailure = 1
+	ExitUsage   = 2
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(ctx context.Context, args []string) int
+}
+
+func commands() []command {
+	return []command{
+		{name: "validate", description: "check schedule and patch window tag values without calling Azure", run: runValidate},
+		{name: "validate-iac", description: "check scheduler tags in Terraform plans, ARM templates or resource lists", run: runValidateIaC},
+		{name: "lint", description: "report invalid scheduler tags and scheduling coverage across every instance", run: runLint},
+		{name: "migrate-tags", description: "rewrite legacy scheduler tags to their current names and formats", run: runMigrateTags},
+		{name: "plan", description: "show the action that would be taken for every instance", run: runPlan},
+		{name: "apply", description: "start and stop instances according to their schedules", run: runApply},
+		{name: "explain", description: "show how the action for a single instance was decided", run: runExplain},
+		{name: "history", description: "show the audited evaluations and actions of a single instance", run: runHistory},
+		{name: "next", description: "list upcoming schedule and patch window transitions", run: runNext},
+		{name: "report", description: "'report savings' estimates what scheduling saves", run: runReport},
+		{name: "serve", description: "keep running, reconciling every instance on an interval", run: runServe},
+	}
+}
+
+// Run executes the subcommand named by the first argument, returning the process exit code. When
+// the first argument is a flag other than help, or there are no arguments, `apply` is run so that
+// existing invocations keep working.
+func Run(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+		usage(os.Stdout)
+		return ExitOK
+	}
+
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runApply(ctx, args)
+	}
+
+	for _, cmd := range commands() {
+		if cmd.name == args[0] {
+			return cmd.run(ctx, args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command '%s'\n\n", args[0])
+	usage(os.Stderr)
+
+	return ExitUsage
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: instancescheduler <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.description)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'instancescheduler <command> -h' for the flags of a command.")
+}
+
+// configureLogging sets the global log level, using a human readable console writer for debug
+func configureLogging(debug bool) {
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	log.Logger = log.With().Caller().Logger()
+
+	if debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr}).With().Caller().Logger()
+	}
+}
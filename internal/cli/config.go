@@ -0,0 +1,241 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"instancescheduler/internal/audit"
+	"instancescheduler/internal/azure"
+	"instancescheduler/internal/decision"
+	"instancescheduler/internal/events"
+	"instancescheduler/internal/pool"
+	"instancescheduler/internal/scheduler"
+	"instancescheduler/internal/state"
+	"instancescheduler/internal/telemetry"
+
+	"github.com/rs/zerolog/log"
+)
+
+// defaultAuditLogPath is where the audit log is written, and read by `history`, unless set by flag
+const defaultAuditLogPath = "./audit.jsonl"
+
+// config holds the flags shared by every command
+type config struct {
+	debug          bool
+	tagsConfigPath string
+}
+
+func (c *config) register(fs *flag.FlagSet) {
+	fs.BoolVar(&c.debug, "debug", false, "sets log level to debug")
+	fs.StringVar(&c.tagsConfigPath, "config", "./tags.yaml", "path for tags config file")
+}
+
+// loadTags configures logging and loads the tags config, this is all that offline commands need
+func (c *config) loadTags() (*azure.Tags, error) {
+	configureLogging(c.debug)
+
+	return azure.NewTagsFromConfig(c.tagsConfigPath)
+}
+
+// azureConfig holds the flags shared by every command that calls Azure
+type azureConfig struct {
+	config
+	notifyConfig
+
+	subscriptions    string
+	managementGroup  string
+	allSubscriptions bool
+	discovery        string
+	concurrency      int
+	scopeConcurrency int
+	concurrencyScope string
+	actionTimeout    time.Duration
+	stateFilePath    string
+	stopMode         string
+	maxAttempts      int
+	statusTags       bool
+	manualChanges    string
+	manualGrace      time.Duration
+	minimumUptime    time.Duration
+	minimumDowntime  time.Duration
+	cooldown         time.Duration
+	ownerTag         string
+	eventsConfigPath string
+	traceExporter    string
+	auditLogPath     string
+
+	// auditLog is closed along with the trace exporter once the command has finished
+	auditLog *audit.Log
+	// shutdownTracing flushes and stops the trace exporter once the command has finished
+	shutdownTracing func(context.Context) error
+}
+
+func (c *azureConfig) register(fs *flag.FlagSet) {
+	c.config.register(fs)
+	c.notifyConfig.register(fs)
+
+	fs.StringVar(&c.subscriptions, "subscriptions", "", "comma separated list of subscription IDs to process")
+	fs.StringVar(&c.managementGroup, "management-group", "", "management group ID whose subscriptions will be processed")
+	fs.BoolVar(&c.allSubscriptions, "all-subscriptions", false, "process every subscription the identity can see")
+	fs.StringVar(&c.discovery, "discovery", scheduler.DiscoveryResourceGraph,
+		"how instances are discovered, either 'resourcegraph' or 'compute'")
+	fs.IntVar(&c.concurrency, "concurrency", 10, "maximum number of instances assessed and actioned at once")
+	fs.IntVar(&c.scopeConcurrency, "scope-concurrency", 0,
+		"maximum number of instances assessed and actioned at once per concurrency scope, 0 for no limit")
+	fs.StringVar(&c.concurrencyScope, "concurrency-scope", azure.ConcurrencyScopeSubscription,
+		"scope the per scope concurrency limit applies to, either 'subscription' or 'resourcegroup'")
+	fs.DurationVar(&c.actionTimeout, "action-timeout", 15*time.Minute, "maximum time a single power action may take")
+	fs.StringVar(&c.stateFilePath, "state-file", "./state.json", "path for the scheduler's local state file")
+	fs.StringVar(&c.stopMode, "stop-mode", string(azure.StopModeDeallocate),
+		"how instances are stopped when not set by tag, one of 'deallocate', 'poweroff' or 'hibernate'")
+	fs.IntVar(&c.maxAttempts, "max-attempts", azure.DefaultRetryOptions.MaxAttempts,
+		"maximum attempts for an Azure call that is throttled, fails on the server or conflicts")
+	fs.BoolVar(&c.statusTags, "status-tags", false, "write each instance's last action, next action and errors to its tags")
+	fs.StringVar(&c.manualChanges, "manual-changes", string(azure.ManualChangesRespect),
+		"how power state changes the scheduler did not make are treated when not set by tag, either 'respect' or 'override'")
+	fs.DurationVar(&c.manualGrace, "manual-grace", 0,
+		"how long a respected manual change is left alone for, 0 leaves it alone until the next transition")
+	fs.DurationVar(&c.minimumUptime, "minimum-uptime", 0, "how long an instance must have been running before it is stopped")
+	fs.DurationVar(&c.minimumDowntime, "minimum-downtime", 0, "how long an instance must have been stopped before it is started")
+	fs.DurationVar(&c.cooldown, "cooldown", 0, "how long after starting or stopping an instance the opposite action is suppressed")
+	fs.StringVar(&c.ownerTag, "owner-tag", "owner", "tag holding an instance's owner, matched case-insensitively")
+	fs.StringVar(&c.eventsConfigPath, "events-config", "", "path for the events config file, no events are published when unset")
+	fs.StringVar(&c.traceExporter, "trace-exporter", telemetry.ExporterNone,
+		"where OpenTelemetry spans are exported, one of 'none', 'otlp' or 'stdout'")
+	fs.StringVar(&c.auditLogPath, "audit-log", defaultAuditLogPath,
+		"path for the audit log of every evaluation and action, no audit log is written when empty")
+}
+
+// newScheduler validates the flags, then loads the tags config, state and credential shared by
+// every command that calls Azure
+func (c *azureConfig) newScheduler() (*scheduler.Scheduler, error) {
+	if c.discovery != scheduler.DiscoveryResourceGraph && c.discovery != scheduler.DiscoveryCompute {
+		return nil, fmt.Errorf("unknown discovery mode '%s'", c.discovery)
+	}
+
+	if c.concurrencyScope != azure.ConcurrencyScopeSubscription && c.concurrencyScope != azure.ConcurrencyScopeResourceGroup {
+		return nil, fmt.Errorf("unknown concurrency scope '%s'", c.concurrencyScope)
+	}
+
+	stopMode, err := azure.ParseStopMode(c.stopMode)
+	if err != nil {
+		return nil, err
+	}
+
+	manualChanges, err := azure.ParseManualChanges(c.manualChanges)
+	if err != nil {
+		return nil, err
+	}
+
+	warner, err := c.newWarner(c.ownerTag)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := c.loadTags()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load tags config: %w", err)
+	}
+
+	var publisher *events.Publisher
+	if c.eventsConfigPath != "" {
+		publisher, err = events.Load(c.eventsConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load events config: %w", err)
+		}
+	}
+
+	scope := azure.Scope{
+		SubscriptionIDs:   azure.ParseSubscriptionIDs(c.subscriptions),
+		ManagementGroupID: c.managementGroup,
+		AllSubscriptions:  c.allSubscriptions,
+	}
+
+	if len(scope.SubscriptionIDs) == 0 && scope.ManagementGroupID == "" && !scope.AllSubscriptions {
+		scope.SubscriptionIDs = azure.ParseSubscriptionIDs(os.Getenv("AZURE_SUBSCRIPTION_ID"))
+	}
+
+	credential, err := azure.NewCredential()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get Azure credential: %w", err)
+	}
+
+	store, err := state.Load(c.stateFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load state file: %w", err)
+	}
+
+	c.shutdownTracing, err = telemetry.Setup(context.Background(), c.traceExporter)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.auditLogPath != "" {
+		c.auditLog = audit.New(c.auditLogPath)
+	}
+
+	options := &azure.Options{
+		Pool:             pool.New(c.concurrency, c.scopeConcurrency),
+		ConcurrencyScope: c.concurrencyScope,
+		ActionTimeout:    c.actionTimeout,
+		State:            store,
+		StopMode:         stopMode,
+		Retry:            azure.DefaultRetryOptions,
+		StatusTags:       c.statusTags,
+		ManualChanges:    manualChanges,
+		ManualGrace:      c.manualGrace,
+		Limits: decision.Limits{
+			MinimumUptime:   c.minimumUptime,
+			MinimumDowntime: c.minimumDowntime,
+			Cooldown:        c.cooldown,
+		},
+		Warner:  warner,
+		Events:  publisher,
+		Tracing: telemetry.Enabled(c.traceExporter),
+		Audit:   c.auditLog,
+	}
+
+	options.Retry.MaxAttempts = c.maxAttempts
+
+	return &scheduler.Scheduler{
+		Credential: credential,
+		Tags:       tags,
+		Scope:      scope,
+		Discovery:  c.discovery,
+		Options:    options,
+	}, nil
+}
+
+// close flushes any spans still waiting to be exported and closes the audit log, it is deferred by
+// every command once the scheduler is set up
+func (c *azureConfig) close() {
+	if c.auditLog != nil {
+		if err := c.auditLog.Close(); err != nil {
+			log.Error().Err(err).Msg("Failed to close audit log")
+		}
+	}
+
+	if c.shutdownTracing == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := c.shutdownTracing(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to flush trace spans")
+	}
+}
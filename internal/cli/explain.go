@@ -0,0 +1,79 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"instancescheduler/internal/report"
+
+	"github.com/rs/zerolog/log"
+)
+
+func runExplain(ctx context.Context, args []string) int {
+	var cfg azureConfig
+	var instance string
+
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	cfg.register(fs)
+	output := fs.String("output", report.FormatTable, "format of the explanation, either 'table' or 'json'")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: instancescheduler explain <instance name or resource ID> [flags]")
+		fs.PrintDefaults()
+	}
+
+	// the instance may be given before or after the flags
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		instance, args = args[0], args[1:]
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	if instance == "" {
+		instance = fs.Arg(0)
+	}
+
+	if instance == "" {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	s, err := cfg.newScheduler()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to set up scheduler")
+		return ExitUsage
+	}
+	defer cfg.close()
+
+	runReport, err := s.Explain(ctx, instance)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to assess instance")
+		return ExitFailure
+	}
+
+	if len(runReport.Results) == 0 {
+		log.Error().Str("instance", instance).Msg("Instance not found or scheduling is not enabled for it")
+		return ExitFailure
+	}
+
+	if err := runReport.WriteExplanations(os.Stdout, *output); err != nil {
+		log.Error().Err(err).Msg("Failed to write explanation")
+		return ExitUsage
+	}
+
+	return exitCode(runReport)
+}
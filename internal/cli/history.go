@@ -0,0 +1,71 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"instancescheduler/internal/audit"
+	"instancescheduler/internal/report"
+
+	"github.com/rs/zerolog/log"
+)
+
+func runHistory(ctx context.Context, args []string) int {
+	var instance string
+
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	debug := fs.Bool("debug", false, "sets log level to debug")
+	path := fs.String("audit-log", defaultAuditLogPath, "path for the audit log to read")
+	output := fs.String("output", report.FormatTable, "format of the history, either 'table' or 'json'")
+	limit := fs.Int("limit", 0, "maximum number of the most recent records to show, 0 for no limit")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: instancescheduler history <instance name or resource ID> [flags]")
+		fs.PrintDefaults()
+	}
+
+	// the instance may be given before or after the flags
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		instance, args = args[0], args[1:]
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	if instance == "" {
+		instance = fs.Arg(0)
+	}
+
+	if instance == "" {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	configureLogging(*debug)
+
+	records, err := audit.Query(*path, instance)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read audit log")
+		return ExitFailure
+	}
+
+	if err := audit.Write(os.Stdout, records, *output, *limit); err != nil {
+		log.Error().Err(err).Msg("Failed to write history")
+		return ExitUsage
+	}
+
+	return ExitOK
+}
@@ -0,0 +1,132 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"instancescheduler/internal/report"
+	"instancescheduler/internal/validate"
+
+	"github.com/rs/zerolog/log"
+)
+
+// iacReport is the machine readable output of `validate-iac`
+type iacReport struct {
+	Valid     bool                      `json:"valid"`
+	Files     int                       `json:"files"`
+	Resources int                       `json:"resources"`
+	Results   []validate.ResourceResult `json:"results"`
+}
+
+func runValidateIaC(ctx context.Context, args []string) int {
+	var cfg config
+
+	fs := flag.NewFlagSet("validate-iac", flag.ContinueOnError)
+	cfg.register(fs)
+	input := fs.String("input", string(validate.FormatAuto),
+		"format of the files, one of 'auto', 'terraform', 'arm' or 'resources'")
+	output := fs.String("output", report.FormatTable, "format of the results, either 'table' or 'json'")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: instancescheduler validate-iac [flags] <file>...")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	format, err := validate.ParseFormat(*input)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid input format")
+		return ExitUsage
+	}
+
+	tags, err := cfg.loadTags()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load tags config")
+		return ExitUsage
+	}
+
+	iac := iacReport{Valid: true, Files: fs.NArg(), Results: []validate.ResourceResult{}}
+
+	for _, path := range fs.Args() {
+		var data []byte
+
+		if path == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(path)
+		}
+		if err != nil {
+			log.Error().Err(err).Str("file", path).Msg("Failed to read file")
+			return ExitUsage
+		}
+
+		resources, err := validate.ParseResources(path, data, format)
+		if err != nil {
+			log.Error().Err(err).Str("file", path).Msg("Failed to parse file")
+			return ExitUsage
+		}
+
+		iac.Resources += len(resources)
+
+		for _, result := range validate.Resources(tags, resources) {
+			iac.Valid = iac.Valid && result.Valid()
+			iac.Results = append(iac.Results, result)
+		}
+	}
+
+	if err := writeIaCReport(os.Stdout, iac, *output); err != nil {
+		log.Error().Err(err).Msg("Failed to write results")
+		return ExitUsage
+	}
+
+	if !iac.Valid {
+		return ExitFailure
+	}
+
+	return ExitOK
+}
+
+func writeIaCReport(w io.Writer, iac iacReport, format string) error {
+	switch format {
+	case report.FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(iac)
+	case report.FormatTable:
+		for _, result := range iac.Results {
+			for _, problem := range result.Problems {
+				fmt.Fprintf(w, "%s: %s (%s): %s: %s\n", result.File, result.Address, result.Path, problem.Tag,
+					problem.Message)
+			}
+		}
+
+		fmt.Fprintf(w, "%d file(s), %d virtual machine(s), %d with scheduler tags, valid: %t\n", iac.Files,
+			iac.Resources, len(iac.Results), iac.Valid)
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown output format '%s'", format)
+}
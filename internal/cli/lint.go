@@ -0,0 +1,65 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"os"
+	"time"
+
+	"instancescheduler/internal/lint"
+	"instancescheduler/internal/report"
+
+	"github.com/rs/zerolog/log"
+)
+
+func runLint(ctx context.Context, args []string) int {
+	var cfg azureConfig
+
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	cfg.register(fs)
+	output := fs.String("output", report.FormatTable, "format of the report, one of 'table', 'json', 'csv' or 'markdown'")
+
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	s, err := cfg.newScheduler()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to set up scheduler")
+		return ExitUsage
+	}
+	defer cfg.close()
+
+	instances, failures, err := s.Inventory(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list instances")
+		return ExitFailure
+	}
+
+	for _, failure := range failures {
+		log.Error().Err(failure.Err).Str("subscription", failure.SubscriptionID).Msg("Subscription failed")
+	}
+
+	lintReport := lint.Lint(s.Tags, instances, cfg.ownerTag, time.Now().Local())
+
+	if err := lintReport.Write(os.Stdout, *output); err != nil {
+		log.Error().Err(err).Msg("Failed to write lint report")
+		return ExitUsage
+	}
+
+	if len(lintReport.Findings) > 0 || len(failures) > 0 {
+		return ExitFailure
+	}
+
+	return ExitOK
+}
@@ -0,0 +1,126 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"instancescheduler/internal/report"
+	"instancescheduler/internal/scheduler"
+
+	"github.com/rs/zerolog/log"
+)
+
+func runMigrateTags(ctx context.Context, args []string) int {
+	var cfg azureConfig
+
+	fs := flag.NewFlagSet("migrate-tags", flag.ContinueOnError)
+	cfg.register(fs)
+	dryRun := fs.Bool("dry-run", false, "show the tag changes without making them")
+	output := fs.String("output", report.FormatTable, "format of the changes, either 'table' or 'json'")
+
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	s, err := cfg.newScheduler()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to set up scheduler")
+		return ExitUsage
+	}
+	defer cfg.close()
+
+	s.Options.DryRun = *dryRun
+
+	results, failures, err := s.MigrateTags(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to migrate tags")
+		return ExitFailure
+	}
+
+	for _, failure := range failures {
+		log.Error().Err(failure.Err).Str("subscription", failure.SubscriptionID).Msg("Subscription failed")
+	}
+
+	if err := writeMigrations(os.Stdout, results, *output); err != nil {
+		log.Error().Err(err).Msg("Failed to write tag changes")
+		return ExitUsage
+	}
+
+	if len(failures) > 0 {
+		return ExitFailure
+	}
+
+	for _, result := range results {
+		if result.Error != "" {
+			return ExitFailure
+		}
+	}
+
+	return ExitOK
+}
+
+func writeMigrations(w io.Writer, results []scheduler.MigrationResult, format string) error {
+	switch format {
+	case report.FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		if results == nil {
+			results = []scheduler.MigrationResult{}
+		}
+
+		return encoder.Encode(results)
+	case report.FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+		fmt.Fprintln(tw, "SUBSCRIPTION\tRESOURCE GROUP\tINSTANCE\tSET\tREMOVE\tSTATUS")
+
+		for _, result := range results {
+			var set []string
+			for key, value := range result.Migration.Set {
+				set = append(set, key+"="+value)
+			}
+
+			sort.Strings(set)
+
+			status := "planned"
+			if result.Applied {
+				status = "applied"
+			} else if result.Error != "" {
+				status = result.Error
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", result.SubscriptionID, result.ResourceGroup, result.Instance,
+				valueOrDash(strings.Join(set, ", ")), valueOrDash(strings.Join(result.Migration.Remove, ", ")), status)
+		}
+
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format '%s', expected one of table or json", format)
+	}
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
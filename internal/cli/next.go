@@ -0,0 +1,56 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"instancescheduler/internal/report"
+
+	"github.com/rs/zerolog/log"
+)
+
+func runNext(ctx context.Context, args []string) int {
+	var cfg azureConfig
+
+	fs := flag.NewFlagSet("next", flag.ContinueOnError)
+	cfg.register(fs)
+	output := fs.String("output", report.FormatTable, "format of the transitions, either 'table' or 'json'")
+	limit := fs.Int("limit", 0, "maximum number of transitions to list, 0 for no limit")
+
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	s, err := cfg.newScheduler()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to set up scheduler")
+		return ExitUsage
+	}
+	defer cfg.close()
+
+	s.Options.DryRun = true
+
+	runReport, err := s.Run(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to assess instances")
+		return ExitFailure
+	}
+
+	if err := runReport.WriteTransitions(os.Stdout, *output, *limit); err != nil {
+		log.Error().Err(err).Msg("Failed to write transitions")
+		return ExitUsage
+	}
+
+	return exitCode(runReport)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"instancescheduler/internal/notify"
+)
+
+// smtpPasswordEnv is the environment variable holding the SMTP password, so that it is not passed on
+// the command line
+const smtpPasswordEnv = "INSTANCESCHEDULER_SMTP_PASSWORD"
+
+// notifyConfig holds the flags for warning owners ahead of their instances being stopped
+type notifyConfig struct {
+	warnBefore   time.Duration
+	webhookURL   string
+	chatURL      string
+	smtpAddr     string
+	smtpFrom     string
+	smtpTo       string
+	smtpUsername string
+	snoozeURL    string
+}
+
+func (c *notifyConfig) register(fs *flag.FlagSet) {
+	fs.DurationVar(&c.warnBefore, "warn-before", 0, "how long before a stop the instance's owner is warned, 0 for no warnings")
+	fs.StringVar(&c.webhookURL, "notify-webhook", "", "URL warnings are posted to as JSON")
+	fs.StringVar(&c.chatURL, "notify-chat", "", "Microsoft Teams or Slack incoming webhook URL warnings are posted to")
+	fs.StringVar(&c.smtpAddr, "smtp-addr", "", "host:port of the mail server warnings are emailed through")
+	fs.StringVar(&c.smtpFrom, "smtp-from", "", "address warning emails are sent from")
+	fs.StringVar(&c.smtpTo, "smtp-to", "", "address warnings are emailed to when the owner is not an email address")
+	fs.StringVar(&c.smtpUsername, "smtp-username", "",
+		"username for the mail server, the password is read from "+smtpPasswordEnv)
+	fs.StringVar(&c.snoozeURL, "snooze-url", "",
+		"template of the snooze link included in warnings, such as 'https://example.com/snooze?id={{.InstanceID}}'")
+}
+
+// newWarner returns the warner for the configured notifiers, or nil when warnings are disabled
+func (c *notifyConfig) newWarner(ownerTag string) (*notify.Warner, error) {
+	var notifiers notify.Notifiers
+
+	if c.warnBefore <= 0 {
+		return nil, nil
+	}
+
+	if c.webhookURL != "" {
+		notifiers = append(notifiers, &notify.Webhook{URL: c.webhookURL})
+	}
+
+	if c.chatURL != "" {
+		notifiers = append(notifiers, &notify.Chat{URL: c.chatURL})
+	}
+
+	if c.smtpAddr != "" {
+		if c.smtpFrom == "" {
+			return nil, errors.New("-smtp-from is required with -smtp-addr")
+		}
+
+		notifiers = append(notifiers, &notify.SMTP{
+			Addr:     c.smtpAddr,
+			From:     c.smtpFrom,
+			To:       c.smtpTo,
+			Username: c.smtpUsername,
+			Password: os.Getenv(smtpPasswordEnv),
+		})
+	}
+
+	if len(notifiers) == 0 {
+		return nil, notify.ErrNoNotifier
+	}
+
+	warner := &notify.Warner{Before: c.warnBefore, OwnerTag: ownerTag, Notifier: notifiers}
+
+	if c.snoozeURL != "" {
+		snoozeURL, err := notify.ParseSnoozeURL(c.snoozeURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snooze URL: %w", err)
+		}
+
+		warner.SnoozeURL = snoozeURL
+	}
+
+	return warner, nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"instancescheduler/internal/report"
+	"instancescheduler/internal/savings"
+
+	"github.com/rs/zerolog/log"
+)
+
+func runReport(ctx context.Context, args []string) int {
+	if len(args) > 0 && args[0] == "savings" {
+		return runSavings(ctx, args[1:])
+	}
+
+	fmt.Fprintln(os.Stderr, "Usage: instancescheduler report savings [flags]")
+
+	return ExitUsage
+}
+
+func runSavings(ctx context.Context, args []string) int {
+	var cfg azureConfig
+
+	fs := flag.NewFlagSet("report savings", flag.ContinueOnError)
+	cfg.register(fs)
+	output := fs.String("output", report.FormatTable, "format of the report, one of 'table', 'json', 'csv' or 'markdown'")
+	pricesPath := fs.String("prices", "./prices.yaml", "path for the price table of hourly prices by VM size and region")
+	refresh := fs.Bool("refresh-prices", false,
+		"fetch the price of every VM size and region in scope from the Azure retail prices API into the price table")
+	currency := fs.String("currency", "", "currency prices are refreshed in, the price table's currency or USD when unset")
+
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	s, err := cfg.newScheduler()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to set up scheduler")
+		return ExitUsage
+	}
+	defer cfg.close()
+
+	prices, err := savings.LoadPrices(*pricesPath)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load price table")
+		return ExitUsage
+	}
+
+	instances, failures, err := s.Inventory(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list instances")
+		return ExitFailure
+	}
+
+	for _, failure := range failures {
+		log.Error().Err(failure.Err).Str("subscription", failure.SubscriptionID).Msg("Subscription failed")
+	}
+
+	if *refresh {
+		// prices in another currency cannot be mixed with the refreshed ones
+		refreshed := prices
+		if *currency != "" && !strings.EqualFold(*currency, prices.Currency) {
+			refreshed = &savings.PriceTable{Currency: strings.ToUpper(*currency)}
+		}
+
+		// the table is left unchanged when the API cannot be reached, so the local prices are used
+		missing, err := refreshed.Refresh(ctx, &http.Client{Timeout: 30 * time.Second}, savings.RetailPricesURL,
+			savings.Keys(s.Tags, instances))
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to refresh prices, using the local price table")
+		} else {
+			for _, key := range missing {
+				log.Warn().Str("size", key.Size).Str("region", key.Region).Msg("No retail price found")
+			}
+
+			if err := refreshed.Save(*pricesPath); err != nil {
+				log.Error().Err(err).Msg("Failed to save price table")
+				return ExitFailure
+			}
+
+			prices = refreshed
+		}
+	}
+
+	savingsReport := savings.Estimate(s.Tags, instances, prices, cfg.ownerTag)
+
+	if err := savingsReport.Write(os.Stdout, *output); err != nil {
+		log.Error().Err(err).Msg("Failed to write savings report")
+		return ExitUsage
+	}
+
+	if len(failures) > 0 {
+		return ExitFailure
+	}
+
+	return ExitOK
+}
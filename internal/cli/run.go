@@ -0,0 +1,157 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"os"
+	"time"
+
+	"instancescheduler/internal/metrics"
+	"instancescheduler/internal/report"
+
+	"github.com/rs/zerolog/log"
+)
+
+func runPlan(ctx context.Context, args []string) int {
+	var cfg azureConfig
+
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	cfg.register(fs)
+	output := fs.String("output", report.FormatTable, "format of the plan, either 'table' or 'json'")
+
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	s, err := cfg.newScheduler()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to set up scheduler")
+		return ExitUsage
+	}
+	defer cfg.close()
+
+	s.Options.DryRun = true
+
+	runReport, err := s.Run(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Plan failed")
+		return ExitFailure
+	}
+
+	runReport.Log()
+
+	if err := runReport.WritePlan(os.Stdout, *output); err != nil {
+		log.Error().Err(err).Msg("Failed to write plan")
+		return ExitUsage
+	}
+
+	return exitCode(runReport)
+}
+
+func runApply(ctx context.Context, args []string) int {
+	var cfg azureConfig
+
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	cfg.register(fs)
+	noWait := fs.Bool("no-wait", false,
+		"issue power actions without waiting for them to finish, they are checked on by the next run")
+
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	s, err := cfg.newScheduler()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to set up scheduler")
+		return ExitUsage
+	}
+	defer cfg.close()
+
+	s.Options.NoWait = *noWait
+
+	runReport, err := s.Run(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Run failed")
+		return ExitFailure
+	}
+
+	runReport.Log()
+
+	return exitCode(runReport)
+}
+
+func runServe(ctx context.Context, args []string) int {
+	var cfg azureConfig
+	var apiCfg apiConfig
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	cfg.register(fs)
+	interval := fs.Duration("interval", 15*time.Minute,
+		"time between reconciles, runs happen sooner for schedule transitions")
+	noWait := fs.Bool("no-wait", false,
+		"issue power actions without waiting for them to finish, they are checked on by the next reconcile")
+	dryRun := fs.Bool("dry-run", false, "log the planned action for every instance without starting or stopping any")
+	metricsAddr := fs.String("metrics-addr", "",
+		"address to serve Prometheus metrics on at '/metrics', such as ':9090', no metrics are served when unset")
+	apiCfg.register(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	s, err := cfg.newScheduler()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to set up scheduler")
+		return ExitUsage
+	}
+	defer cfg.close()
+
+	s.Options.NoWait = *noWait
+	s.Options.DryRun = *dryRun
+
+	server, err := apiCfg.newServer(s, *dryRun)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to set up API")
+		return ExitUsage
+	}
+
+	if *metricsAddr != "" {
+		s.Options.Metrics = metrics.New()
+
+		go func() {
+			if err := s.Options.Metrics.Serve(ctx, *metricsAddr); err != nil {
+				log.Error().Err(err).Msg("Metrics server failed")
+			}
+		}()
+	}
+
+	if server != nil {
+		go func() {
+			if err := server.Serve(ctx, apiCfg.addr); err != nil {
+				log.Error().Err(err).Msg("API server failed")
+			}
+		}()
+	}
+
+	s.Serve(ctx, *interval)
+
+	return ExitOK
+}
+
+func exitCode(runReport *report.Report) int {
+	if runReport.HasFailures() {
+		return ExitFailure
+	}
+
+	return ExitOK
+}
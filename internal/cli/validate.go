@@ -0,0 +1,94 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"instancescheduler/internal/azure"
+	"instancescheduler/internal/validate"
+
+	"github.com/rs/zerolog/log"
+)
+
+func runValidate(ctx context.Context, args []string) int {
+	var cfg config
+	var values azure.TagValues
+
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	cfg.register(fs)
+	fs.StringVar(&values.Schedule, "schedule", "", "schedule tag value to validate")
+	fs.StringVar(&values.PatchWindow, "patch-window", "", "patch window tag value to validate")
+	fs.StringVar(&values.StopMode, "stop-mode", "", "stop mode tag value to validate")
+	fs.StringVar(&values.OverrideUntil, "override-until", "", "override tag value to validate")
+	fs.StringVar(&values.SnoozeUntil, "snooze-until", "", "snooze tag value to validate")
+	tagsFile := fs.String("file", "", "JSON object of an instance's tags to validate, '-' reads from stdin")
+
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	tags, err := cfg.loadTags()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load tags config")
+		return ExitUsage
+	}
+
+	if *tagsFile != "" {
+		values, err = readTagValues(tags, *tagsFile)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to read tags")
+			return ExitUsage
+		}
+	}
+
+	problems := validate.Values(tags, values)
+
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stdout, "%s: %s\n", problem.Tag, problem.Message)
+	}
+
+	if len(problems) > 0 {
+		return ExitFailure
+	}
+
+	fmt.Fprintln(os.Stdout, "Tags are valid")
+
+	return ExitOK
+}
+
+// readTagValues reads a JSON object of tag names to values, as shown for a resource in the portal or
+// by `az vm show --query tags`, and picks out the scheduler's values
+func readTagValues(tags *azure.Tags, path string) (azure.TagValues, error) {
+	var data []byte
+	var err error
+	var instanceTags map[string]*string
+
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return azure.TagValues{}, err
+	}
+
+	if err := json.Unmarshal(data, &instanceTags); err != nil {
+		return azure.TagValues{}, err
+	}
+
+	return tags.LoadValues(instanceTags), nil
+}
@@ -0,0 +1,236 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package decision
+
+import (
+	"time"
+
+	"instancescheduler/internal/override"
+	"instancescheduler/internal/report"
+)
+
+// Reason is a machine readable code for why a decision was made
+type Reason string
+
+const (
+	ReasonOutsideSchedule         Reason = "outside-schedule"
+	ReasonWithinSchedule          Reason = "within-schedule"
+	ReasonPatchWindowPreStart     Reason = "patch-window-pre-start"
+	ReasonStoppedAllocated        Reason = "stopped-allocated"
+	ReasonPatchWindowKeepsRunning Reason = "patch-window-keeps-running"
+	ReasonAlreadyInDesiredState   Reason = "already-in-desired-state"
+	ReasonOverrideRunning         Reason = "override-keep-running"
+	ReasonOverrideStopped         Reason = "override-keep-stopped"
+	ReasonManualChange            Reason = "manual-change"
+	ReasonMinimumUptime           Reason = "minimum-uptime"
+	ReasonMinimumDowntime         Reason = "minimum-downtime"
+	ReasonCooldown                Reason = "cooldown"
+	ReasonSnoozed                 Reason = "snoozed"
+)
+
+// Description returns a human readable description of the reason
+func (r Reason) Description() string {
+	switch r {
+	case ReasonOutsideSchedule:
+		return "Instance is running outside of its schedule"
+	case ReasonWithinSchedule:
+		return "Instance is not running within its schedule"
+	case ReasonPatchWindowPreStart:
+		return "Instance is within 1 hour of the patch window"
+	case ReasonStoppedAllocated:
+		return "Instance is stopped but still allocated outside of its schedule"
+	case ReasonPatchWindowKeepsRunning:
+		return "Instance is kept running for its patch window"
+	case ReasonAlreadyInDesiredState:
+		return "No action required"
+	case ReasonOverrideRunning:
+		return "Instance is kept running by its override tag"
+	case ReasonOverrideStopped:
+		return "Instance is kept stopped by its override tag"
+	case ReasonManualChange:
+		return "Instance's power state was changed manually and is left alone"
+	case ReasonMinimumUptime:
+		return "Instance has not been running for its minimum uptime"
+	case ReasonMinimumDowntime:
+		return "Instance has not been stopped for its minimum downtime"
+	case ReasonCooldown:
+		return "Instance was actioned the opposite way too recently"
+	case ReasonSnoozed:
+		return "Instance's owner has snoozed its stop"
+	default:
+		return string(r)
+	}
+}
+
+const (
+	RuleStopOutsideSchedule = "stop-outside-schedule"
+	RuleStartWithinSchedule = "start-within-schedule"
+	RuleStartPatchWindow    = "start-patch-window"
+	RuleDeallocateStopped   = "deallocate-stopped"
+	RuleNoActionRequired    = "no-action-required"
+	RuleOverrideStart       = "override-start"
+	RuleOverrideStop        = "override-stop"
+	RuleSuppressed          = "suppressed"
+)
+
+// Limits stop an instance from flapping between started and stopped
+type Limits struct {
+	// MinimumUptime is how long an instance must have been running before it is stopped
+	MinimumUptime time.Duration
+	// MinimumDowntime is how long an instance must have been stopped before it is started
+	MinimumDowntime time.Duration
+	// Cooldown is how long after an action the opposite action is suppressed
+	Cooldown time.Duration
+}
+
+// Input is everything needed to decide the desired power state of an instance
+type Input struct {
+	// Running is true when the instance is running or starting
+	Running bool
+	// StoppedAllocated is true when the instance is stopped but its compute is still allocated
+	StoppedAllocated bool
+	// ShouldShutdown is true when the schedule wants the instance off
+	ShouldShutdown bool
+	// WithinPatchWindow is true when the patch window protects the instance from being shutdown
+	WithinPatchWindow bool
+	// WithinPreStart is true from an hour before the patch window starts until it ends
+	WithinPreStart bool
+	// Deallocates is true when the instance's stop mode releases its compute
+	Deallocates bool
+	// NextTransition is the next time the schedule or patch window changes the desired state
+	NextTransition time.Time
+	// Override is the state an active override tag keeps the instance in, it is empty when there is
+	// no active override
+	Override override.State
+	// RespectManualChange is true when the instance's power state was changed manually and should be
+	// left alone
+	RespectManualChange bool
+	// Now is when the decision is made, it is only needed to apply the limits
+	Now time.Time
+	// StateSince is when the instance entered its current power state, it is the zero time when it
+	// is not known and the minimum uptime and downtime are not applied
+	StateSince time.Time
+	// LastAction and LastActionAt are the last action the scheduler took on the instance
+	LastAction   report.Action
+	LastActionAt time.Time
+	Limits       Limits
+	// SnoozedUntil is when the owner's snooze of the instance's stop ends, a stop is suppressed
+	// until then
+	SnoozedUntil time.Time
+}
+
+// Decision is the action to take for an instance, along with why it was chosen
+type Decision struct {
+	Action         report.Action
+	Reason         Reason
+	Rule           string
+	NextTransition time.Time
+	// Suppressed is the action the rules chose that the limits stopped, along with the rule that
+	// chose it
+	Suppressed     report.Action
+	SuppressedRule string
+}
+
+// Evaluate decides whether an instance should be stopped, started or left alone. An active
+// override takes precedence over the schedule and patch window: `override-start` starts an instance
+// kept running, `override-stop` stops, or deallocates, an instance kept stopped. A respected manual
+// change comes next and leaves the instance alone. Otherwise the rules are checked in order and the
+// first to match wins:
+//
+//  1. `stop-outside-schedule` – running while the schedule wants it off, and not protected by
+//     the patch window
+//  2. `start-within-schedule` – not running while the schedule wants it on
+//  3. `start-patch-window` – not running within an hour of, or during, the patch window
+//  4. `deallocate-stopped` – stopped but still allocated while the schedule wants it off, the stop
+//     mode deallocates, and not protected by the patch window
+//  5. `no-action-required` – otherwise
+//
+// A start or stop chosen by these rules is then suppressed, under the rule `suppressed`, when the
+// instance has not been in its power state for the minimum uptime or downtime, or was actioned the
+// opposite way within the cooldown, or when a stop has been snoozed. Overrides are never suppressed.
+func Evaluate(input Input) Decision {
+	decision := Decision{
+		Action:         report.ActionNone,
+		Rule:           RuleNoActionRequired,
+		Reason:         ReasonAlreadyInDesiredState,
+		NextTransition: input.NextTransition,
+	}
+
+	switch input.Override {
+	case override.StateRunning:
+		decision.Reason = ReasonOverrideRunning
+		if !input.Running {
+			decision.Action, decision.Rule = report.ActionStart, RuleOverrideStart
+		}
+
+		return decision
+	case override.StateStopped:
+		decision.Reason = ReasonOverrideStopped
+		if input.Running || (input.StoppedAllocated && input.Deallocates) {
+			decision.Action, decision.Rule = report.ActionStop, RuleOverrideStop
+		}
+
+		return decision
+	}
+
+	if input.RespectManualChange {
+		decision.Reason = ReasonManualChange
+		return decision
+	}
+
+	switch {
+	case input.ShouldShutdown && input.Running && !input.WithinPatchWindow:
+		decision.Action, decision.Rule, decision.Reason = report.ActionStop, RuleStopOutsideSchedule, ReasonOutsideSchedule
+	case !input.ShouldShutdown && !input.Running:
+		decision.Action, decision.Rule, decision.Reason = report.ActionStart, RuleStartWithinSchedule, ReasonWithinSchedule
+	case input.WithinPreStart && !input.Running:
+		decision.Action, decision.Rule, decision.Reason = report.ActionStart, RuleStartPatchWindow, ReasonPatchWindowPreStart
+	case input.ShouldShutdown && input.StoppedAllocated && input.Deallocates && !input.WithinPatchWindow:
+		decision.Action, decision.Rule, decision.Reason = report.ActionStop, RuleDeallocateStopped, ReasonStoppedAllocated
+	case input.ShouldShutdown && input.Running && input.WithinPatchWindow:
+		decision.Reason = ReasonPatchWindowKeepsRunning
+	}
+
+	if reason := suppress(input, decision.Action); reason != "" {
+		decision.Suppressed, decision.SuppressedRule = decision.Action, decision.Rule
+		decision.Action, decision.Rule, decision.Reason = report.ActionNone, RuleSuppressed, reason
+	}
+
+	return decision
+}
+
+// suppress returns why the limits stop an action, or an empty reason when they do not
+func suppress(input Input, action report.Action) Reason {
+	switch action {
+	case report.ActionStop:
+		if input.Now.Before(input.SnoozedUntil) {
+			return ReasonSnoozed
+		}
+
+		if input.Running && !input.StateSince.IsZero() && input.Now.Sub(input.StateSince) < input.Limits.MinimumUptime {
+			return ReasonMinimumUptime
+		}
+
+		if input.LastAction == report.ActionStart && input.Now.Sub(input.LastActionAt) < input.Limits.Cooldown {
+			return ReasonCooldown
+		}
+	case report.ActionStart:
+		if !input.StateSince.IsZero() && input.Now.Sub(input.StateSince) < input.Limits.MinimumDowntime {
+			return ReasonMinimumDowntime
+		}
+
+		if input.LastAction == report.ActionStop && input.Now.Sub(input.LastActionAt) < input.Limits.Cooldown {
+			return ReasonCooldown
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,326 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package decision
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"instancescheduler/internal/override"
+	"instancescheduler/internal/report"
+)
+
+const (
+	running     = "running"
+	stopped     = "stopped"
+	deallocated = "deallocated"
+)
+
+// TestEvaluate covers every combination of power state and boolean input
+func TestEvaluate(t *testing.T) {
+	testCases := []struct {
+		power             string
+		shouldShutdown    bool
+		withinPatchWindow bool
+		withinPreStart    bool
+		deallocates       bool
+		want              Decision
+	}{
+		{power: running, shouldShutdown: false, withinPatchWindow: false, withinPreStart: false, deallocates: false,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonAlreadyInDesiredState}},
+		{power: running, shouldShutdown: false, withinPatchWindow: false, withinPreStart: false, deallocates: true,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonAlreadyInDesiredState}},
+		{power: running, shouldShutdown: false, withinPatchWindow: false, withinPreStart: true, deallocates: false,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonAlreadyInDesiredState}},
+		{power: running, shouldShutdown: false, withinPatchWindow: false, withinPreStart: true, deallocates: true,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonAlreadyInDesiredState}},
+		{power: running, shouldShutdown: false, withinPatchWindow: true, withinPreStart: false, deallocates: false,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonAlreadyInDesiredState}},
+		{power: running, shouldShutdown: false, withinPatchWindow: true, withinPreStart: false, deallocates: true,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonAlreadyInDesiredState}},
+		{power: running, shouldShutdown: false, withinPatchWindow: true, withinPreStart: true, deallocates: false,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonAlreadyInDesiredState}},
+		{power: running, shouldShutdown: false, withinPatchWindow: true, withinPreStart: true, deallocates: true,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonAlreadyInDesiredState}},
+		{power: running, shouldShutdown: true, withinPatchWindow: false, withinPreStart: false, deallocates: false,
+			want: Decision{Action: report.ActionStop, Rule: RuleStopOutsideSchedule, Reason: ReasonOutsideSchedule}},
+		{power: running, shouldShutdown: true, withinPatchWindow: false, withinPreStart: false, deallocates: true,
+			want: Decision{Action: report.ActionStop, Rule: RuleStopOutsideSchedule, Reason: ReasonOutsideSchedule}},
+		{power: running, shouldShutdown: true, withinPatchWindow: false, withinPreStart: true, deallocates: false,
+			want: Decision{Action: report.ActionStop, Rule: RuleStopOutsideSchedule, Reason: ReasonOutsideSchedule}},
+		{power: running, shouldShutdown: true, withinPatchWindow: false, withinPreStart: true, deallocates: true,
+			want: Decision{Action: report.ActionStop, Rule: RuleStopOutsideSchedule, Reason: ReasonOutsideSchedule}},
+		{power: running, shouldShutdown: true, withinPatchWindow: true, withinPreStart: false, deallocates: false,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonPatchWindowKeepsRunning}},
+		{power: running, shouldShutdown: true, withinPatchWindow: true, withinPreStart: false, deallocates: true,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonPatchWindowKeepsRunning}},
+		{power: running, shouldShutdown: true, withinPatchWindow: true, withinPreStart: true, deallocates: false,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonPatchWindowKeepsRunning}},
+		{power: running, shouldShutdown: true, withinPatchWindow: true, withinPreStart: true, deallocates: true,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonPatchWindowKeepsRunning}},
+		{power: stopped, shouldShutdown: false, withinPatchWindow: false, withinPreStart: false, deallocates: false,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule}},
+		{power: stopped, shouldShutdown: false, withinPatchWindow: false, withinPreStart: false, deallocates: true,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule}},
+		{power: stopped, shouldShutdown: false, withinPatchWindow: false, withinPreStart: true, deallocates: false,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule}},
+		{power: stopped, shouldShutdown: false, withinPatchWindow: false, withinPreStart: true, deallocates: true,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule}},
+		{power: stopped, shouldShutdown: false, withinPatchWindow: true, withinPreStart: false, deallocates: false,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule}},
+		{power: stopped, shouldShutdown: false, withinPatchWindow: true, withinPreStart: false, deallocates: true,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule}},
+		{power: stopped, shouldShutdown: false, withinPatchWindow: true, withinPreStart: true, deallocates: false,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule}},
+		{power: stopped, shouldShutdown: false, withinPatchWindow: true, withinPreStart: true, deallocates: true,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule}},
+		{power: stopped, shouldShutdown: true, withinPatchWindow: false, withinPreStart: false, deallocates: false,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonAlreadyInDesiredState}},
+		{power: stopped, shouldShutdown: true, withinPatchWindow: false, withinPreStart: false, deallocates: true,
+			want: Decision{Action: report.ActionStop, Rule: RuleDeallocateStopped, Reason: ReasonStoppedAllocated}},
+		{power: stopped, shouldShutdown: true, withinPatchWindow: false, withinPreStart: true, deallocates: false,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartPatchWindow, Reason: ReasonPatchWindowPreStart}},
+		{power: stopped, shouldShutdown: true, withinPatchWindow: false, withinPreStart: true, deallocates: true,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartPatchWindow, Reason: ReasonPatchWindowPreStart}},
+		{power: stopped, shouldShutdown: true, withinPatchWindow: true, withinPreStart: false, deallocates: false,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonAlreadyInDesiredState}},
+		{power: stopped, shouldShutdown: true, withinPatchWindow: true, withinPreStart: false, deallocates: true,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonAlreadyInDesiredState}},
+		{power: stopped, shouldShutdown: true, withinPatchWindow: true, withinPreStart: true, deallocates: false,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartPatchWindow, Reason: ReasonPatchWindowPreStart}},
+		{power: stopped, shouldShutdown: true, withinPatchWindow: true, withinPreStart: true, deallocates: true,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartPatchWindow, Reason: ReasonPatchWindowPreStart}},
+		{power: deallocated, shouldShutdown: false, withinPatchWindow: false, withinPreStart: false, deallocates: false,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule}},
+		{power: deallocated, shouldShutdown: false, withinPatchWindow: false, withinPreStart: false, deallocates: true,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule}},
+		{power: deallocated, shouldShutdown: false, withinPatchWindow: false, withinPreStart: true, deallocates: false,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule}},
+		{power: deallocated, shouldShutdown: false, withinPatchWindow: false, withinPreStart: true, deallocates: true,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule}},
+		{power: deallocated, shouldShutdown: false, withinPatchWindow: true, withinPreStart: false, deallocates: false,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule}},
+		{power: deallocated, shouldShutdown: false, withinPatchWindow: true, withinPreStart: false, deallocates: true,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule}},
+		{power: deallocated, shouldShutdown: false, withinPatchWindow: true, withinPreStart: true, deallocates: false,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule}},
+		{power: deallocated, shouldShutdown: false, withinPatchWindow: true, withinPreStart: true, deallocates: true,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule}},
+		{power: deallocated, shouldShutdown: true, withinPatchWindow: false, withinPreStart: false, deallocates: false,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonAlreadyInDesiredState}},
+		{power: deallocated, shouldShutdown: true, withinPatchWindow: false, withinPreStart: false, deallocates: true,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonAlreadyInDesiredState}},
+		{power: deallocated, shouldShutdown: true, withinPatchWindow: false, withinPreStart: true, deallocates: false,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartPatchWindow, Reason: ReasonPatchWindowPreStart}},
+		{power: deallocated, shouldShutdown: true, withinPatchWindow: false, withinPreStart: true, deallocates: true,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartPatchWindow, Reason: ReasonPatchWindowPreStart}},
+		{power: deallocated, shouldShutdown: true, withinPatchWindow: true, withinPreStart: false, deallocates: false,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonAlreadyInDesiredState}},
+		{power: deallocated, shouldShutdown: true, withinPatchWindow: true, withinPreStart: false, deallocates: true,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonAlreadyInDesiredState}},
+		{power: deallocated, shouldShutdown: true, withinPatchWindow: true, withinPreStart: true, deallocates: false,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartPatchWindow, Reason: ReasonPatchWindowPreStart}},
+		{power: deallocated, shouldShutdown: true, withinPatchWindow: true, withinPreStart: true, deallocates: true,
+			want: Decision{Action: report.ActionStart, Rule: RuleStartPatchWindow, Reason: ReasonPatchWindowPreStart}},
+	}
+
+	nextTransition := time.Date(2026, time.October, 19, 17, 0, 0, 0, time.UTC)
+
+	for _, test := range testCases {
+		name := fmt.Sprintf("%s/shutdown=%t/patch=%t/prestart=%t/deallocates=%t", test.power, test.shouldShutdown,
+			test.withinPatchWindow, test.withinPreStart, test.deallocates)
+
+		t.Run(name, func(t *testing.T) {
+			got := Evaluate(Input{
+				Running:           test.power == running,
+				StoppedAllocated:  test.power == stopped,
+				ShouldShutdown:    test.shouldShutdown,
+				WithinPatchWindow: test.withinPatchWindow,
+				WithinPreStart:    test.withinPreStart,
+				Deallocates:       test.deallocates,
+				NextTransition:    nextTransition,
+			})
+
+			test.want.NextTransition = nextTransition
+
+			if got != test.want {
+				t.Errorf("got: %+v, want: %+v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestEvaluateOverride covers an active override against every power state, checking it takes
+// precedence over the schedule and patch window
+func TestEvaluateOverride(t *testing.T) {
+	testCases := []struct {
+		power       string
+		override    override.State
+		deallocates bool
+		want        Decision
+	}{
+		{power: running, override: override.StateRunning, deallocates: true,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonOverrideRunning}},
+		{power: stopped, override: override.StateRunning, deallocates: true,
+			want: Decision{Action: report.ActionStart, Rule: RuleOverrideStart, Reason: ReasonOverrideRunning}},
+		{power: deallocated, override: override.StateRunning, deallocates: true,
+			want: Decision{Action: report.ActionStart, Rule: RuleOverrideStart, Reason: ReasonOverrideRunning}},
+		{power: running, override: override.StateStopped, deallocates: true,
+			want: Decision{Action: report.ActionStop, Rule: RuleOverrideStop, Reason: ReasonOverrideStopped}},
+		{power: running, override: override.StateStopped, deallocates: false,
+			want: Decision{Action: report.ActionStop, Rule: RuleOverrideStop, Reason: ReasonOverrideStopped}},
+		{power: stopped, override: override.StateStopped, deallocates: true,
+			want: Decision{Action: report.ActionStop, Rule: RuleOverrideStop, Reason: ReasonOverrideStopped}},
+		{power: stopped, override: override.StateStopped, deallocates: false,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonOverrideStopped}},
+		{power: deallocated, override: override.StateStopped, deallocates: true,
+			want: Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonOverrideStopped}},
+	}
+
+	for _, test := range testCases {
+		for _, shouldShutdown := range []bool{false, true} {
+			for _, withinPatchWindow := range []bool{false, true} {
+				name := fmt.Sprintf("%s/override=%s/deallocates=%t/shutdown=%t/patch=%t", test.power, test.override,
+					test.deallocates, shouldShutdown, withinPatchWindow)
+
+				t.Run(name, func(t *testing.T) {
+					got := Evaluate(Input{
+						Running:           test.power == running,
+						StoppedAllocated:  test.power == stopped,
+						ShouldShutdown:    shouldShutdown,
+						WithinPatchWindow: withinPatchWindow,
+						WithinPreStart:    withinPatchWindow,
+						Deallocates:       test.deallocates,
+						Override:          test.override,
+					})
+
+					if got != test.want {
+						t.Errorf("got: %+v, want: %+v", got, test.want)
+					}
+				})
+			}
+		}
+	}
+}
+
+// TestEvaluateManualChange checks a respected manual change leaves every instance alone, unless an
+// override is active
+func TestEvaluateManualChange(t *testing.T) {
+	for _, power := range []string{running, stopped, deallocated} {
+		for _, shouldShutdown := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/shutdown=%t", power, shouldShutdown), func(t *testing.T) {
+				got := Evaluate(Input{
+					Running:             power == running,
+					StoppedAllocated:    power == stopped,
+					ShouldShutdown:      shouldShutdown,
+					Deallocates:         true,
+					RespectManualChange: true,
+				})
+
+				want := Decision{Action: report.ActionNone, Rule: RuleNoActionRequired, Reason: ReasonManualChange}
+
+				if got != want {
+					t.Errorf("got: %+v, want: %+v", got, want)
+				}
+			})
+		}
+	}
+
+	got := Evaluate(Input{Override: override.StateRunning, RespectManualChange: true})
+	if got.Action != report.ActionStart || got.Rule != RuleOverrideStart {
+		t.Errorf("got: %+v, want: %v", got, RuleOverrideStart)
+	}
+}
+
+// TestEvaluateLimits checks starts and stops are suppressed by the minimum uptime, minimum downtime
+// and cooldown
+func TestEvaluateLimits(t *testing.T) {
+	now := time.Date(2026, time.October, 19, 17, 0, 0, 0, time.UTC)
+	limits := Limits{MinimumUptime: time.Hour, MinimumDowntime: 30 * time.Minute, Cooldown: 15 * time.Minute}
+
+	testCases := []struct {
+		name  string
+		input Input
+		want  Decision
+	}{
+		{
+			name:  "stop after minimum uptime",
+			input: Input{Running: true, ShouldShutdown: true, StateSince: now.Add(-2 * time.Hour)},
+			want:  Decision{Action: report.ActionStop, Rule: RuleStopOutsideSchedule, Reason: ReasonOutsideSchedule},
+		},
+		{
+			name:  "stop within minimum uptime",
+			input: Input{Running: true, ShouldShutdown: true, StateSince: now.Add(-10 * time.Minute)},
+			want: Decision{Action: report.ActionNone, Rule: RuleSuppressed, Reason: ReasonMinimumUptime,
+				Suppressed: report.ActionStop, SuppressedRule: RuleStopOutsideSchedule},
+		},
+		{
+			name:  "stop with unknown uptime",
+			input: Input{Running: true, ShouldShutdown: true},
+			want:  Decision{Action: report.ActionStop, Rule: RuleStopOutsideSchedule, Reason: ReasonOutsideSchedule},
+		},
+		{
+			name:  "start within minimum downtime",
+			input: Input{WithinPreStart: true, ShouldShutdown: true, StateSince: now.Add(-5 * time.Minute)},
+			want: Decision{Action: report.ActionNone, Rule: RuleSuppressed, Reason: ReasonMinimumDowntime,
+				Suppressed: report.ActionStart, SuppressedRule: RuleStartPatchWindow},
+		},
+		{
+			name: "stop within cooldown of a start",
+			input: Input{Running: true, ShouldShutdown: true, LastAction: report.ActionStart,
+				LastActionAt: now.Add(-5 * time.Minute)},
+			want: Decision{Action: report.ActionNone, Rule: RuleSuppressed, Reason: ReasonCooldown,
+				Suppressed: report.ActionStop, SuppressedRule: RuleStopOutsideSchedule},
+		},
+		{
+			name: "stop within cooldown of a stop",
+			input: Input{Running: true, ShouldShutdown: true, LastAction: report.ActionStop,
+				LastActionAt: now.Add(-5 * time.Minute)},
+			want: Decision{Action: report.ActionStop, Rule: RuleStopOutsideSchedule, Reason: ReasonOutsideSchedule},
+		},
+		{
+			name: "start after cooldown",
+			input: Input{LastAction: report.ActionStop, LastActionAt: now.Add(-time.Hour),
+				StateSince: now.Add(-time.Hour)},
+			want: Decision{Action: report.ActionStart, Rule: RuleStartWithinSchedule, Reason: ReasonWithinSchedule},
+		},
+		{
+			name:  "stop while snoozed",
+			input: Input{Running: true, ShouldShutdown: true, SnoozedUntil: now.Add(30 * time.Minute)},
+			want: Decision{Action: report.ActionNone, Rule: RuleSuppressed, Reason: ReasonSnoozed,
+				Suppressed: report.ActionStop, SuppressedRule: RuleStopOutsideSchedule},
+		},
+		{
+			name:  "stop once snooze ends",
+			input: Input{Running: true, ShouldShutdown: true, SnoozedUntil: now.Add(-time.Minute)},
+			want:  Decision{Action: report.ActionStop, Rule: RuleStopOutsideSchedule, Reason: ReasonOutsideSchedule},
+		},
+		{
+			name: "override is not suppressed",
+			input: Input{Override: override.StateRunning, LastAction: report.ActionStop,
+				LastActionAt: now.Add(-time.Minute), StateSince: now.Add(-time.Minute)},
+			want: Decision{Action: report.ActionStart, Rule: RuleOverrideStart, Reason: ReasonOverrideRunning},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			test.input.Now, test.input.Limits, test.input.Deallocates = now, limits, true
+
+			got := Evaluate(test.input)
+
+			if got != test.want {
+				t.Errorf("got: %+v, want: %+v", got, test.want)
+			}
+		})
+	}
+}
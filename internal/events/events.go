@@ -0,0 +1,87 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Types of the events emitted for each instance
+const (
+	// TypeActionAttempted is emitted before a start or stop is sent
+	TypeActionAttempted = "com.instancescheduler.action.attempted"
+	// TypeInstanceStarted is emitted once an instance has been started, by the run that checks on the
+	// start when the scheduler does not wait for it
+	TypeInstanceStarted = "com.instancescheduler.instance.started"
+	// TypeInstanceStopped is emitted once an instance has been stopped, by the run that checks on the
+	// stop when the scheduler does not wait for it
+	TypeInstanceStopped = "com.instancescheduler.instance.stopped"
+	// TypeActionFailed is emitted when an instance could not be assessed or actioned
+	TypeActionFailed = "com.instancescheduler.action.failed"
+	// TypeActionSkipped is emitted when the schedule wanted an action that was held back, such as by
+	// the patch window or a snooze. The `reason` extension holds the reason code.
+	TypeActionSkipped = "com.instancescheduler.action.skipped"
+)
+
+// specVersion is the version of the CloudEvents specification events conform to
+const specVersion = "1.0"
+
+// Event is a CloudEvent in the structured JSON format
+type Event struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	// Reason is an extension attribute holding the reason code of the decision
+	Reason string `json:"reason,omitempty"`
+	Data   Data   `json:"data"`
+}
+
+// Data is the payload of every event, describing the instance and what happened to it
+type Data struct {
+	InstanceID     string            `json:"instanceId"`
+	SubscriptionID string            `json:"subscriptionId"`
+	ResourceGroup  string            `json:"resourceGroup"`
+	Instance       string            `json:"instance"`
+	Tags           map[string]string `json:"tags,omitempty"`
+	Action         string            `json:"action,omitempty"`
+	Reason         string            `json:"reason,omitempty"`
+	PowerState     string            `json:"powerState,omitempty"`
+	StopMode       string            `json:"stopMode,omitempty"`
+	Error          string            `json:"error,omitempty"`
+}
+
+// New returns an event of `eventType` about the instance described by `data`
+func New(source, eventType, reason string, data Data) Event {
+	return Event{
+		SpecVersion:     specVersion,
+		ID:              newID(),
+		Source:          source,
+		Type:            eventType,
+		Subject:         data.InstanceID,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Reason:          reason,
+		Data:            data,
+	}
+}
+
+func newID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,239 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	yaml "gopkg.in/yaml.v3"
+)
+
+const (
+	// SignatureHeader holds the HMAC-SHA256 of the request body, as `sha256=<hex>`, for endpoints
+	// with a secret
+	SignatureHeader = "X-InstanceScheduler-Signature"
+	// contentType is the media type of a CloudEvent sent in structured mode
+	contentType = "application/cloudevents+json"
+	// requestTimeout bounds a single delivery attempt
+	requestTimeout = 30 * time.Second
+)
+
+// Filter limits the events sent to an endpoint, an empty field matches every event
+type Filter struct {
+	Types          []string          `yaml:"types"`
+	Subscriptions  []string          `yaml:"subscriptions"`
+	ResourceGroups []string          `yaml:"resourceGroups"`
+	Tags           map[string]string `yaml:"tags"`
+}
+
+// Match determines if an event passes the filter. Subscriptions, resource groups and tag keys are
+// matched case-insensitively, tag values must match exactly.
+func (f Filter) Match(event Event) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, event.Type) {
+		return false
+	}
+
+	if len(f.Subscriptions) > 0 && !containsFold(f.Subscriptions, event.Data.SubscriptionID) {
+		return false
+	}
+
+	if len(f.ResourceGroups) > 0 && !containsFold(f.ResourceGroups, event.Data.ResourceGroup) {
+		return false
+	}
+
+	for key, want := range f.Tags {
+		var found bool
+
+		for name, value := range event.Data.Tags {
+			if strings.EqualFold(name, key) && value == want {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Endpoint is an HTTP endpoint events are posted to
+type Endpoint struct {
+	URL string `yaml:"url"`
+	// Secret signs each request with HMAC-SHA256, requests are not signed when it is empty
+	Secret string `yaml:"secret"`
+	// SecretEnv is an environment variable holding the secret, so that it is kept out of the config
+	SecretEnv string `yaml:"secretEnv"`
+	Filter    Filter `yaml:",inline"`
+}
+
+// Publisher delivers events to every endpoint whose filter they match
+type Publisher struct {
+	// Source identifies the scheduler in the `source` of every event
+	Source    string     `yaml:"source"`
+	Endpoints []Endpoint `yaml:"endpoints"`
+	// MaxAttempts is the total number of delivery attempts to each endpoint, including the first
+	MaxAttempts int `yaml:"maxAttempts"`
+	// BaseDelay is the delay before the first retry, doubling for each retry after that
+	BaseDelay time.Duration `yaml:"baseDelay"`
+
+	client *http.Client
+}
+
+// Load reads the events config at `path`, resolving each endpoint's secret
+func Load(path string) (*Publisher, error) {
+	publisher := &Publisher{Source: "instancescheduler", MaxAttempts: 5, BaseDelay: time.Second}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, publisher); err != nil {
+		return nil, err
+	}
+
+	for i, endpoint := range publisher.Endpoints {
+		if endpoint.URL == "" {
+			return nil, fmt.Errorf("endpoint %d has no url", i)
+		}
+
+		if endpoint.SecretEnv != "" {
+			publisher.Endpoints[i].Secret = os.Getenv(endpoint.SecretEnv)
+			if publisher.Endpoints[i].Secret == "" {
+				return nil, fmt.Errorf("secret for %s is not set in %s", endpoint.URL, endpoint.SecretEnv)
+			}
+		}
+	}
+
+	return publisher, nil
+}
+
+// Publish delivers an event to every matching endpoint, retrying failed deliveries. A failure to
+// deliver to one endpoint does not stop delivery to the others, every error is returned.
+func (p *Publisher) Publish(ctx context.Context, event Event) error {
+	var errs []error
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for _, endpoint := range p.Endpoints {
+		if !endpoint.Filter.Match(event) {
+			continue
+		}
+
+		if err := p.deliver(ctx, endpoint, data); err != nil {
+			errs = append(errs, fmt.Errorf("unable to deliver %s event to %s: %w", event.Type, endpoint.URL, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// deliver posts an event to an endpoint, retrying with exponential backoff and jitter when the
+// request fails, is throttled or fails on the server
+func (p *Publisher) deliver(ctx context.Context, endpoint Endpoint, data []byte) error {
+	attempts := max(p.MaxAttempts, 1)
+
+	for attempt := 1; ; attempt++ {
+		retryable, err := p.post(ctx, endpoint, data)
+		if err == nil {
+			return nil
+		}
+
+		if !retryable || attempt >= attempts {
+			return err
+		}
+
+		delay := p.BaseDelay << (attempt - 1)
+		if delay > 0 {
+			delay = time.Duration(rand.Int63n(int64(delay) + 1))
+		}
+
+		log.Warn().Err(err).Str("url", endpoint.URL).Int("attempt", attempt).Dur("delay", delay).
+			Msg("Retrying event delivery")
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// post makes a single delivery attempt, returning whether a failure is worth retrying
+func (p *Publisher) post(ctx context.Context, endpoint Endpoint, data []byte) (bool, error) {
+	client := p.client
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	if endpoint.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(endpoint.Secret, data))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return false, nil
+	}
+
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+
+	return retryable, fmt.Errorf("endpoint returned %s", resp.Status)
+}
+
+// Sign returns the signature of a request body, as sent in `SignatureHeader`
+func Sign(secret string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
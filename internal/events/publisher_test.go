@@ -0,0 +1,131 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// TestFilterMatch checks events are matched by type, subscription, resource group and tag
+func TestFilterMatch(t *testing.T) {
+	event := New("test", TypeInstanceStopped, "outside-schedule", Data{
+		SubscriptionID: "00000000-0000-0000-0000-000000000001",
+		ResourceGroup:  "rg-dev",
+		Tags:           map[string]string{"Environment": "dev"},
+	})
+
+	testCases := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{name: "empty filter", filter: Filter{}, want: true},
+		{name: "matching type", filter: Filter{Types: []string{TypeInstanceStopped}}, want: true},
+		{name: "other type", filter: Filter{Types: []string{TypeInstanceStarted}}, want: false},
+		{name: "resource group in another case", filter: Filter{ResourceGroups: []string{"RG-DEV"}}, want: true},
+		{name: "other subscription", filter: Filter{Subscriptions: []string{"other"}}, want: false},
+		{name: "tag key in another case", filter: Filter{Tags: map[string]string{"environment": "dev"}}, want: true},
+		{name: "other tag value", filter: Filter{Tags: map[string]string{"environment": "prod"}}, want: false},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.filter.Match(event)
+
+			if got != test.want {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestPublish checks an event is retried after a server error and signed with the endpoint's
+// secret
+func TestPublish(t *testing.T) {
+	var attempts atomic.Int32
+	var got Event
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+
+		if signature := r.Header.Get(SignatureHeader); signature != Sign("secret", body) {
+			t.Errorf("got: %v, want: %v", signature, Sign("secret", body))
+		}
+
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("unable to decode event: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	publisher := &Publisher{Endpoints: []Endpoint{{URL: server.URL, Secret: "secret"}}, MaxAttempts: 3}
+
+	event := New("test", TypeInstanceStarted, "within-schedule", Data{InstanceID: "/vm-1", Instance: "vm-1"})
+
+	if err := publisher.Publish(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if attempts.Load() != 2 {
+		t.Errorf("got: %v, want: %v", attempts.Load(), 2)
+	}
+
+	if got.SpecVersion != "1.0" || got.Type != TypeInstanceStarted || got.Subject != "/vm-1" {
+		t.Errorf("got: %+v, want: a %s event about /vm-1", got, TypeInstanceStarted)
+	}
+}
+
+// TestLoad checks the events config is read with its filters and secrets
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.yaml")
+	t.Setenv("EVENTS_SECRET", "from-env")
+
+	err := os.WriteFile(path, []byte(`source: /scheduler/prod
+baseDelay: 2s
+endpoints:
+  - url: https://example.com/events
+    secretEnv: EVENTS_SECRET
+    types: [com.instancescheduler.instance.stopped]
+    tags:
+      environment: dev
+`), 0o600)
+	if err != nil {
+		t.Fatalf("unable to write config: %v", err)
+	}
+
+	publisher, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	endpoint := publisher.Endpoints[0]
+
+	if publisher.Source != "/scheduler/prod" || publisher.MaxAttempts != 5 || publisher.BaseDelay.String() != "2s" {
+		t.Errorf("got: %+v, want: the source, default attempts and base delay", publisher)
+	}
+
+	if endpoint.Secret != "from-env" || len(endpoint.Filter.Types) != 1 || endpoint.Filter.Tags["environment"] != "dev" {
+		t.Errorf("got: %+v, want: the secret and filter from the config", endpoint)
+	}
+}
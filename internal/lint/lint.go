@@ -0,0 +1,279 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package lint
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"instancescheduler/internal/azure"
+	"instancescheduler/internal/override"
+	"instancescheduler/internal/patchwindow"
+	"instancescheduler/internal/schedule"
+)
+
+// Kind is the type of problem found with an instance's tags
+type Kind string
+
+const (
+	KindInvalidEnabled     Kind = "invalid-enabled"
+	KindInvalidSchedule    Kind = "invalid-schedule-json"
+	KindInvalidWindow      Kind = "invalid-schedule-window"
+	KindInvalidPatchWindow Kind = "invalid-patch-window"
+	KindNeverOn            Kind = "schedule-never-on"
+	KindNeverOff           Kind = "schedule-never-off"
+	KindMissingSchedule    Kind = "missing-schedule"
+	KindInvalidOverride    Kind = "invalid-override"
+	KindInvalidSnooze      Kind = "invalid-snooze"
+)
+
+// NoOwner is the owner used for instances without an owner tag
+const NoOwner = "(none)"
+
+// Finding is a single problem with an instance's tags
+type Finding struct {
+	SubscriptionID string `json:"subscriptionId"`
+	ResourceGroup  string `json:"resourceGroup"`
+	Instance       string `json:"instance"`
+	Owner          string `json:"owner"`
+	Kind           Kind   `json:"kind"`
+	Tag            string `json:"tag"`
+	Value          string `json:"value,omitempty"`
+	Message        string `json:"message"`
+}
+
+// Coverage is the number of instances within a group that are scheduled
+type Coverage struct {
+	Group string `json:"group"`
+	// Instances is the total number of instances in the group
+	Instances int `json:"instances"`
+	// Enabled is the number of instances with scheduling enabled
+	Enabled int `json:"enabled"`
+	// Valid is the number of enabled instances without any findings
+	Valid int `json:"valid"`
+}
+
+// Percent returns the share of the group's instances that are enabled with valid tags
+func (c Coverage) Percent() float64 {
+	if c.Instances == 0 {
+		return 0
+	}
+
+	return float64(c.Valid) / float64(c.Instances) * 100
+}
+
+// Report is the outcome of linting every instance within a scope
+type Report struct {
+	Instances      int        `json:"instances"`
+	Findings       []Finding  `json:"findings"`
+	ResourceGroups []Coverage `json:"resourceGroups"`
+	Owners         []Coverage `json:"owners"`
+}
+
+// Lint checks the scheduler tags of every instance at `now`, returning the problems found along with
+// the scheduling coverage by resource group and by the value of the owner tag
+func Lint(tags *azure.Tags, instances []azure.Instance, ownerTag string, now time.Time) *Report {
+	report := &Report{Instances: len(instances), Findings: []Finding{}}
+
+	resourceGroups := make(map[string]*Coverage)
+	owners := make(map[string]*Coverage)
+
+	for _, instance := range instances {
+		_, owner, _ := azure.LookupTag(instance.Tags, ownerTag)
+		if owner == "" {
+			owner = NoOwner
+		}
+
+		findings := lintInstance(tags, instance, now)
+		for i := range findings {
+			findings[i].SubscriptionID = instance.SubscriptionID
+			findings[i].ResourceGroup = instance.ResourceGroup
+			findings[i].Instance = instance.Name
+			findings[i].Owner = owner
+		}
+
+		report.Findings = append(report.Findings, findings...)
+
+		enabled := tags.LoadValues(instance.Tags).Enabled
+		resourceGroup := instance.SubscriptionID + "/" + instance.ResourceGroup
+
+		for _, coverage := range []*Coverage{
+			group(resourceGroups, strings.ToLower(resourceGroup), resourceGroup),
+			group(owners, strings.ToLower(owner), owner),
+		} {
+			coverage.Instances++
+
+			if enabled {
+				coverage.Enabled++
+
+				if len(findings) == 0 {
+					coverage.Valid++
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+
+		return strings.ToLower(a.SubscriptionID+"/"+a.ResourceGroup+"/"+a.Instance) <
+			strings.ToLower(b.SubscriptionID+"/"+b.ResourceGroup+"/"+b.Instance)
+	})
+
+	report.ResourceGroups = sortedCoverage(resourceGroups)
+	report.Owners = sortedCoverage(owners)
+
+	return report
+}
+
+// lintInstance returns the problems with a single instance's tags
+func lintInstance(tags *azure.Tags, instance azure.Instance, now time.Time) []Finding {
+	var findings []Finding
+
+	values := tags.LoadValues(instance.Tags)
+
+	if key, enabled, ok := tags.Lookup(instance.Tags, azure.TagEnabled); ok {
+		if _, err := strconv.ParseBool(enabled); err != nil {
+			findings = append(findings, Finding{
+				Kind:    KindInvalidEnabled,
+				Tag:     key,
+				Value:   enabled,
+				Message: "enabled is not a boolean and is treated as false",
+			})
+		}
+	}
+
+	if values.Schedule == "" {
+		if values.Enabled {
+			findings = append(findings, Finding{
+				Kind:    KindMissingSchedule,
+				Tag:     tags.InstanceSchedulingSchedule,
+				Message: "scheduling is enabled but no schedule is set",
+			})
+		}
+	} else if s, err := schedule.NewSchedule([]byte(values.Schedule)); err != nil {
+		findings = append(findings, Finding{
+			Kind:    KindInvalidSchedule,
+			Tag:     tags.InstanceSchedulingSchedule,
+			Value:   values.Schedule,
+			Message: "schedule is not valid JSON: " + err.Error(),
+		})
+	} else if !s.Validate() || !s.ValidateOverrides() {
+		findings = append(findings, Finding{
+			Kind:    KindInvalidWindow,
+			Tag:     tags.InstanceSchedulingSchedule,
+			Value:   values.Schedule,
+			Message: "schedule windows must be valid 'HH:MM-HH:MM' ranges ending after they start",
+		})
+	} else if neverOn, neverOff := neverOnOrOff(s, now); neverOn {
+		findings = append(findings, Finding{
+			Kind:    KindNeverOn,
+			Tag:     tags.InstanceSchedulingSchedule,
+			Value:   values.Schedule,
+			Message: "schedule never turns the instance on",
+		})
+	} else if neverOff {
+		findings = append(findings, Finding{
+			Kind:    KindNeverOff,
+			Tag:     tags.InstanceSchedulingSchedule,
+			Value:   values.Schedule,
+			Message: "schedule never turns the instance off",
+		})
+	}
+
+	if values.PatchWindow != "" {
+		if _, err := patchwindow.New([]byte(values.PatchWindow)); err != nil {
+			findings = append(findings, Finding{
+				Kind:    KindInvalidPatchWindow,
+				Tag:     tags.InstanceSchedulingPatchWindow,
+				Value:   values.PatchWindow,
+				Message: "patch window is not valid: " + err.Error(),
+			})
+		}
+	}
+
+	if values.OverrideUntil != "" {
+		if _, err := override.Parse(values.OverrideUntil); err != nil {
+			findings = append(findings, Finding{
+				Kind:    KindInvalidOverride,
+				Tag:     tags.InstanceSchedulingOverrideUntil,
+				Value:   values.OverrideUntil,
+				Message: err.Error(),
+			})
+		}
+	}
+
+	if values.SnoozeUntil != "" {
+		if _, err := override.ParseTime(values.SnoozeUntil); err != nil {
+			findings = append(findings, Finding{
+				Kind:    KindInvalidSnooze,
+				Tag:     tags.InstanceSchedulingSnoozeUntil,
+				Value:   values.SnoozeUntil,
+				Message: err.Error(),
+			})
+		}
+	}
+
+	return findings
+}
+
+// neverOnOrOff determines if a schedule has no windows on any day of the week, so the instance is never
+// turned on, or a window spanning the whole of every day, `00:00-23:59`, so it is never turned off
+func neverOnOrOff(s *schedule.Schedule, now time.Time) (bool, bool) {
+	neverOn, neverOff := true, true
+
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		var on, allDay bool
+
+		for _, window := range s.WindowsFor(weekday) {
+			if window == "-" {
+				continue
+			}
+
+			start, end, err := schedule.ParseWindowOn(window, now)
+			if err != nil {
+				continue
+			}
+
+			on = true
+			allDay = allDay || (start.Hour() == 0 && start.Minute() == 0 && end.Hour() == 23 && end.Minute() == 59)
+		}
+
+		neverOn = neverOn && !on
+		neverOff = neverOff && allDay
+	}
+
+	return neverOn, neverOff
+}
+
+func group(groups map[string]*Coverage, key, name string) *Coverage {
+	if _, ok := groups[key]; !ok {
+		groups[key] = &Coverage{Group: name}
+	}
+
+	return groups[key]
+}
+
+func sortedCoverage(groups map[string]*Coverage) []Coverage {
+	coverage := make([]Coverage, 0, len(groups))
+
+	for _, c := range groups {
+		coverage = append(coverage, *c)
+	}
+
+	sort.Slice(coverage, func(i, j int) bool {
+		return strings.ToLower(coverage[i].Group) < strings.ToLower(coverage[j].Group)
+	})
+
+	return coverage
+}
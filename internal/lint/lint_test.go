@@ -0,0 +1,112 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package lint
+
+import (
+	"testing"
+	"time"
+
+	"instancescheduler/internal/azure"
+)
+
+func instance(name string, tags map[string]string) azure.Instance {
+	instance := azure.Instance{Name: name, ResourceGroup: "rg", SubscriptionID: "sub", Tags: map[string]*string{}}
+
+	for key, value := range tags {
+		value := value
+		instance.Tags[key] = &value
+	}
+
+	return instance
+}
+
+// TestLint checks the finding reported for each kind of problem
+func TestLint(t *testing.T) {
+	tags := &azure.Tags{
+		InstanceSchedulingEnabled:     "enabled",
+		InstanceSchedulingSchedule:    "schedule",
+		InstanceSchedulingPatchWindow: "patchWindow",
+	}
+
+	everyDay := `"monday": ["-"], "tuesday": ["-"], "wednesday": ["-"], "thursday": ["-"], "friday": ["-"], "saturday": ["-"], "sunday": ["-"]`
+
+	testCases := []struct {
+		name string
+		tags map[string]string
+		want []Kind
+	}{
+		{name: "valid", tags: map[string]string{"enabled": "true", "schedule": `{"default": "09:00-17:00"}`}},
+		{name: "untagged", tags: map[string]string{"owner": "ops"}},
+		{name: "invalid enabled", tags: map[string]string{"enabled": "yes", "schedule": `{"default": "09:00-17:00"}`},
+			want: []Kind{KindInvalidEnabled}},
+		{name: "missing schedule", tags: map[string]string{"enabled": "true"}, want: []Kind{KindMissingSchedule}},
+		{name: "invalid json", tags: map[string]string{"enabled": "true", "schedule": `{"default": `},
+			want: []Kind{KindInvalidSchedule}},
+		{name: "invalid window", tags: map[string]string{"enabled": "true", "schedule": `{"default": "17:00-09:00"}`},
+			want: []Kind{KindInvalidWindow}},
+		{name: "never on", tags: map[string]string{"enabled": "true", "schedule": `{"default": "09:00-17:00", "overrides": {` + everyDay + `}}`},
+			want: []Kind{KindNeverOn}},
+		{name: "never off", tags: map[string]string{"enabled": "true", "schedule": `{"default": "00:00-23:59"}`},
+			want: []Kind{KindNeverOff}},
+		{name: "invalid patch window", tags: map[string]string{"enabled": "true", "schedule": `{"default": "09:00-17:00"}`, "patchWindow": "{"},
+			want: []Kind{KindInvalidPatchWindow}},
+	}
+
+	now := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			got := Lint(tags, []azure.Instance{instance(test.name, test.tags)}, "owner", now)
+
+			if len(got.Findings) != len(test.want) {
+				t.Fatalf("got: %v, want: %v", got.Findings, test.want)
+			}
+
+			for i, finding := range got.Findings {
+				if finding.Kind != test.want[i] {
+					t.Errorf("got: %v, want: %v", finding.Kind, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestCoverage checks instances are counted against their resource group and owner
+func TestCoverage(t *testing.T) {
+	tags := &azure.Tags{InstanceSchedulingEnabled: "enabled", InstanceSchedulingSchedule: "schedule"}
+
+	instances := []azure.Instance{
+		instance("a", map[string]string{"enabled": "true", "schedule": `{"default": "09:00-17:00"}`, "Owner": "ops"}),
+		instance("b", map[string]string{"enabled": "true", "Owner": "ops"}),
+		instance("c", map[string]string{}),
+	}
+
+	got := Lint(tags, instances, "owner", time.Now())
+
+	want := []Coverage{
+		{Group: NoOwner, Instances: 1},
+		{Group: "ops", Instances: 2, Enabled: 2, Valid: 1},
+	}
+
+	if len(got.Owners) != len(want) {
+		t.Fatalf("got: %v, want: %v", got.Owners, want)
+	}
+
+	for i := range want {
+		if got.Owners[i] != want[i] {
+			t.Errorf("got: %v, want: %v", got.Owners[i], want[i])
+		}
+	}
+
+	if len(got.ResourceGroups) != 1 || got.ResourceGroups[0].Instances != 3 {
+		t.Errorf("got: %v, want: a single group of 3 instances", got.ResourceGroups)
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package lint
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"instancescheduler/internal/report"
+)
+
+// Write writes the findings and coverage as a table, JSON, CSV or Markdown. The CSV has a row for
+// every finding and coverage group, distinguished by the `record` column.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case report.FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(r)
+	case report.FormatTable:
+		return r.writeTable(w)
+	case report.FormatCSV:
+		return r.writeCSV(w)
+	case report.FormatMarkdown:
+		return r.writeMarkdown(w)
+	default:
+		return fmt.Errorf("unknown output format '%s', expected one of table, json, csv or markdown", format)
+	}
+}
+
+func (r *Report) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "SUBSCRIPTION\tRESOURCE GROUP\tINSTANCE\tOWNER\tKIND\tMESSAGE")
+
+	for _, finding := range r.Findings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", finding.SubscriptionID, finding.ResourceGroup,
+			finding.Instance, finding.Owner, finding.Kind, finding.Message)
+	}
+
+	for _, section := range []struct {
+		title    string
+		coverage []Coverage
+	}{
+		{title: "RESOURCE GROUP", coverage: r.ResourceGroups},
+		{title: "OWNER", coverage: r.Owners},
+	} {
+		fmt.Fprintln(tw)
+		fmt.Fprintf(tw, "%s\tINSTANCES\tENABLED\tVALID\tCOVERAGE\n", section.title)
+
+		for _, c := range section.coverage {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.0f%%\n", c.Group, c.Instances, c.Enabled, c.Valid, c.Percent())
+		}
+	}
+
+	return tw.Flush()
+}
+
+func (r *Report) writeCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	_ = writer.Write([]string{"record", "subscription", "resource_group", "instance", "owner", "kind", "tag",
+		"value", "message", "group", "instances", "enabled", "valid", "coverage"})
+
+	for _, f := range r.Findings {
+		_ = writer.Write([]string{"finding", f.SubscriptionID, f.ResourceGroup, f.Instance, f.Owner, string(f.Kind),
+			f.Tag, f.Value, f.Message, "", "", "", "", ""})
+	}
+
+	for _, section := range []struct {
+		record   string
+		coverage []Coverage
+	}{
+		{record: "resource-group", coverage: r.ResourceGroups},
+		{record: "owner", coverage: r.Owners},
+	} {
+		for _, c := range section.coverage {
+			_ = writer.Write([]string{section.record, "", "", "", "", "", "", "", "", c.Group,
+				strconv.Itoa(c.Instances), strconv.Itoa(c.Enabled), strconv.Itoa(c.Valid),
+				strconv.FormatFloat(c.Percent(), 'f', 1, 64)})
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+func (r *Report) writeMarkdown(w io.Writer) error {
+	fmt.Fprintln(w, "## Findings")
+	fmt.Fprintln(w)
+
+	if len(r.Findings) == 0 {
+		fmt.Fprintln(w, "No findings.")
+	} else {
+		fmt.Fprintln(w, "| Subscription | Resource group | Instance | Owner | Kind | Message |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- | --- | --- |")
+
+		for _, f := range r.Findings {
+			fmt.Fprintf(w, "| %s | %s | %s | %s | `%s` | %s |\n", markdownCell(f.SubscriptionID),
+				markdownCell(f.ResourceGroup), markdownCell(f.Instance), markdownCell(f.Owner), f.Kind,
+				markdownCell(f.Message))
+		}
+	}
+
+	for _, section := range []struct {
+		title    string
+		column   string
+		coverage []Coverage
+	}{
+		{title: "Coverage by resource group", column: "Resource group", coverage: r.ResourceGroups},
+		{title: "Coverage by owner", column: "Owner", coverage: r.Owners},
+	} {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "## %s\n", section.title)
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "| %s | Instances | Enabled | Valid | Coverage |\n", section.column)
+		fmt.Fprintln(w, "| --- | ---: | ---: | ---: | ---: |")
+
+		for _, c := range section.coverage {
+			fmt.Fprintf(w, "| %s | %d | %d | %d | %.0f%% |\n", markdownCell(c.Group), c.Instances, c.Enabled, c.Valid,
+				c.Percent())
+		}
+	}
+
+	return nil
+}
+
+// markdownCell escapes a value so that it does not break a Markdown table
+func markdownCell(value string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(value)
+}
@@ -0,0 +1,236 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"instancescheduler/internal/report"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+const namespace = "instancescheduler"
+
+// Metrics are the Prometheus metrics exposed by the scheduler. A nil `*Metrics` records nothing, so
+// that callers do not need to check whether metrics are enabled.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	evaluations    *prometheus.CounterVec
+	actions        *prometheus.CounterVec
+	actionDuration *prometheus.HistogramVec
+	armRequests    *prometheus.CounterVec
+	armThrottles   prometheus.Counter
+	invalidTags    prometheus.Gauge
+	lastSuccess    prometheus.Gauge
+	instances      *prometheus.GaugeVec
+}
+
+// New returns the scheduler's metrics, registered along with the Go and process collectors
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		evaluations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "evaluations_total",
+			Help:      "Instances evaluated, by the action decided and its reason code.",
+		}, []string{"action", "reason"}),
+		actions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "actions_total",
+			Help:      "Power actions sent to instances, by action and result.",
+		}, []string{"action", "result"}),
+		actionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "action_duration_seconds",
+			Help:      "Time taken for a power action to finish once sent, by operation method.",
+			Buckets:   []float64{5, 15, 30, 60, 120, 180, 300, 600, 900},
+		}, []string{"method"}),
+		armRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "arm_requests_total",
+			Help:      "Requests made to Azure Resource Manager, by HTTP method and status code.",
+		}, []string{"method", "code"}),
+		armThrottles: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "arm_throttled_requests_total",
+			Help:      "Requests to Azure Resource Manager that were throttled with a 429.",
+		}),
+		invalidTags: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "invalid_tag_instances",
+			Help:      "Instances with scheduling enabled whose scheduler tags are invalid, as of the last run.",
+		}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_success_timestamp_seconds",
+			Help:      "Unix time the last run finished without any failures.",
+		}),
+		instances: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "instances",
+			Help:      "Scheduled instances by desired and actual power state, running or stopped, as of the last run.",
+		}, []string{"desired", "actual"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.evaluations, m.actions, m.actionDuration, m.armRequests, m.armThrottles, m.invalidTags, m.lastSuccess,
+		m.instances,
+	)
+
+	return m
+}
+
+// Handler returns the HTTP handler serving the metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveRun records the outcome of a run. Evaluations are added to, while the per instance gauges
+// are replaced with the state of this run. The last success time is only moved on when the run had
+// no failures.
+func (m *Metrics) ObserveRun(runReport *report.Report, err error, now time.Time) {
+	if m == nil {
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	var invalid int
+
+	m.instances.Reset()
+
+	for _, result := range runReport.Results {
+		m.evaluations.WithLabelValues(string(result.Action), result.ReasonCode).Inc()
+
+		if result.InvalidTags {
+			invalid++
+		}
+
+		if result.DesiredState != "" && result.PowerState != "" {
+			m.instances.WithLabelValues(result.DesiredState, actualState(result.PowerState)).Inc()
+		}
+	}
+
+	m.invalidTags.Set(float64(invalid))
+
+	if !runReport.HasFailures() {
+		m.lastSuccess.Set(float64(now.Unix()))
+	}
+}
+
+// actualState normalises a power state, such as `PowerState/deallocated`, to the `running` or
+// `stopped` of the desired state so that the two labels can be compared. An instance on its way to
+// running counts as running, as the scheduler treats it, and a state that is not known is `unknown`.
+func actualState(powerState string) string {
+	switch strings.TrimPrefix(strings.ToLower(powerState), "powerstate/") {
+	case "running", "starting":
+		return "running"
+	case "stopped", "stopping", "deallocated", "deallocating":
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
+// ObserveAction records a power action sent to an instance and whether it succeeded
+func (m *Metrics) ObserveAction(action report.Action, err error) {
+	if m == nil {
+		return
+	}
+
+	result := "succeeded"
+	if err != nil {
+		result = "failed"
+	}
+
+	m.actions.WithLabelValues(string(action), result).Inc()
+}
+
+// ObserveActionDuration records how long a power action took to finish once sent
+func (m *Metrics) ObserveActionDuration(method string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.actionDuration.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+// Policy returns a pipeline policy counting every request made to Azure Resource Manager, including
+// retries, or nil when the metrics are nil
+func (m *Metrics) Policy() policy.Policy {
+	if m == nil {
+		return nil
+	}
+
+	return requestPolicy{metrics: m}
+}
+
+type requestPolicy struct {
+	metrics *Metrics
+}
+
+// Do counts the request once the response, or error, is returned
+func (p requestPolicy) Do(req *policy.Request) (*http.Response, error) {
+	resp, err := req.Next()
+
+	code := "error"
+	if resp != nil {
+		code = strconv.Itoa(resp.StatusCode)
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			p.metrics.armThrottles.Inc()
+		}
+	}
+
+	p.metrics.armRequests.WithLabelValues(req.Raw().Method, code).Inc()
+
+	return resp, err
+}
+
+// Serve exposes the metrics on `/metrics` at `addr` until `ctx` is cancelled
+func (m *Metrics) Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	log.Info().Str("addr", addr).Msg("Serving metrics")
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
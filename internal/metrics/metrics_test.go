@@ -0,0 +1,108 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"instancescheduler/internal/report"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestObserveRun checks a run's results are recorded by outcome and by desired and actual state
+func TestObserveRun(t *testing.T) {
+	m := New()
+	now := time.Date(2026, time.October, 19, 17, 0, 0, 0, time.UTC)
+
+	runReport := report.New()
+	runReport.Add(
+		report.Result{Action: report.ActionStop, ReasonCode: "outside-schedule", DesiredState: "stopped",
+			PowerState: "PowerState/running"},
+		report.Result{Action: report.ActionNone, ReasonCode: "already-in-desired-state", DesiredState: "stopped",
+			PowerState: "PowerState/deallocated"},
+		report.Result{Action: report.ActionNone, ReasonCode: "already-in-desired-state", DesiredState: "stopped",
+			PowerState: "PowerState/stopped"},
+		report.Result{Action: report.ActionStart, ReasonCode: "within-schedule", DesiredState: "running",
+			PowerState: "PowerState/starting"},
+		report.Result{Action: report.ActionNone, InvalidTags: true},
+	)
+
+	m.ObserveRun(runReport, nil, now)
+
+	testCases := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{name: "stop evaluations", got: testutil.ToFloat64(m.evaluations.WithLabelValues("stop", "outside-schedule")), want: 1},
+		{name: "drifted instances", got: testutil.ToFloat64(m.instances.WithLabelValues("stopped", "running")), want: 1},
+		{name: "stopped instances", got: testutil.ToFloat64(m.instances.WithLabelValues("stopped", "stopped")), want: 2},
+		{name: "running instances", got: testutil.ToFloat64(m.instances.WithLabelValues("running", "running")), want: 1},
+		{name: "raw power states", got: float64(testutil.CollectAndCount(m.instances)), want: 3},
+		{name: "invalid tags", got: testutil.ToFloat64(m.invalidTags), want: 1},
+		{name: "last success", got: testutil.ToFloat64(m.lastSuccess), want: float64(now.Unix())},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if test.got != test.want {
+				t.Errorf("got: %v, want: %v", test.got, test.want)
+			}
+		})
+	}
+
+	runReport.AddFailure("00000000-0000-0000-0000-000000000001", errors.New("forbidden"))
+	m.ObserveRun(runReport, nil, now.Add(time.Hour))
+
+	if got := testutil.ToFloat64(m.lastSuccess); got != float64(now.Unix()) {
+		t.Errorf("got: %v, want: %v", got, float64(now.Unix()))
+	}
+}
+
+// TestPolicy checks requests and throttles are counted by the pipeline policy
+func TestPolicy(t *testing.T) {
+	m := New()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	pipeline := runtime.NewPipeline("test", "v1.0.0", runtime.PipelineOptions{}, &policy.ClientOptions{
+		PerRetryPolicies: []policy.Policy{m.Policy()},
+		Retry:            policy.RetryOptions{MaxRetries: -1},
+	})
+
+	req, err := runtime.NewRequest(context.Background(), http.MethodGet, server.URL)
+	if err != nil {
+		t.Fatalf("unable to create request: %v", err)
+	}
+
+	if _, err := pipeline.Do(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := testutil.ToFloat64(m.armRequests.WithLabelValues(http.MethodGet, "429")); got != 1 {
+		t.Errorf("got: %v, want: %v", got, 1)
+	}
+
+	if got := testutil.ToFloat64(m.armThrottles); got != 1 {
+		t.Errorf("got: %v, want: %v", got, 1)
+	}
+}
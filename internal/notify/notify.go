@@ -0,0 +1,198 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// snoozeExampleLayout is the format of the example time given in the snooze instruction, it is one
+// of the formats the snooze tag accepts
+const snoozeExampleLayout = "2006-01-02T15:04Z07:00"
+
+// ErrNoNotifier is returned when warnings are enabled without anywhere to send them
+var ErrNoNotifier = errors.New("warnings need a webhook, chat webhook or SMTP server to send them to")
+
+// Warning tells an instance's owner that the instance is about to be stopped
+type Warning struct {
+	InstanceID     string    `json:"instanceId"`
+	SubscriptionID string    `json:"subscriptionId"`
+	ResourceGroup  string    `json:"resourceGroup"`
+	Instance       string    `json:"instance"`
+	Owner          string    `json:"owner,omitempty"`
+	StopAt         time.Time `json:"stopAt"`
+	// SnoozeTag is the tag the owner sets to hold back the stop
+	SnoozeTag string `json:"snoozeTag"`
+	// SnoozeURL is a link the owner can follow to hold back the stop, it is empty when no snooze URL
+	// is configured
+	SnoozeURL string `json:"snoozeUrl,omitempty"`
+}
+
+// Subject returns a one line summary of the warning
+func (w Warning) Subject() string {
+	return fmt.Sprintf("%s will be stopped at %s", w.Instance, w.StopAt.Format("Mon 15:04 MST"))
+}
+
+// Message returns the body of the warning, including how to snooze the stop
+func (w Warning) Message() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "The instance %s in resource group %s of subscription %s will be stopped by the instance "+
+		"scheduler at %s.\n", w.Instance, w.ResourceGroup, w.SubscriptionID, w.StopAt.Format(time.RFC3339))
+
+	if w.Owner != "" {
+		fmt.Fprintf(&b, "\nOwner: %s\n", w.Owner)
+	}
+
+	b.WriteString("\nTo delay the stop, ")
+
+	if w.SnoozeURL != "" {
+		fmt.Fprintf(&b, "open %s, or ", w.SnoozeURL)
+	}
+
+	fmt.Fprintf(&b, "set the tag %s on the instance to the time it may be stopped, such as %s.\n", w.SnoozeTag,
+		w.StopAt.Add(time.Hour).Format(snoozeExampleLayout))
+
+	return b.String()
+}
+
+// Notifier sends a warning to an instance's owner
+type Notifier interface {
+	Notify(ctx context.Context, warning Warning) error
+}
+
+// Notifiers sends a warning with every notifier, an error from one does not stop the others
+type Notifiers []Notifier
+
+// Notify sends the warning with every notifier. The warning counts as sent when any notifier
+// delivered it, so the failures of the others are logged and an error is only returned when every
+// notifier failed. Otherwise a failing notifier would have the others send it again on every run.
+func (n Notifiers) Notify(ctx context.Context, warning Warning) error {
+	var errs []error
+
+	for _, notifier := range n {
+		if err := notifier.Notify(ctx, warning); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 0 || len(errs) == len(n) {
+		return errors.Join(errs...)
+	}
+
+	for _, err := range errs {
+		log.Error().Err(err).Str("instance", warning.Instance).Msg("Failed to send warning with one of the notifiers")
+	}
+
+	return nil
+}
+
+// Warner warns the owner of an instance ahead of it being stopped
+type Warner struct {
+	// Before is how long before a stop the warning is sent
+	Before time.Duration
+	// OwnerTag is the tag holding the instance's owner, it is matched case-insensitively
+	OwnerTag string
+	Notifier Notifier
+	// SnoozeURL renders the link included in the warning for snoozing the stop, it is given the
+	// `Warning` and no link is included when it is nil
+	SnoozeURL *template.Template
+}
+
+// ParseSnoozeURL parses a snooze URL template, such as
+// `https://scheduler.example.com/snooze?instance={{.InstanceID}}`. The value of every action is
+// escaped with `urlquery`, unless the template already escapes it with `urlquery` or `pathescape`, as
+// resource IDs hold `/` and names may hold characters that would break the URL.
+func ParseSnoozeURL(data string) (*template.Template, error) {
+	tmpl, err := template.New("snooze-url").Option("missingkey=error").
+		Funcs(template.FuncMap{"pathescape": url.PathEscape}).Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	escapeActions(tmpl.Tree.Root)
+
+	return tmpl, nil
+}
+
+// escapeActions pipes the value of every action that prints through `urlquery`, unless it already
+// ends with an escaping function
+func escapeActions(node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+
+		for _, child := range node.Nodes {
+			escapeActions(child)
+		}
+	case *parse.ActionNode:
+		if len(node.Pipe.Decl) > 0 || escaped(node.Pipe) {
+			return
+		}
+
+		node.Pipe.Cmds = append(node.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      node.Pos,
+			Args:     []parse.Node{parse.NewIdentifier("urlquery").SetPos(node.Pos)},
+		})
+	case *parse.IfNode:
+		escapeActions(node.List)
+		escapeActions(node.ElseList)
+	case *parse.RangeNode:
+		escapeActions(node.List)
+		escapeActions(node.ElseList)
+	case *parse.WithNode:
+		escapeActions(node.List)
+		escapeActions(node.ElseList)
+	}
+}
+
+// escaped determines if a pipeline's value is already escaped for a URL
+func escaped(pipe *parse.PipeNode) bool {
+	if len(pipe.Cmds) == 0 {
+		return false
+	}
+
+	last := pipe.Cmds[len(pipe.Cmds)-1]
+	if len(last.Args) == 0 {
+		return false
+	}
+
+	identifier, ok := last.Args[0].(*parse.IdentifierNode)
+
+	return ok && (identifier.Ident == "urlquery" || identifier.Ident == "pathescape")
+}
+
+// Warn sends a warning to the instance's owner, adding the snooze link when one is configured
+func (w *Warner) Warn(ctx context.Context, warning Warning) error {
+	if w.SnoozeURL != nil {
+		var b strings.Builder
+
+		if err := w.SnoozeURL.Execute(&b, warning); err != nil {
+			return fmt.Errorf("unable to render snooze URL: %w", err)
+		}
+
+		warning.SnoozeURL = b.String()
+	}
+
+	return w.Notifier.Notify(ctx, warning)
+}
@@ -0,0 +1,293 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWarn checks the warning posted to a webhook includes the rendered snooze link
+func TestWarn(t *testing.T) {
+	var got Warning
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("unable to decode warning: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	snoozeURL, err := ParseSnoozeURL("https://scheduler.example.com/snooze?instance={{.Instance}}")
+	if err != nil {
+		t.Fatalf("unable to parse snooze URL: %v", err)
+	}
+
+	warner := &Warner{Before: 15 * time.Minute, Notifier: &Webhook{URL: server.URL}, SnoozeURL: snoozeURL}
+
+	warning := Warning{
+		Instance:  "vm-1",
+		Owner:     "jane@example.com",
+		StopAt:    time.Date(2026, time.October, 19, 18, 0, 0, 0, time.UTC),
+		SnoozeTag: "InstanceSchedulerSnoozeUntil",
+	}
+
+	if err := warner.Warn(context.Background(), warning); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "https://scheduler.example.com/snooze?instance=vm-1"
+	if got.SnoozeURL != want {
+		t.Errorf("got: %v, want: %v", got.SnoozeURL, want)
+	}
+
+	if !strings.Contains(warning.Message(), "InstanceSchedulerSnoozeUntil") {
+		t.Errorf("got: %v, want the snooze tag in the message", warning.Message())
+	}
+}
+
+// TestParseSnoozeURL checks the warning's fields are escaped in the snooze link, and those the
+// template already escapes are not escaped twice
+func TestParseSnoozeURL(t *testing.T) {
+	warning := Warning{
+		InstanceID: "/subscriptions/sub-1/resourceGroups/rg-1/providers/Microsoft.Compute/virtualMachines/vm 1&x",
+		Instance:   "vm 1&x",
+	}
+
+	testCases := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "resource ID",
+			data: "https://example.com/snooze?id={{.InstanceID}}",
+			want: "https://example.com/snooze?id=%2Fsubscriptions%2Fsub-1%2FresourceGroups%2Frg-1%2Fproviders%2F" +
+				"Microsoft.Compute%2FvirtualMachines%2Fvm+1%26x",
+		},
+		{
+			name: "already escaped",
+			data: "https://example.com/snooze?instance={{.Instance | urlquery}}",
+			want: "https://example.com/snooze?instance=vm+1%26x",
+		},
+		{
+			name: "path",
+			data: "https://example.com/snooze/{{pathescape .Instance}}",
+			want: "https://example.com/snooze/vm%201&x",
+		},
+		{
+			name: "conditional",
+			data: "https://example.com/snooze{{if .Instance}}?instance={{.Instance}}{{end}}",
+			want: "https://example.com/snooze?instance=vm+1%26x",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl, err := ParseSnoozeURL(test.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var b strings.Builder
+			if err := tmpl.Execute(&b, warning); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := b.String(); got != test.want {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestWebhookError checks a webhook that does not accept the warning returns an error
+func TestWebhookError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	notifiers := Notifiers{&Chat{URL: server.URL}, &Webhook{URL: server.URL}}
+
+	if err := notifiers.Notify(context.Background(), Warning{Instance: "vm-1"}); err == nil {
+		t.Errorf("got: %v, want: an error", err)
+	}
+}
+
+// TestNotifiersPartialFailure checks a warning counts as sent when any notifier delivered it, so
+// that the notifiers that succeeded do not send it again
+func TestNotifiersPartialFailure(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	succeeding := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer succeeding.Close()
+
+	testCases := []struct {
+		name      string
+		notifiers Notifiers
+		wantErr   bool
+	}{
+		{name: "all delivered", notifiers: Notifiers{&Webhook{URL: succeeding.URL}, &Chat{URL: succeeding.URL}}},
+		{name: "some delivered", notifiers: Notifiers{&Webhook{URL: failing.URL}, &Chat{URL: succeeding.URL}}},
+		{name: "none delivered", notifiers: Notifiers{&Webhook{URL: failing.URL}, &Chat{URL: failing.URL}}, wantErr: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.notifiers.Notify(context.Background(), Warning{Instance: "vm-1"})
+
+			if (err != nil) != test.wantErr {
+				t.Errorf("got: %v, want error: %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+// TestSMTP checks the warning is emailed to the owner, and that a mail server that stops responding
+// does not block past the context's deadline
+func TestSMTP(t *testing.T) {
+	testCases := []struct {
+		name     string
+		respond  bool
+		wantErr  bool
+		wantData string
+	}{
+		{name: "delivered", respond: true, wantData: "Subject: vm-1 will be stopped"},
+		{name: "unresponsive", respond: false, wantErr: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+
+			data := make(chan string, 1)
+
+			go func() {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				if test.respond {
+					data <- fakeSMTPServer(conn)
+				} else {
+					// hold the connection open without ever greeting the client
+					_, _ = conn.Read(make([]byte, 1))
+				}
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			s := &SMTP{Addr: listener.Addr().String(), From: "scheduler@example.com"}
+
+			started := time.Now()
+			err = s.Notify(ctx, Warning{Instance: "vm-1", Owner: "jane@example.com"})
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got: %v, want error: %v", err, test.wantErr)
+			}
+
+			if elapsed := time.Since(started); elapsed > 5*time.Second {
+				t.Errorf("got: %v, want the deadline to end the call", elapsed)
+			}
+
+			if test.wantData != "" {
+				if got := <-data; !strings.Contains(got, test.wantData) {
+					t.Errorf("got: %v, want: %v", got, test.wantData)
+				}
+			}
+		})
+	}
+}
+
+// fakeSMTPServer accepts a single email without TLS or authentication, returning its data
+func fakeSMTPServer(conn net.Conn) string {
+	var data strings.Builder
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 localhost ready")
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return data.String()
+		}
+
+		switch command := strings.ToUpper(strings.Fields(line + " ")[0]); command {
+		case "EHLO", "HELO", "MAIL", "RCPT":
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+
+				data.WriteString(line)
+			}
+
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return data.String()
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+// TestSMTPRecipient checks warnings are emailed to the owner when it is an email address
+func TestSMTPRecipient(t *testing.T) {
+	s := &SMTP{To: "platform@example.com"}
+
+	testCases := []struct {
+		name  string
+		owner string
+		want  string
+	}{
+		{name: "email owner", owner: "jane@example.com", want: "jane@example.com"},
+		{name: "named email owner", owner: "Jane <jane@example.com>", want: "jane@example.com"},
+		{name: "team owner", owner: "platform-team", want: "platform@example.com"},
+		{name: "no owner", owner: "", want: "platform@example.com"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			got := s.recipient(test.owner)
+
+			if got != test.want {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// smtpTimeout bounds sending a single email when the context has no deadline, so that a mail server
+// that stops responding does not hold up a run
+const smtpTimeout = 30 * time.Second
+
+// SMTP emails the warning to the instance's owner
+type SMTP struct {
+	// Addr is the `host:port` of the mail server
+	Addr string
+	From string
+	// To is who the warning is sent to when the instance's owner is not an email address, the
+	// warning is not sent when it is empty
+	To       string
+	Username string
+	Password string
+}
+
+// Notify emails the warning, to the owner when it is an email address and to `To` otherwise. The
+// connection is closed when `ctx` is done, and every read and write must finish by its deadline.
+func (s *SMTP) Notify(ctx context.Context, warning Warning) error {
+	to := s.recipient(warning.Owner)
+	if to == "" {
+		return fmt.Errorf("owner '%s' of %s is not an email address and no fallback recipient is set", warning.Owner,
+			warning.Instance)
+	}
+
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, smtpTimeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return s.send(client, host, to, s.message(to, warning))
+}
+
+// send emails the message over an open connection, as `smtp.SendMail` does: upgrading to TLS when
+// the server supports it and logging in when a username is set
+func (s *SMTP) send(client *smtp.Client, host, to string, message []byte) error {
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(s.From); err != nil {
+		return err
+	}
+
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// recipient returns the owner when it is an email address, or the fallback recipient otherwise
+func (s *SMTP) recipient(owner string) string {
+	if address, err := mail.ParseAddress(owner); err == nil {
+		return address.Address
+	}
+
+	return s.To
+}
+
+func (s *SMTP) message(to string, warning Warning) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", warning.Subject())
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(warning.Message(), "\n", "\r\n"))
+
+	return []byte(b.String())
+}
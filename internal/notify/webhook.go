@@ -0,0 +1,78 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// requestTimeout bounds a single webhook call, so that a slow endpoint does not hold up a run
+const requestTimeout = 30 * time.Second
+
+// Webhook posts the warning as JSON to a URL
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify posts the warning to the webhook
+func (w *Webhook) Notify(ctx context.Context, warning Warning) error {
+	return post(ctx, w.Client, w.URL, warning)
+}
+
+// Chat posts the warning to a Microsoft Teams or Slack incoming webhook, both of which accept a
+// message with a `text` field
+type Chat struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify posts the warning to the chat webhook
+func (c *Chat) Notify(ctx context.Context, warning Warning) error {
+	return post(ctx, c.Client, c.URL, map[string]string{
+		"text": fmt.Sprintf("**%s**\n\n%s", warning.Subject(), warning.Message()),
+	})
+}
+
+func post(ctx context.Context, client *http.Client, url string, body any) error {
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
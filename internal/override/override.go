@@ -0,0 +1,97 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package override
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// State is the power state an override keeps an instance in
+type State string
+
+const (
+	StateRunning State = "running"
+	StateStopped State = "stopped"
+)
+
+// layouts are the accepted formats for the time an override expires, those without a zone are read
+// in local time
+var layouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+}
+
+// Override keeps an instance in a power state until it expires, taking precedence over its schedule
+type Override struct {
+	Until time.Time `json:"until"`
+	State State     `json:"state"`
+}
+
+// Parse reads an override tag. The value is either the time the override expires, such as
+// `2026-10-17T23:00+11:00`, which keeps the instance running, or a JSON object with `until` and an
+// optional `state` of `running` or `stopped`.
+func Parse(data string) (*Override, error) {
+	var value struct {
+		Until string `json:"until"`
+		State string `json:"state"`
+	}
+
+	data = strings.TrimSpace(data)
+
+	if strings.HasPrefix(data, "{") {
+		if err := json.Unmarshal([]byte(data), &value); err != nil {
+			return nil, err
+		}
+	} else {
+		value.Until = data
+	}
+
+	until, err := ParseTime(value.Until)
+	if err != nil {
+		return nil, err
+	}
+
+	override := &Override{Until: until, State: StateRunning}
+
+	switch State(strings.ToLower(value.State)) {
+	case "", StateRunning:
+	case StateStopped:
+		override.State = StateStopped
+	default:
+		return nil, fmt.Errorf("invalid override state '%s', expected running or stopped", value.State)
+	}
+
+	return override, nil
+}
+
+// ParseTime reads a time in any of the formats accepted for an override, such as
+// `2026-10-17T23:00+11:00`, those without a zone are read in local time
+func ParseTime(data string) (time.Time, error) {
+	data = strings.TrimSpace(data)
+
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, data, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time '%s', expected a time such as '2026-10-17T23:00+11:00'", data)
+}
+
+// Active determines if the override still applies at `now`
+func (o *Override) Active(now time.Time) bool {
+	return o != nil && now.Before(o.Until)
+}
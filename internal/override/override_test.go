@@ -0,0 +1,56 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package override
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParse checks each accepted override format
+func TestParse(t *testing.T) {
+	zone := time.FixedZone("+11:00", 11*60*60)
+
+	testCases := []struct {
+		name      string
+		data      string
+		wantUntil time.Time
+		wantState State
+		wantErr   bool
+	}{
+		{name: "time without seconds", data: "2026-10-17T23:00+11:00",
+			wantUntil: time.Date(2026, time.October, 17, 23, 0, 0, 0, zone), wantState: StateRunning},
+		{name: "rfc3339", data: "2026-10-17T12:00:00Z",
+			wantUntil: time.Date(2026, time.October, 17, 12, 0, 0, 0, time.UTC), wantState: StateRunning},
+		{name: "json stopped", data: `{"until": "2026-10-17T23:00+11:00", "state": "stopped"}`,
+			wantUntil: time.Date(2026, time.October, 17, 23, 0, 0, 0, zone), wantState: StateStopped},
+		{name: "invalid time", data: "tomorrow", wantErr: true},
+		{name: "invalid state", data: `{"until": "2026-10-17T23:00+11:00", "state": "paused"}`, wantErr: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse(test.data)
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got: %v, want error: %v", err, test.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if !got.Until.Equal(test.wantUntil) || got.State != test.wantState {
+				t.Errorf("got: %v %v, want: %v %v", got.Until, got.State, test.wantUntil, test.wantState)
+			}
+		})
+	}
+}
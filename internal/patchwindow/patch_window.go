@@ -108,6 +108,58 @@ func (p *PatchWindow) NextWindowStart() (time.Time, error) {
 	return day, nil
 }
 
+// NextTransition returns the next time after `now` that the patch window changes the desired state
+// of an instance: an hour before the window starts, when it starts, and when it ends. The zero time
+// is returned when there is no patch window within the next two months.
+func (p *PatchWindow) NextTransition(now time.Time) time.Time {
+	if p == nil {
+		return time.Time{}
+	}
+
+	startTime, err := time.Parse("15:04", p.Time)
+	if err != nil {
+		return time.Time{}
+	}
+
+	weekday := parseWeekday(p.Day)
+
+	for offset := 0; offset <= 62; offset++ {
+		day := now.AddDate(0, 0, offset)
+
+		if day.Weekday() != weekday || getWeekOfMonth(day) != p.Week {
+			continue
+		}
+
+		start := time.Date(day.Year(), day.Month(), day.Day(), startTime.Hour(), startTime.Minute(), 0, 0, now.Location())
+		end := start.Add(time.Hour * time.Duration(p.Duration))
+
+		for _, boundary := range []time.Time{start.Add(time.Hour * -1), start, end} {
+			if boundary.After(now) {
+				return boundary
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+// ActiveAt determines if `t` falls within the patch window, including the hour before it starts
+func (p *PatchWindow) ActiveAt(t time.Time) bool {
+	if p == nil || t.Weekday() != parseWeekday(p.Day) || getWeekOfMonth(t) != p.Week {
+		return false
+	}
+
+	startTime, err := time.Parse("15:04", p.Time)
+	if err != nil {
+		return false
+	}
+
+	start := time.Date(t.Year(), t.Month(), t.Day(), startTime.Hour(), startTime.Minute(), 0, 0, t.Location())
+	end := start.Add(time.Hour * time.Duration(p.Duration))
+
+	return !t.Before(start.Add(time.Hour*-1)) && t.Before(end)
+}
+
 func getWeekOfMonth(t time.Time) int {
 	week := int(t.Day()/7) + 1
 	if t.Weekday() < time.Monday && (t.Day()-int(t.Weekday()))%7 != 0 {
@@ -0,0 +1,88 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package pool
+
+import (
+	"context"
+	"sync"
+)
+
+// Pool bounds the number of tasks that may run at once, both overall and per key. A key is
+// typically a subscription or resource group so that a single scope cannot use every slot.
+type Pool struct {
+	slots    chan struct{}
+	keyLimit int
+
+	mu       sync.Mutex
+	keySlots map[string]chan struct{}
+}
+
+// New returns a pool allowing `concurrency` tasks overall and `keyConcurrency` tasks per key. A
+// `keyConcurrency` of zero or less means only the overall limit applies.
+func New(concurrency, keyConcurrency int) *Pool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &Pool{
+		slots:    make(chan struct{}, concurrency),
+		keyLimit: keyConcurrency,
+		keySlots: make(map[string]chan struct{}),
+	}
+}
+
+// Acquire blocks until a slot is free for the key and overall, returning a function that must be
+// called to release the slots. If `ctx` is cancelled while waiting then no slot is held, the
+// returned release function is a no-op and the context error is returned.
+func (p *Pool) Acquire(ctx context.Context, key string) (func(), error) {
+	keySlots := p.slotsForKey(key)
+
+	if keySlots != nil {
+		select {
+		case keySlots <- struct{}{}:
+		case <-ctx.Done():
+			return func() {}, ctx.Err()
+		}
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		if keySlots != nil {
+			<-keySlots
+		}
+		return func() {}, ctx.Err()
+	}
+
+	return func() {
+		<-p.slots
+		if keySlots != nil {
+			<-keySlots
+		}
+	}, nil
+}
+
+func (p *Pool) slotsForKey(key string) chan struct{} {
+	if p.keyLimit < 1 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	slots, ok := p.keySlots[key]
+	if !ok {
+		slots = make(chan struct{}, p.keyLimit)
+		p.keySlots[key] = slots
+	}
+
+	return slots
+}
@@ -0,0 +1,100 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package pool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolLimits(t *testing.T) {
+	testCases := []struct {
+		name           string
+		concurrency    int
+		keyConcurrency int
+		keys           []string
+		want           int32
+	}{
+		{
+			name:        "overall_limit",
+			concurrency: 2,
+			keys:        []string{"a", "b", "c", "d", "e", "f"},
+			want:        2,
+		},
+		{
+			name:           "key_limit",
+			concurrency:    10,
+			keyConcurrency: 1,
+			keys:           []string{"a", "a", "a", "a"},
+			want:           1,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var running, peak int32
+			var wg sync.WaitGroup
+
+			p := New(test.concurrency, test.keyConcurrency)
+
+			for _, key := range test.keys {
+				wg.Add(1)
+				go func(key string) {
+					defer wg.Done()
+
+					release, err := p.Acquire(context.Background(), key)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					defer release()
+
+					current := atomic.AddInt32(&running, 1)
+					for {
+						seen := atomic.LoadInt32(&peak)
+						if current <= seen || atomic.CompareAndSwapInt32(&peak, seen, current) {
+							break
+						}
+					}
+
+					time.Sleep(10 * time.Millisecond)
+					atomic.AddInt32(&running, -1)
+				}(key)
+			}
+
+			wg.Wait()
+
+			if peak != test.want {
+				t.Errorf("got: %d, want: %d", peak, test.want)
+			}
+		})
+	}
+}
+
+func TestPoolCancelled(t *testing.T) {
+	p := New(1, 0)
+
+	release, err := p.Acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := p.Acquire(ctx, "a"); err == nil {
+		t.Error("expected an error when acquiring with a cancelled context")
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Explanation is an instance's planned action along with the trace of how it was decided
+type Explanation struct {
+	PlanEntry
+	Trace *Trace `json:"trace,omitempty"`
+}
+
+// Explanations returns an explanation for every result in the report, in a stable order
+func (r *Report) Explanations() []Explanation {
+	var explanations []Explanation
+
+	entries := r.Plan()
+
+	for i, entry := range entries {
+		explanations = append(explanations, Explanation{PlanEntry: entry, Trace: r.Results[i].Trace})
+	}
+
+	return explanations
+}
+
+// WriteExplanations writes the decision trace of every instance in the report, either as text or
+// JSON
+func (r *Report) WriteExplanations(w io.Writer, format string) error {
+	explanations := r.Explanations()
+
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		if explanations == nil {
+			explanations = []Explanation{}
+		}
+
+		return encoder.Encode(explanations)
+	case FormatTable:
+		for _, explanation := range explanations {
+			writeExplanation(w, explanation)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown output format '%s', expected one of table or json", format)
+	}
+}
+
+func writeExplanation(w io.Writer, explanation Explanation) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Instance:\t%s\n", explanation.Instance)
+	fmt.Fprintf(tw, "Subscription:\t%s\n", explanation.SubscriptionID)
+	fmt.Fprintf(tw, "Resource group:\t%s\n", explanation.ResourceGroup)
+	fmt.Fprintf(tw, "Power state:\t%s\n", valueOrDash(explanation.PowerState))
+	fmt.Fprintf(tw, "Action:\t%s\n", explanation.Action)
+	fmt.Fprintf(tw, "Reason:\t%s\n", valueOrDash(explanation.Reason))
+
+	if explanation.Trace != nil {
+		fmt.Fprintf(tw, "Rule:\t%s\n", valueOrDash(explanation.Trace.Rule))
+	}
+
+	if explanation.NextTransition != nil {
+		fmt.Fprintf(tw, "Next transition:\t%s (%s)\n", explanation.NextTransition.Format(time.RFC3339),
+			explanation.NextAction)
+	}
+
+	if explanation.Error != "" {
+		fmt.Fprintf(tw, "Error:\t%s\n", explanation.Error)
+	}
+
+	tw.Flush()
+
+	if explanation.Trace == nil {
+		fmt.Fprintln(w)
+		return
+	}
+
+	fmt.Fprintln(w, "\nTags:")
+
+	keys := make([]string, 0, len(explanation.Trace.Tags))
+	for key := range explanation.Trace.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %s = %s\n", key, explanation.Trace.Tags[key])
+	}
+
+	fmt.Fprintln(w, "\nSteps:")
+
+	for i, step := range explanation.Trace.Steps {
+		fmt.Fprintf(w, "  %d. %s: %s\n", i+1, step.Name, step.Detail)
+	}
+
+	fmt.Fprintln(w)
+}
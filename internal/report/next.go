@@ -0,0 +1,91 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Transition is the next change in an instance's desired state
+type Transition struct {
+	SubscriptionID string    `json:"subscriptionId"`
+	ResourceGroup  string    `json:"resourceGroup"`
+	Instance       string    `json:"instance"`
+	At             time.Time `json:"at"`
+	Action         Action    `json:"action"`
+}
+
+// Transitions returns the next transition of every instance that has one, soonest first. A `limit`
+// above zero caps the number of transitions returned.
+func (r *Report) Transitions(limit int) []Transition {
+	var transitions []Transition
+
+	r.Sort()
+
+	for _, result := range r.Results {
+		if result.NextTransition.IsZero() {
+			continue
+		}
+
+		transitions = append(transitions, Transition{
+			SubscriptionID: result.SubscriptionID,
+			ResourceGroup:  result.ResourceGroup,
+			Instance:       result.Instance,
+			At:             result.NextTransition,
+			Action:         result.NextAction,
+		})
+	}
+
+	sort.SliceStable(transitions, func(i, j int) bool {
+		return transitions[i].At.Before(transitions[j].At)
+	})
+
+	if limit > 0 && len(transitions) > limit {
+		transitions = transitions[:limit]
+	}
+
+	return transitions
+}
+
+// WriteTransitions writes the upcoming transitions, either as a table or JSON
+func (r *Report) WriteTransitions(w io.Writer, format string, limit int) error {
+	transitions := r.Transitions(limit)
+
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		if transitions == nil {
+			transitions = []Transition{}
+		}
+
+		return encoder.Encode(transitions)
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+		fmt.Fprintln(tw, "AT\tACTION\tSUBSCRIPTION\tRESOURCE GROUP\tINSTANCE")
+
+		for _, transition := range transitions {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", transition.At.Format(time.RFC3339), transition.Action,
+				transition.SubscriptionID, transition.ResourceGroup, transition.Instance)
+		}
+
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format '%s', expected one of table or json", format)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	FormatTable    = "table"
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+)
+
+// PlanEntry is a single instance's planned action, as written by `WritePlan`
+type PlanEntry struct {
+	SubscriptionID string     `json:"subscriptionId"`
+	ResourceGroup  string     `json:"resourceGroup"`
+	Instance       string     `json:"instance"`
+	Action         Action     `json:"action"`
+	Reason         string     `json:"reason"`
+	ReasonCode     string     `json:"reasonCode,omitempty"`
+	PowerState     string     `json:"powerState,omitempty"`
+	NextTransition *time.Time `json:"nextTransition,omitempty"`
+	NextAction     Action     `json:"nextAction,omitempty"`
+	Error          string     `json:"error,omitempty"`
+}
+
+// Plan returns an entry for every result in the report, in a stable order
+func (r *Report) Plan() []PlanEntry {
+	var entries []PlanEntry
+
+	r.Sort()
+
+	for _, result := range r.Results {
+		entry := PlanEntry{
+			SubscriptionID: result.SubscriptionID,
+			ResourceGroup:  result.ResourceGroup,
+			Instance:       result.Instance,
+			Action:         result.Action,
+			Reason:         result.Reason,
+			ReasonCode:     result.ReasonCode,
+			PowerState:     result.PowerState,
+			NextAction:     result.NextAction,
+		}
+
+		if !result.NextTransition.IsZero() {
+			nextTransition := result.NextTransition
+			entry.NextTransition = &nextTransition
+		}
+
+		if result.Err != nil {
+			entry.Error = result.Err.Error()
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// WritePlan writes the planned action for every instance in the report, either as a table or JSON
+func (r *Report) WritePlan(w io.Writer, format string) error {
+	entries := r.Plan()
+
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		if entries == nil {
+			entries = []PlanEntry{}
+		}
+
+		return encoder.Encode(entries)
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+		fmt.Fprintln(tw, "SUBSCRIPTION\tRESOURCE GROUP\tINSTANCE\tPOWER STATE\tACTION\tNEXT TRANSITION\tREASON")
+
+		for _, entry := range entries {
+			nextTransition := "-"
+			if entry.NextTransition != nil {
+				nextTransition = entry.NextTransition.Format(time.RFC3339)
+			}
+
+			reason := entry.Reason
+			if entry.Error != "" {
+				reason = entry.Error
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.SubscriptionID, entry.ResourceGroup,
+				entry.Instance, valueOrDash(entry.PowerState), entry.Action, nextTransition, reason)
+		}
+
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format '%s', expected one of table or json", format)
+	}
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
@@ -0,0 +1,43 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWritePlanIsOrdered(t *testing.T) {
+	r := New()
+	r.Add(
+		Result{SubscriptionID: "sub", ResourceGroup: "rg", Instance: "vm-b", Action: ActionStop, Reason: "b"},
+		Result{SubscriptionID: "sub", ResourceGroup: "rg", Instance: "vm-a", Action: ActionStart, Reason: "a"},
+	)
+
+	var buf bytes.Buffer
+	if err := r.WritePlan(&buf, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []PlanEntry
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[0].Instance != "vm-a" || entries[1].Instance != "vm-b" {
+		t.Errorf("got: %+v, want vm-a followed by vm-b", entries)
+	}
+
+	if err := r.WritePlan(&buf, "yaml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,245 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package report
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type Action string
+
+const (
+	ActionNone  Action = "none"
+	ActionStart Action = "start"
+	ActionStop  Action = "stop"
+	ActionError Action = "error"
+	// ActionInProgress is used when an earlier power action on the instance has not finished yet
+	ActionInProgress Action = "in-progress"
+)
+
+type OperationStatus string
+
+const (
+	OperationSucceeded  OperationStatus = "succeeded"
+	OperationFailed     OperationStatus = "failed"
+	OperationInProgress OperationStatus = "in-progress"
+)
+
+// Result is the outcome of assessing a single instance
+type Result struct {
+	InstanceID     string
+	SubscriptionID string
+	ResourceGroup  string
+	Instance       string
+	Action         Action
+	Reason         string
+	ReasonCode     string
+	PowerState     string
+	Err            error
+	// NextTransition is the next time the instance's schedule or patch window changes its desired
+	// state, it is the zero time when it is not known
+	NextTransition time.Time
+	// NextAction is the action the instance will need at its next transition
+	NextAction Action
+	// WarnAt is when the instance's owner is due to be warned of its next stop, it is the zero time
+	// when no warning is due
+	WarnAt time.Time
+	// DesiredState is the power state the schedule, patch window or an override wants the instance
+	// in, either `running` or `stopped`
+	DesiredState string
+	// InvalidTags is true when the instance could not be assessed because of its scheduler tags
+	InvalidTags bool
+	// Trace records how the action was decided
+	Trace *Trace
+}
+
+// OperationResult is the status of a power action issued by an earlier run
+type OperationResult struct {
+	SubscriptionID string
+	ResourceGroup  string
+	Instance       string
+	Method         string
+	Status         OperationStatus
+	Err            error
+}
+
+// SubscriptionFailure records a subscription that could not be processed at all
+type SubscriptionFailure struct {
+	SubscriptionID string
+	Err            error
+}
+
+// Report combines the results of every subscription processed during a run, it is safe to add to
+// the report from multiple goroutines
+type Report struct {
+	Results    []Result
+	Operations []OperationResult
+	Failures   []SubscriptionFailure
+
+	mu sync.Mutex
+}
+
+func New() *Report {
+	return &Report{}
+}
+
+// Add appends instance results to the report
+func (r *Report) Add(results ...Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Results = append(r.Results, results...)
+}
+
+// AddOperations appends the status of tracked operations to the report
+func (r *Report) AddOperations(operations ...OperationResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Operations = append(r.Operations, operations...)
+}
+
+// AddFailure records that a subscription failed to be processed
+func (r *Report) AddFailure(subscriptionID string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Failures = append(r.Failures, SubscriptionFailure{SubscriptionID: subscriptionID, Err: err})
+}
+
+// Sort orders the results and failures by subscription, resource group and instance so that the
+// report is the same regardless of the order work completed in
+func (r *Report) Sort() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sort.SliceStable(r.Results, func(i, j int) bool {
+		a, b := r.Results[i], r.Results[j]
+
+		if !strings.EqualFold(a.SubscriptionID, b.SubscriptionID) {
+			return strings.ToLower(a.SubscriptionID) < strings.ToLower(b.SubscriptionID)
+		}
+
+		if !strings.EqualFold(a.ResourceGroup, b.ResourceGroup) {
+			return strings.ToLower(a.ResourceGroup) < strings.ToLower(b.ResourceGroup)
+		}
+
+		return strings.ToLower(a.Instance) < strings.ToLower(b.Instance)
+	})
+
+	sort.SliceStable(r.Operations, func(i, j int) bool {
+		a, b := r.Operations[i], r.Operations[j]
+
+		if !strings.EqualFold(a.SubscriptionID, b.SubscriptionID) {
+			return strings.ToLower(a.SubscriptionID) < strings.ToLower(b.SubscriptionID)
+		}
+
+		if !strings.EqualFold(a.ResourceGroup, b.ResourceGroup) {
+			return strings.ToLower(a.ResourceGroup) < strings.ToLower(b.ResourceGroup)
+		}
+
+		return strings.ToLower(a.Instance) < strings.ToLower(b.Instance)
+	})
+
+	sort.SliceStable(r.Failures, func(i, j int) bool {
+		return strings.ToLower(r.Failures[i].SubscriptionID) < strings.ToLower(r.Failures[j].SubscriptionID)
+	})
+}
+
+// Counts returns the number of results for each action
+func (r *Report) Counts() map[Action]int {
+	counts := make(map[Action]int)
+
+	for _, result := range r.Results {
+		counts[result.Action]++
+	}
+
+	return counts
+}
+
+// NextTransition returns the earliest transition, or owner warning, after `now` across every result,
+// or the zero time when none of the results have one
+func (r *Report) NextTransition(now time.Time) time.Time {
+	var next time.Time
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, result := range r.Results {
+		for _, at := range []time.Time{result.NextTransition, result.WarnAt} {
+			if at.After(now) && (next.IsZero() || at.Before(next)) {
+				next = at
+			}
+		}
+	}
+
+	return next
+}
+
+// OperationCounts returns the number of tracked operations for each status
+func (r *Report) OperationCounts() map[OperationStatus]int {
+	counts := make(map[OperationStatus]int)
+
+	for _, operation := range r.Operations {
+		counts[operation.Status]++
+	}
+
+	return counts
+}
+
+// HasFailures determines if any subscription, instance or tracked operation failed during the run
+func (r *Report) HasFailures() bool {
+	return len(r.Failures) > 0 || r.Counts()[ActionError] > 0 || r.OperationCounts()[OperationFailed] > 0
+}
+
+// Log writes a summary of the run, along with every failure, to the logger
+func (r *Report) Log() {
+	r.Sort()
+
+	counts := r.Counts()
+	operationCounts := r.OperationCounts()
+
+	for _, failure := range r.Failures {
+		log.Error().Err(failure.Err).Str("subscription", failure.SubscriptionID).Msg("Subscription failed")
+	}
+
+	for _, result := range r.Results {
+		if result.Err != nil {
+			log.Error().Err(result.Err).Str("subscription", result.SubscriptionID).
+				Str("instance", result.Instance).Msg("Instance failed")
+		}
+	}
+
+	for _, operation := range r.Operations {
+		if operation.Status == OperationFailed {
+			log.Error().Err(operation.Err).Str("subscription", operation.SubscriptionID).
+				Str("instance", operation.Instance).Str("method", operation.Method).Msg("Tracked operation failed")
+		}
+	}
+
+	log.Info().
+		Int("instances", len(r.Results)).
+		Int("started", counts[ActionStart]).
+		Int("stopped", counts[ActionStop]).
+		Int("unchanged", counts[ActionNone]).
+		Int("failed", counts[ActionError]).
+		Int("inProgress", counts[ActionInProgress]).
+		Int("operationsSucceeded", operationCounts[OperationSucceeded]).
+		Int("operationsFailed", operationCounts[OperationFailed]).
+		Int("operationsInProgress", operationCounts[OperationInProgress]).
+		Int("failedSubscriptions", len(r.Failures)).
+		Msg("Run summary")
+}
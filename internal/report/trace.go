@@ -0,0 +1,80 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package report
+
+import (
+	"fmt"
+	"time"
+
+	"instancescheduler/internal/schedule"
+)
+
+// Step is a single stage of the decision made for an instance
+type Step struct {
+	Name   string `json:"name"`
+	Detail string `json:"detail"`
+}
+
+// PatchWindowTrace is the state of an instance's patch window at the time of the decision
+type PatchWindowTrace struct {
+	Configured bool       `json:"configured"`
+	IsToday    bool       `json:"isToday"`
+	Within     bool       `json:"withinPatchWindow"`
+	PreStart   bool       `json:"withinPreStart"`
+	NextStart  *time.Time `json:"nextStart,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// SuppressedAction is an action chosen for an instance that was not taken to stop it flapping
+type SuppressedAction struct {
+	Action Action `json:"action"`
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+}
+
+// Trace records every input and step that led to the action chosen for an instance
+type Trace struct {
+	Tags           map[string]string  `json:"tags"`
+	Schedule       *schedule.Schedule `json:"schedule,omitempty"`
+	ScheduleSource string             `json:"scheduleSource,omitempty"`
+	Windows        []string           `json:"windows,omitempty"`
+	ShouldShutdown bool               `json:"shouldShutdown"`
+	PatchWindow    PatchWindowTrace   `json:"patchWindow"`
+	PowerState     string             `json:"powerState,omitempty"`
+	StopMode       string             `json:"stopMode,omitempty"`
+	Action         Action             `json:"action"`
+	Rule           string             `json:"rule,omitempty"`
+	Reason         string             `json:"reason,omitempty"`
+	Suppressed     []SuppressedAction `json:"suppressed,omitempty"`
+	Steps          []Step             `json:"steps"`
+}
+
+// NewTrace returns a trace for an instance with the given tags
+func NewTrace(tags map[string]*string) *Trace {
+	trace := &Trace{Tags: make(map[string]string)}
+
+	for key, value := range tags {
+		if value != nil {
+			trace.Tags[key] = *value
+		}
+	}
+
+	return trace
+}
+
+// Step appends a step to the trace
+func (t *Trace) Step(name, format string, args ...any) {
+	if t == nil {
+		return
+	}
+
+	t.Steps = append(t.Steps, Step{Name: name, Detail: fmt.Sprintf(format, args...)})
+}
@@ -0,0 +1,229 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package savings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// DefaultCurrency is the currency prices are refreshed in when the table does not have one
+const DefaultCurrency = "USD"
+
+// RetailPricesURL is the Azure retail prices API, it does not require authentication
+const RetailPricesURL = "https://prices.azure.com/api/retail/prices"
+
+// Price is the pay-as-you-go hourly price of a VM size in a region
+type Price struct {
+	Size   string  `yaml:"size"`
+	Region string  `yaml:"region"`
+	Hourly float64 `yaml:"hourly"`
+}
+
+// PriceTable is the hourly price of each VM size by region, read from a YAML or JSON file
+type PriceTable struct {
+	Currency string `yaml:"currency"`
+	// UpdatedAt is when prices were last refreshed from the retail prices API
+	UpdatedAt time.Time `yaml:"updatedAt,omitempty"`
+	Prices    []Price   `yaml:"prices"`
+}
+
+// Key is a VM size in a region
+type Key struct {
+	Size   string
+	Region string
+}
+
+func (k Key) normalise() Key {
+	return Key{Size: strings.ToLower(k.Size), Region: strings.ToLower(k.Region)}
+}
+
+// LoadPrices reads the price table at `path`, returning an empty table when the file does not exist
+// yet
+func LoadPrices(path string) (*PriceTable, error) {
+	table := &PriceTable{}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return table, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, table); err != nil {
+		return nil, err
+	}
+
+	return table, nil
+}
+
+// Save writes the price table to `path` as YAML
+func (p *PriceTable) Save(path string) error {
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Hourly returns the hourly price of a VM size in a region, matched case-insensitively
+func (p *PriceTable) Hourly(key Key) (float64, bool) {
+	key = key.normalise()
+
+	for _, price := range p.Prices {
+		if (Key{Size: price.Size, Region: price.Region}).normalise() == key {
+			return price.Hourly, true
+		}
+	}
+
+	return 0, false
+}
+
+// Set adds or replaces the hourly price of a VM size in a region
+func (p *PriceTable) Set(key Key, hourly float64) {
+	for i, price := range p.Prices {
+		if (Key{Size: price.Size, Region: price.Region}).normalise() == key.normalise() {
+			p.Prices[i].Hourly = hourly
+			return
+		}
+	}
+
+	p.Prices = append(p.Prices, Price{Size: key.Size, Region: key.Region, Hourly: hourly})
+
+	sort.SliceStable(p.Prices, func(i, j int) bool {
+		a, b := p.Prices[i], p.Prices[j]
+		if !strings.EqualFold(a.Region, b.Region) {
+			return strings.ToLower(a.Region) < strings.ToLower(b.Region)
+		}
+
+		return strings.ToLower(a.Size) < strings.ToLower(b.Size)
+	})
+}
+
+// retailPrice is a single item returned by the retail prices API
+type retailPrice struct {
+	RetailPrice        float64   `json:"retailPrice"`
+	UnitOfMeasure      string    `json:"unitOfMeasure"`
+	SkuName            string    `json:"skuName"`
+	ProductName        string    `json:"productName"`
+	EffectiveStartDate time.Time `json:"effectiveStartDate"`
+}
+
+// Refresh fetches the Linux pay-as-you-go price of each VM size and region from the retail prices
+// API at `baseURL`, such as `RetailPricesURL`, in the table's currency. Prices for other sizes and
+// regions are kept, so that prices added by hand survive a refresh. The sizes the API has no price
+// for are returned. The table is left unchanged when any price cannot be fetched.
+func (p *PriceTable) Refresh(ctx context.Context, client *http.Client, baseURL string, keys []Key) ([]Key, error) {
+	var missing []Key
+
+	currency := p.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
+	fetched := make(map[Key]float64, len(keys))
+
+	for _, key := range keys {
+		hourly, ok, err := fetchPrice(ctx, client, baseURL, currency, key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch the price of %s in %s: %w", key.Size, key.Region, err)
+		}
+
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+
+		fetched[key] = hourly
+	}
+
+	p.Currency = currency
+
+	for key, hourly := range fetched {
+		p.Set(key, hourly)
+	}
+
+	p.UpdatedAt = time.Now().UTC()
+
+	return missing, nil
+}
+
+// fetchPrice returns the current Linux pay-as-you-go hourly price of a VM size in a region, following
+// the API's pages. Spot, low priority and Windows prices are ignored.
+func fetchPrice(ctx context.Context, client *http.Client, baseURL, currency string, key Key) (float64, bool, error) {
+	var best *retailPrice
+
+	query := url.Values{}
+	query.Set("currencyCode", currency)
+	query.Set("$filter", fmt.Sprintf("serviceName eq 'Virtual Machines' and priceType eq 'Consumption' and "+
+		"armRegionName eq '%s' and armSkuName eq '%s'", strings.ToLower(key.Region), key.Size))
+
+	next := baseURL + "?" + query.Encode()
+
+	for next != "" {
+		var page struct {
+			Items        []retailPrice `json:"Items"`
+			NextPageLink string        `json:"NextPageLink"`
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, nil)
+		if err != nil {
+			return 0, false, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return 0, false, fmt.Errorf("retail prices API returned %s", resp.Status)
+		}
+
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+
+		if err != nil {
+			return 0, false, err
+		}
+
+		for i, item := range page.Items {
+			if item.UnitOfMeasure != "1 Hour" || strings.Contains(item.SkuName, "Spot") ||
+				strings.Contains(item.SkuName, "Low Priority") || strings.Contains(item.ProductName, "Windows") {
+				continue
+			}
+
+			if best == nil || item.EffectiveStartDate.After(best.EffectiveStartDate) {
+				best = &page.Items[i]
+			}
+		}
+
+		next = page.NextPageLink
+	}
+
+	if best == nil {
+		return 0, false, nil
+	}
+
+	return best.RetailPrice, true, nil
+}
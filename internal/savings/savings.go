@@ -0,0 +1,209 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package savings
+
+import (
+	"sort"
+	"strings"
+
+	"instancescheduler/internal/azure"
+	"instancescheduler/internal/schedule"
+)
+
+const (
+	// HoursPerWeek is how many hours an always-on instance runs each week
+	HoursPerWeek = 168
+	// HoursPerMonth is the average number of hours in a month, as used by Azure pricing
+	HoursPerMonth = 730
+)
+
+// NoOwner is the owner used for instances without an owner tag
+const NoOwner = "(none)"
+
+// Notes explaining why an instance is left out of the totals
+const (
+	NoteInvalidSchedule = "schedule is invalid"
+	NoteNoPrice         = "no price for size in region"
+)
+
+// Instance is the estimated monthly cost of a scheduled instance, on its schedule and always on
+type Instance struct {
+	SubscriptionID string  `json:"subscriptionId"`
+	ResourceGroup  string  `json:"resourceGroup"`
+	Instance       string  `json:"instance"`
+	Owner          string  `json:"owner"`
+	Size           string  `json:"size"`
+	Region         string  `json:"region"`
+	HourlyPrice    float64 `json:"hourlyPrice"`
+	WeeklyHours    float64 `json:"weeklyHours"`
+	AlwaysOn       float64 `json:"alwaysOn"`
+	Scheduled      float64 `json:"scheduled"`
+	Savings        float64 `json:"savings"`
+	// Note is why the instance is left out of the totals, it is empty when it is included
+	Note string `json:"note,omitempty"`
+}
+
+// Group is the estimated monthly cost of the priced instances within a group
+type Group struct {
+	Group     string  `json:"group"`
+	Instances int     `json:"instances"`
+	AlwaysOn  float64 `json:"alwaysOn"`
+	Scheduled float64 `json:"scheduled"`
+	Savings   float64 `json:"savings"`
+}
+
+// Percent returns the share of the always-on cost that is saved
+func (g Group) Percent() float64 {
+	if g.AlwaysOn == 0 {
+		return 0
+	}
+
+	return g.Savings / g.AlwaysOn * 100
+}
+
+func (g *Group) add(instance Instance) {
+	g.Instances++
+	g.AlwaysOn += instance.AlwaysOn
+	g.Scheduled += instance.Scheduled
+	g.Savings += instance.Savings
+}
+
+// Report is the estimated monthly savings of every scheduled instance, with totals by resource
+// group, owner and subscription
+type Report struct {
+	Currency       string     `json:"currency"`
+	Instances      []Instance `json:"instances"`
+	ResourceGroups []Group    `json:"resourceGroups"`
+	Owners         []Group    `json:"owners"`
+	Subscriptions  []Group    `json:"subscriptions"`
+	Total          Group      `json:"total"`
+}
+
+// Estimate compares the monthly cost of every instance with scheduling enabled on its schedule's
+// weekly on-hours against running it all week. Only the schedule is counted, the patch window,
+// overrides and manual changes are not. Instances with an invalid schedule, or without a price for
+// their size and region, are listed with a note and left out of the totals.
+func Estimate(tags *azure.Tags, instances []azure.Instance, prices *PriceTable, ownerTag string) *Report {
+	report := &Report{Currency: prices.Currency, Instances: []Instance{}, Total: Group{Group: "total"}}
+
+	resourceGroups := make(map[string]*Group)
+	owners := make(map[string]*Group)
+	subscriptions := make(map[string]*Group)
+
+	for _, instance := range instances {
+		values := tags.LoadValues(instance.Tags)
+		if !values.Enabled {
+			continue
+		}
+
+		_, owner, _ := azure.LookupTag(instance.Tags, ownerTag)
+		if owner == "" {
+			owner = NoOwner
+		}
+
+		entry := Instance{
+			SubscriptionID: instance.SubscriptionID,
+			ResourceGroup:  instance.ResourceGroup,
+			Instance:       instance.Name,
+			Owner:          owner,
+			Size:           instance.Size,
+			Region:         instance.Location,
+		}
+
+		s, err := schedule.NewSchedule([]byte(values.Schedule))
+		if err != nil || !s.Validate() || !s.ValidateOverrides() {
+			entry.Note = NoteInvalidSchedule
+			report.Instances = append(report.Instances, entry)
+			continue
+		}
+
+		entry.WeeklyHours = s.WeeklyHours()
+
+		hourly, ok := prices.Hourly(Key{Size: instance.Size, Region: instance.Location})
+		if !ok {
+			entry.Note = NoteNoPrice
+			report.Instances = append(report.Instances, entry)
+			continue
+		}
+
+		entry.HourlyPrice = hourly
+		entry.AlwaysOn = hourly * HoursPerMonth
+		entry.Scheduled = hourly * entry.WeeklyHours / HoursPerWeek * HoursPerMonth
+		entry.Savings = entry.AlwaysOn - entry.Scheduled
+
+		report.Instances = append(report.Instances, entry)
+
+		resourceGroup := instance.SubscriptionID + "/" + instance.ResourceGroup
+
+		for _, g := range []*Group{
+			group(resourceGroups, strings.ToLower(resourceGroup), resourceGroup),
+			group(owners, strings.ToLower(owner), owner),
+			group(subscriptions, strings.ToLower(instance.SubscriptionID), instance.SubscriptionID),
+			&report.Total,
+		} {
+			g.add(entry)
+		}
+	}
+
+	sort.SliceStable(report.Instances, func(i, j int) bool {
+		a, b := report.Instances[i], report.Instances[j]
+
+		return strings.ToLower(a.SubscriptionID+"/"+a.ResourceGroup+"/"+a.Instance) <
+			strings.ToLower(b.SubscriptionID+"/"+b.ResourceGroup+"/"+b.Instance)
+	})
+
+	report.ResourceGroups = sortedGroups(resourceGroups)
+	report.Owners = sortedGroups(owners)
+	report.Subscriptions = sortedGroups(subscriptions)
+
+	return report
+}
+
+// Keys returns every distinct VM size and region among the instances with scheduling enabled, the
+// prices needed to estimate their savings
+func Keys(tags *azure.Tags, instances []azure.Instance) []Key {
+	var keys []Key
+
+	seen := make(map[Key]bool)
+
+	for _, instance := range instances {
+		key := Key{Size: instance.Size, Region: instance.Location}
+		if key.Size == "" || key.Region == "" || seen[key.normalise()] || !tags.LoadValues(instance.Tags).Enabled {
+			continue
+		}
+
+		seen[key.normalise()] = true
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func group(groups map[string]*Group, key, name string) *Group {
+	if _, ok := groups[key]; !ok {
+		groups[key] = &Group{Group: name}
+	}
+
+	return groups[key]
+}
+
+func sortedGroups(groups map[string]*Group) []Group {
+	sorted := make([]Group, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, *g)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return strings.ToLower(sorted[i].Group) < strings.ToLower(sorted[j].Group)
+	})
+
+	return sorted
+}
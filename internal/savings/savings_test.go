@@ -0,0 +1,165 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package savings
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"instancescheduler/internal/azure"
+)
+
+func instance(name, size string, tags map[string]string) azure.Instance {
+	instance := azure.Instance{Name: name, ResourceGroup: "rg", SubscriptionID: "sub", Location: "australiaeast",
+		Size: size, Tags: map[string]*string{}}
+
+	for key, value := range tags {
+		value := value
+		instance.Tags[key] = &value
+	}
+
+	return instance
+}
+
+// TestEstimate checks the savings of each instance and that unpriced or invalid instances are left out
+// of the totals
+func TestEstimate(t *testing.T) {
+	tags := &azure.Tags{InstanceSchedulingEnabled: "enabled", InstanceSchedulingSchedule: "schedule"}
+	prices := &PriceTable{
+		Currency: "USD",
+		Prices:   []Price{{Size: "Standard_D2s_v3", Region: "AustraliaEast", Hourly: 0.168}},
+	}
+
+	weekdays := `{"default":"09:00-17:00","overrides":{"saturday":["-"],"sunday":["-"]}}`
+
+	instances := []azure.Instance{
+		instance("vm-a", "Standard_D2s_v3", map[string]string{"enabled": "true", "schedule": weekdays, "Owner": "jo"}),
+		instance("vm-b", "Standard_E4s_v3", map[string]string{"enabled": "true", "schedule": weekdays}),
+		instance("vm-c", "Standard_D2s_v3", map[string]string{"enabled": "true", "schedule": "{"}),
+		instance("vm-d", "Standard_D2s_v3", map[string]string{"enabled": "false", "schedule": weekdays}),
+	}
+
+	got := Estimate(tags, instances, prices, "owner")
+
+	testCases := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{name: "instances", got: len(got.Instances), want: 3},
+		{name: "saving", got: round(got.Instances[0].Savings), want: round(0.168 * 730 * 128 / 168)},
+		{name: "owner", got: got.Instances[0].Owner, want: "jo"},
+		{name: "unpriced", got: got.Instances[1].Note, want: NoteNoPrice},
+		{name: "invalid schedule", got: got.Instances[2].Note, want: NoteInvalidSchedule},
+		{name: "total instances", got: got.Total.Instances, want: 1},
+		{name: "total saved", got: math.Round(got.Total.Percent()), want: math.Round(128.0 / 168 * 100)},
+		{name: "owners", got: len(got.Owners), want: 1},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if test.got != test.want {
+				t.Errorf("got: %v, want: %v", test.got, test.want)
+			}
+		})
+	}
+}
+
+// TestRefresh checks the Linux pay-as-you-go price is picked from the retail prices API's pages
+func TestRefresh(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "" {
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"Items": []map[string]any{
+					{"retailPrice": 0.02, "unitOfMeasure": "1 Hour", "skuName": "D2s v3 Spot",
+						"productName": "Virtual Machines DSv3 Series"},
+					{"retailPrice": 0.26, "unitOfMeasure": "1 Hour", "skuName": "D2s v3",
+						"productName": "Virtual Machines DSv3 Series Windows"},
+				},
+				"NextPageLink": server.URL + "?page=2",
+			})
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"Items": []map[string]any{
+				{"retailPrice": 0.168, "unitOfMeasure": "1 Hour", "skuName": "D2s v3",
+					"productName": "Virtual Machines DSv3 Series"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	table := &PriceTable{}
+
+	missing, err := table.Refresh(context.Background(), server.Client(), server.URL,
+		[]Key{{Size: "Standard_D2s_v3", Region: "australiaeast"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(missing) != 0 {
+		t.Errorf("got: %v, want: no missing prices", missing)
+	}
+
+	if got, _ := table.Hourly(Key{Size: "standard_d2s_v3", Region: "AustraliaEast"}); got != 0.168 {
+		t.Errorf("got: %v, want: %v", got, 0.168)
+	}
+
+	if table.Currency != DefaultCurrency {
+		t.Errorf("got: %v, want: %v", table.Currency, DefaultCurrency)
+	}
+}
+
+// TestRefreshFailed checks the table is left unchanged when a price cannot be fetched, so that the
+// local prices can still be used
+func TestRefreshFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Query().Get("$filter"), "Standard_D4s_v3") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"Items": []map[string]any{
+				{"retailPrice": 0.168, "unitOfMeasure": "1 Hour", "skuName": "D2s v3",
+					"productName": "Virtual Machines DSv3 Series"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	table := &PriceTable{Prices: []Price{{Size: "Standard_D2s_v3", Region: "australiaeast", Hourly: 0.1}}}
+	want := &PriceTable{Prices: []Price{{Size: "Standard_D2s_v3", Region: "australiaeast", Hourly: 0.1}}}
+
+	_, err := table.Refresh(context.Background(), server.Client(), server.URL, []Key{
+		{Size: "Standard_D2s_v3", Region: "australiaeast"},
+		{Size: "Standard_D4s_v3", Region: "australiaeast"},
+	})
+	if err == nil {
+		t.Fatal("got: no error, want: an error")
+	}
+
+	if !reflect.DeepEqual(table, want) {
+		t.Errorf("got: %+v, want: %+v", table, want)
+	}
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,153 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package savings
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"instancescheduler/internal/report"
+)
+
+// Write writes the estimate as a table, JSON, CSV or Markdown. The CSV has a row for every instance
+// and group, distinguished by the `record` column.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case report.FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(r)
+	case report.FormatTable:
+		return r.writeTable(w)
+	case report.FormatCSV:
+		return r.writeCSV(w)
+	case report.FormatMarkdown:
+		return r.writeMarkdown(w)
+	default:
+		return fmt.Errorf("unknown output format '%s', expected one of table, json, csv or markdown", format)
+	}
+}
+
+// sections are the groups the totals are broken down by, in the order they are written
+func (r *Report) sections() []struct {
+	record string
+	title  string
+	groups []Group
+} {
+	return []struct {
+		record string
+		title  string
+		groups []Group
+	}{
+		{record: "resource-group", title: "Resource group", groups: r.ResourceGroups},
+		{record: "owner", title: "Owner", groups: r.Owners},
+		{record: "subscription", title: "Subscription", groups: r.Subscriptions},
+		{record: "total", title: "Total", groups: []Group{r.Total}},
+	}
+}
+
+func (r *Report) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "SUBSCRIPTION\tRESOURCE GROUP\tINSTANCE\tOWNER\tSIZE\tREGION\tHOURS/WEEK\tALWAYS ON (%s)\t"+
+		"SCHEDULED (%s)\tSAVINGS (%s)\tNOTE\n", r.Currency, r.Currency, r.Currency)
+
+	for _, i := range r.Instances {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%.1f\t%.2f\t%.2f\t%.2f\t%s\n", i.SubscriptionID, i.ResourceGroup,
+			i.Instance, i.Owner, i.Size, i.Region, i.WeeklyHours, i.AlwaysOn, i.Scheduled, i.Savings, i.Note)
+	}
+
+	for _, section := range r.sections() {
+		fmt.Fprintln(tw)
+		fmt.Fprintf(tw, "%s\tINSTANCES\tALWAYS ON\tSCHEDULED\tSAVINGS\tSAVED\n", strings.ToUpper(section.title))
+
+		for _, g := range section.groups {
+			fmt.Fprintf(tw, "%s\t%d\t%.2f\t%.2f\t%.2f\t%.0f%%\n", g.Group, g.Instances, g.AlwaysOn, g.Scheduled,
+				g.Savings, g.Percent())
+		}
+	}
+
+	return tw.Flush()
+}
+
+func (r *Report) writeCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	money := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', 2, 64)
+	}
+
+	_ = writer.Write([]string{"record", "subscription", "resource_group", "instance", "owner", "size", "region",
+		"hourly_price", "weekly_hours", "group", "instances", "currency", "always_on", "scheduled", "savings", "note"})
+
+	for _, i := range r.Instances {
+		_ = writer.Write([]string{"instance", i.SubscriptionID, i.ResourceGroup, i.Instance, i.Owner, i.Size,
+			i.Region, strconv.FormatFloat(i.HourlyPrice, 'f', -1, 64), strconv.FormatFloat(i.WeeklyHours, 'f', -1, 64),
+			"", "", r.Currency, money(i.AlwaysOn), money(i.Scheduled), money(i.Savings), i.Note})
+	}
+
+	for _, section := range r.sections() {
+		for _, g := range section.groups {
+			_ = writer.Write([]string{section.record, "", "", "", "", "", "", "", "", g.Group,
+				strconv.Itoa(g.Instances), r.Currency, money(g.AlwaysOn), money(g.Scheduled), money(g.Savings), ""})
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+func (r *Report) writeMarkdown(w io.Writer) error {
+	fmt.Fprintln(w, "## Estimated monthly savings")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%.2f %s of %.2f %s a month is saved (%.0f%%) across %d priced instances.\n", r.Total.Savings,
+		r.Currency, r.Total.AlwaysOn, r.Currency, r.Total.Percent(), r.Total.Instances)
+
+	for _, section := range r.sections()[:3] {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "## By %s\n", strings.ToLower(section.title))
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "| %s | Instances | Always on | Scheduled | Savings | Saved |\n", section.title)
+		fmt.Fprintln(w, "| --- | ---: | ---: | ---: | ---: | ---: |")
+
+		for _, g := range section.groups {
+			fmt.Fprintf(w, "| %s | %d | %.2f | %.2f | %.2f | %.0f%% |\n", markdownCell(g.Group), g.Instances,
+				g.AlwaysOn, g.Scheduled, g.Savings, g.Percent())
+		}
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "## By instance")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| Subscription | Resource group | Instance | Owner | Size | Region | Hours/week | Always on | "+
+		"Scheduled | Savings | Note |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- | --- | --- | ---: | ---: | ---: | ---: | --- |")
+
+	for _, i := range r.Instances {
+		fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %s | %.1f | %.2f | %.2f | %.2f | %s |\n",
+			markdownCell(i.SubscriptionID), markdownCell(i.ResourceGroup), markdownCell(i.Instance),
+			markdownCell(i.Owner), i.Size, i.Region, i.WeeklyHours, i.AlwaysOn, i.Scheduled, i.Savings, i.Note)
+	}
+
+	return nil
+}
+
+// markdownCell escapes a value so that it does not break a Markdown table
+func markdownCell(value string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(value)
+}
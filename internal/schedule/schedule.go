@@ -12,6 +12,7 @@ package schedule
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 
@@ -88,64 +89,120 @@ func (s *Schedule) ValidateOverrides() bool {
 }
 
 func (s *Schedule) ShouldShutdown() bool {
-	var result bool
-	var now time.Time = time.Now().Local()
+	return s.ShouldShutdownAt(time.Now().Local())
+}
+
+// ShouldShutdownAt determines if an instance should be off at `now`, which is whenever `now` does
+// not fall within any of the day's windows
+func (s *Schedule) ShouldShutdownAt(now time.Time) bool {
 	shouldOverride, overrideKey := s.UseOverride(now.Weekday())
 
 	if shouldOverride {
 		log.Debug().Msg("Using override schdeule")
-
-		for _, t := range s.Overrides[overrideKey] {
-			log.Info().Msg(t)
-
-			if t == "-" {
-				return true
-			}
-
-			start, end, err := ParseWindow(t)
-			if err != nil {
-				return false
-			}
-
-			if (now.After(start) || now.Equal(start)) && now.Before(end) {
-				result = false
-			} else {
-				result = true
-				return result
-			}
-		}
 	} else {
 		log.Debug().Msg("Using default schedule")
+	}
+
+	for _, t := range s.WindowsFor(now.Weekday()) {
+		if t == "-" {
+			return true
+		}
 
-		start, end, err := ParseWindow(s.Default)
+		start, end, err := ParseWindowOn(t, now)
 		if err != nil {
+			log.Error().Stack().Err(err).Str("override", overrideKey).Msg("Failed to parse the time window")
 			return false
 		}
 
 		if (now.After(start) || now.Equal(start)) && now.Before(end) {
-			result = false
-		} else {
-			result = true
-			return result
+			return false
 		}
-
 	}
 
-	return result
+	return true
 }
 
 func (s *Schedule) UseOverride(weekday time.Weekday) (bool, string) {
 	for key := range s.Overrides {
-		if strings.ToLower(key) == strings.ToLower(weekday.String()) {
+		if strings.EqualFold(key, weekday.String()) {
 			return true, key
-		} else {
-			return false, ""
 		}
 	}
 
 	return false, ""
 }
 
+// WindowsFor returns the time windows that apply on a given weekday, either from the day's override
+// or the default
+func (s *Schedule) WindowsFor(weekday time.Weekday) []string {
+	if shouldOverride, overrideKey := s.UseOverride(weekday); shouldOverride {
+		return s.Overrides[overrideKey]
+	}
+
+	return []string{s.Default}
+}
+
+// NextTransition returns the next time after `now` that the schedule starts or ends a window, up to
+// a week ahead. The zero time is returned when the schedule never changes state.
+func (s *Schedule) NextTransition(now time.Time) time.Time {
+	for offset := 0; offset <= 7; offset++ {
+		var next time.Time
+
+		day := now.AddDate(0, 0, offset)
+
+		for _, window := range s.WindowsFor(day.Weekday()) {
+			if window == "-" {
+				continue
+			}
+
+			start, end, err := ParseWindowOn(window, day)
+			if err != nil {
+				continue
+			}
+
+			for _, boundary := range []time.Time{start, end} {
+				if boundary.After(now) && (next.IsZero() || boundary.Before(next)) {
+					next = boundary
+				}
+			}
+		}
+
+		if !next.IsZero() {
+			return next
+		}
+	}
+
+	return time.Time{}
+}
+
+// WeeklyHours returns how many hours a week the schedule wants an instance on, summing the windows
+// that apply on each day of the week
+func (s *Schedule) WeeklyHours() float64 {
+	var total time.Duration
+
+	// a week without daylight saving changes, starting on a Sunday
+	sunday := time.Date(2024, time.January, 7, 0, 0, 0, 0, time.UTC)
+
+	for offset := 0; offset < 7; offset++ {
+		day := sunday.AddDate(0, 0, offset)
+
+		for _, window := range s.WindowsFor(day.Weekday()) {
+			if window == "-" {
+				continue
+			}
+
+			start, end, err := ParseWindowOn(window, day)
+			if err != nil || !end.After(start) {
+				continue
+			}
+
+			total += end.Sub(start)
+		}
+	}
+
+	return total.Hours()
+}
+
 func (s *Schedule) HasOverrides() bool {
 	if len(s.Overrides) > 0 {
 		return true
@@ -198,9 +255,18 @@ func (s *Schedule) IsWithinPatchWindow(start, end time.Time, isToday bool) bool
 }
 
 func ParseWindow(data string) (time.Time, time.Time, error) {
-	var now time.Time = time.Now().Local()
+	return ParseWindowOn(data, time.Now().Local())
+}
+
+// ParseWindowOn parses a time window, such as `09:00-17:00`, as times on the same date as `day`
+func ParseWindowOn(data string, day time.Time) (time.Time, time.Time, error) {
+	var now time.Time = day
 	var timeWindows []string = strings.Split(data, "-")
 
+	if len(timeWindows) != 2 {
+		return time.Now(), time.Now(), fmt.Errorf("invalid time window '%s', expected 'HH:MM-HH:MM'", data)
+	}
+
 	start, err := time.Parse("15:04", timeWindows[0])
 	if err != nil {
 		return time.Now(), time.Now(), err
@@ -12,6 +12,7 @@ package schedule
 
 import (
 	"testing"
+	"time"
 )
 
 func TestSchedules(t *testing.T) {
@@ -22,12 +23,12 @@ func TestSchedules(t *testing.T) {
 	}{
 		{
 			name: "default_single_window",
-			data: `{"default":["09:00-17:00"]}`,
+			data: `{"default":"09:00-17:00"}`,
 			want: true,
 		},
 		{
 			name: "default_invalid_time",
-			data: `{"default":["18:00-17:00"]}`,
+			data: `{"default":"18:00-17:00"}`,
 			want: false,
 		},
 	}
@@ -47,3 +48,159 @@ func TestSchedules(t *testing.T) {
 		})
 	}
 }
+
+func TestNextTransition(t *testing.T) {
+	// Wednesday 2026-10-14
+	wednesday := time.Date(2026, time.October, 14, 0, 0, 0, 0, time.Local)
+
+	testCases := []struct {
+		name string
+		data string
+		now  time.Time
+		want time.Time
+	}{
+		{
+			name: "before_default_start",
+			data: `{"default":"09:00-17:00"}`,
+			now:  wednesday.Add(8 * time.Hour),
+			want: wednesday.Add(9 * time.Hour),
+		},
+		{
+			name: "within_default_window",
+			data: `{"default":"09:00-17:00"}`,
+			now:  wednesday.Add(12 * time.Hour),
+			want: wednesday.Add(17 * time.Hour),
+		},
+		{
+			name: "after_default_end",
+			data: `{"default":"09:00-17:00"}`,
+			now:  wednesday.Add(18 * time.Hour),
+			want: wednesday.AddDate(0, 0, 1).Add(9 * time.Hour),
+		},
+		{
+			name: "skips_off_override",
+			data: `{"default":"09:00-17:00","overrides":{"thursday":["-"],"Friday":["10:00-12:00"]}}`,
+			now:  wednesday.Add(18 * time.Hour),
+			want: wednesday.AddDate(0, 0, 2).Add(10 * time.Hour),
+		},
+		{
+			name: "never_on",
+			data: `{"default":"09:00-17:00","overrides":{"monday":["-"],"tuesday":["-"],"wednesday":["-"],` +
+				`"thursday":["-"],"friday":["-"],"saturday":["-"],"sunday":["-"]}}`,
+			now:  wednesday,
+			want: time.Time{},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := NewSchedule([]byte(test.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := s.NextTransition(test.now)
+
+			if !got.Equal(test.want) {
+				t.Errorf("got: %s, want: %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestShouldShutdownAt(t *testing.T) {
+	// Monday 2026-10-12
+	monday := time.Date(2026, time.October, 12, 0, 0, 0, 0, time.Local)
+	data := `{"default":"09:00-17:00","overrides":{"monday":["09:00-12:00","17:00-21:00"],"sunday":["-"]}}`
+
+	testCases := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{
+			name: "override_first_window",
+			now:  monday.Add(10 * time.Hour),
+			want: false,
+		},
+		{
+			name: "override_between_windows",
+			now:  monday.Add(14 * time.Hour),
+			want: true,
+		},
+		{
+			name: "override_second_window",
+			now:  monday.Add(18 * time.Hour),
+			want: false,
+		},
+		{
+			name: "default_window",
+			now:  monday.AddDate(0, 0, 1).Add(10 * time.Hour),
+			want: false,
+		},
+		{
+			name: "default_outside_window",
+			now:  monday.AddDate(0, 0, 1).Add(18 * time.Hour),
+			want: true,
+		},
+		{
+			name: "override_off",
+			now:  monday.AddDate(0, 0, 6).Add(10 * time.Hour),
+			want: true,
+		},
+	}
+
+	s, err := NewSchedule([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			got := s.ShouldShutdownAt(test.now)
+
+			if got != test.want {
+				t.Errorf("got: %t, want: %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWeeklyHours(t *testing.T) {
+	testCases := []struct {
+		name string
+		data string
+		want float64
+	}{
+		{
+			name: "default_every_day",
+			data: `{"default":"09:00-17:00"}`,
+			want: 56,
+		},
+		{
+			name: "weekends_off",
+			data: `{"default":"09:00-17:00","overrides":{"saturday":["-"],"Sunday":["-"]}}`,
+			want: 40,
+		},
+		{
+			name: "split_override",
+			data: `{"default":"08:00-18:00","overrides":{"saturday":["09:00-11:00","13:00-14:30"],"sunday":["-"]}}`,
+			want: 53.5,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := NewSchedule([]byte(test.data))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := s.WeeklyHours()
+
+			if got != test.want {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"instancescheduler/internal/report"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// transitionDelay is added to a schedule or patch window transition before waking, so that the
+	// run happens once the desired state has changed rather than just before it
+	transitionDelay = 5 * time.Second
+	// minimumWait stops the loop from spinning when a transition is imminent
+	minimumWait = 10 * time.Second
+)
+
+// Serve reconciles every instance in scope on `interval`, waking early for the next schedule or
+// patch window transition. Errors are logged and the loop carries on, it only returns once `ctx`
+// is cancelled.
+func (s *Scheduler) Serve(ctx context.Context, interval time.Duration) {
+	log.Info().Dur("interval", interval).Msg("Starting reconcile loop")
+
+	for {
+		var next time.Time
+
+		runReport, err := s.Run(ctx)
+		s.Options.Metrics.ObserveRun(runReport, err, time.Now())
+
+		if err != nil {
+			log.Error().Err(err).Msg("Reconcile failed")
+		} else {
+			runReport.Log()
+			next = runReport.NextTransition(time.Now())
+			s.setLastReport(runReport, time.Now())
+		}
+
+		wait := nextWait(time.Now(), interval, next)
+
+		log.Info().Dur("wait", wait).Time("nextRun", time.Now().Add(wait)).Msg("Waiting for next reconcile")
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Info().Msg("Stopping reconcile loop")
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// nextWait returns how long to wait before the next run, which is the interval unless a transition
+// happens sooner
+func nextWait(now time.Time, interval time.Duration, transition time.Time) time.Duration {
+	wait := interval
+
+	if !transition.IsZero() {
+		if untilTransition := transition.Sub(now) + transitionDelay; untilTransition < wait {
+			wait = untilTransition
+		}
+	}
+
+	return max(wait, minimumWait)
+}
+
+// LastReport returns the report of the latest reconcile made by Serve and when it finished, the
+// report is nil until the first reconcile has finished
+func (s *Scheduler) LastReport() (*report.Report, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.last, s.lastAt
+}
+
+func (s *Scheduler) setLastReport(runReport *report.Report, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.last, s.lastAt = runReport, at
+}
@@ -0,0 +1,61 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextWait(t *testing.T) {
+	now := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name       string
+		interval   time.Duration
+		transition time.Time
+		want       time.Duration
+	}{
+		{
+			name:     "no_transition",
+			interval: 15 * time.Minute,
+			want:     15 * time.Minute,
+		},
+		{
+			name:       "transition_after_interval",
+			interval:   15 * time.Minute,
+			transition: now.Add(time.Hour),
+			want:       15 * time.Minute,
+		},
+		{
+			name:       "transition_before_interval",
+			interval:   15 * time.Minute,
+			transition: now.Add(5 * time.Minute),
+			want:       5*time.Minute + transitionDelay,
+		},
+		{
+			name:       "imminent_transition",
+			interval:   15 * time.Minute,
+			transition: now.Add(time.Second),
+			want:       minimumWait,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			got := nextWait(now, test.interval, test.transition)
+
+			if got != test.want {
+				t.Errorf("got: %s, want: %s", got, test.want)
+			}
+		})
+	}
+}
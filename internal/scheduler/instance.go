@@ -0,0 +1,88 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"instancescheduler/internal/azure"
+	"instancescheduler/internal/report"
+)
+
+var (
+	// ErrInstanceNotFound is returned when no instance with scheduling enabled matches a name or
+	// resource ID
+	ErrInstanceNotFound = errors.New("instance not found or scheduling is not enabled for it")
+	// ErrAmbiguousInstance is returned when more than one instance matches a name
+	ErrAmbiguousInstance = errors.New("more than one instance has the name, use its resource ID instead")
+)
+
+// Explain assesses the instances matching a name or resource ID as a dry run, without changing the
+// scheduler's own options, so that it is safe to call while Serve is running
+func (s *Scheduler) Explain(ctx context.Context, nameOrID string) (*report.Report, error) {
+	options := *s.Options
+	options.DryRun = true
+	options.InstanceFilter = azure.MatchInstance(nameOrID)
+
+	explainer := &Scheduler{
+		Credential: s.Credential,
+		Tags:       s.Tags,
+		Scope:      s.Scope,
+		Discovery:  s.Discovery,
+		Options:    &options,
+	}
+
+	return explainer.Run(ctx)
+}
+
+// Extend keeps the instance matching a name or resource ID running until `until` with its override
+// tag, returning the instance and when its override now ends
+func (s *Scheduler) Extend(ctx context.Context, nameOrID string, until time.Time) (azure.Instance, time.Time, error) {
+	var matches []azure.Instance
+
+	instances, _, err := s.Inventory(ctx)
+	if err != nil {
+		return azure.Instance{}, time.Time{}, err
+	}
+
+	match := azure.MatchInstance(nameOrID)
+
+	for _, instance := range instances {
+		if match(instance) && s.Tags.LoadValues(instance.Tags).Enabled {
+			matches = append(matches, instance)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return azure.Instance{}, time.Time{}, ErrInstanceNotFound
+	case 1:
+	default:
+		return azure.Instance{}, time.Time{}, ErrAmbiguousInstance
+	}
+
+	instance := matches[0]
+
+	client, err := azure.NewComputeClient(ctx, instance.SubscriptionID, s.Credential, s.Tags, s.Options)
+	if err != nil {
+		return azure.Instance{}, time.Time{}, err
+	}
+
+	until, err = client.Extend(instance, until)
+	if err != nil {
+		return azure.Instance{}, time.Time{}, fmt.Errorf("unable to extend instance: %w", err)
+	}
+
+	return instance, until, nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package scheduler
+
+import (
+	"context"
+	"strings"
+
+	"instancescheduler/internal/azure"
+	"instancescheduler/internal/report"
+)
+
+// MigrationResult is the outcome of migrating a single instance's tags
+type MigrationResult struct {
+	SubscriptionID string             `json:"subscriptionId"`
+	ResourceGroup  string             `json:"resourceGroup"`
+	Instance       string             `json:"instance"`
+	Migration      azure.TagMigration `json:"migration"`
+	Applied        bool               `json:"applied"`
+	Error          string             `json:"error,omitempty"`
+}
+
+// MigrateTags rewrites the legacy scheduler tags of every instance within the scope to their current
+// names and formats. Only instances with something to change are returned, and with `DryRun` the
+// changes are returned without being made.
+func (s *Scheduler) MigrateTags(ctx context.Context) ([]MigrationResult, []report.SubscriptionFailure, error) {
+	var results []MigrationResult
+
+	instances, failures, err := s.Inventory(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clients := make(map[string]*azure.ComputeClient)
+
+	for _, instance := range instances {
+		migration := s.Tags.Migrate(instance.Tags)
+		if migration.Empty() {
+			continue
+		}
+
+		result := MigrationResult{
+			SubscriptionID: instance.SubscriptionID,
+			ResourceGroup:  instance.ResourceGroup,
+			Instance:       instance.Name,
+			Migration:      migration,
+		}
+
+		if !s.Options.DryRun {
+			client, ok := clients[strings.ToLower(instance.SubscriptionID)]
+			if !ok {
+				client, err = azure.NewComputeClient(ctx, instance.SubscriptionID, s.Credential, s.Tags, s.Options)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				clients[strings.ToLower(instance.SubscriptionID)] = client
+			}
+
+			if err := client.MigrateTags(instance, migration); err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Applied = true
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results, failures, nil
+}
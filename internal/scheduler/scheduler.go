@@ -0,0 +1,238 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"instancescheduler/internal/audit"
+	"instancescheduler/internal/azure"
+	"instancescheduler/internal/report"
+	"instancescheduler/internal/telemetry"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DiscoveryResourceGraph = "resourcegraph"
+	DiscoveryCompute       = "compute"
+)
+
+// Scheduler runs the assessment of every instance within a scope. A single scheduler is used for
+// every run made by the process, so that the credential, tags and state are shared between them.
+type Scheduler struct {
+	Credential azcore.TokenCredential
+	Tags       *azure.Tags
+	Scope      azure.Scope
+	Discovery  string
+	Options    *azure.Options
+
+	// last is the report of the latest reconcile made by Serve, and when it finished
+	last   *report.Report
+	lastAt time.Time
+	mu     sync.Mutex
+}
+
+// Run resolves the subscriptions in scope, then checks on earlier operations and assesses every
+// instance within them. A failure within a single subscription is recorded in the report and does
+// not stop the others, an error is only returned when no subscription could be processed at all,
+// alongside the report of their failures.
+func (s *Scheduler) Run(ctx context.Context) (*report.Report, error) {
+	var discovered map[string][]azure.Instance
+	var wg sync.WaitGroup
+
+	ctx, span := telemetry.Start(ctx, "run")
+	defer span.End()
+
+	ctx = s.withAuditRun(ctx, span)
+
+	subscriptionIDs, err := s.Scope.Resolve(ctx, s.Credential)
+	if err != nil {
+		telemetry.RecordError(span, err)
+		return nil, fmt.Errorf("unable to resolve subscriptions: %w", err)
+	}
+
+	span.SetAttributes(attribute.Int("instancescheduler.subscriptions", len(subscriptionIDs)))
+
+	if s.Discovery == DiscoveryResourceGraph {
+		discoverCtx, discoverSpan := telemetry.Start(ctx, "list instances")
+		discovered, err = azure.DiscoverInstances(discoverCtx, s.Credential, subscriptionIDs, s.Tags.ResourceGraphQuery(),
+			s.Options)
+		telemetry.End(discoverSpan, err)
+
+		if err != nil {
+			log.Warn().Err(err).Msg("Resource Graph discovery failed, falling back to listing instances per subscription")
+			discovered = nil
+		}
+	}
+
+	runReport := report.New()
+
+	for _, subscriptionID := range subscriptionIDs {
+		var instances []azure.Instance
+		if discovered != nil {
+			instances = discovered[strings.ToLower(subscriptionID)]
+		}
+
+		wg.Add(1)
+		go func(subscriptionID string, instances []azure.Instance) {
+			defer wg.Done()
+
+			err := s.processSubscription(ctx, subscriptionID, instances, discovered != nil, runReport)
+			if err != nil {
+				runReport.AddFailure(subscriptionID, err)
+			}
+		}(subscriptionID, instances)
+	}
+
+	wg.Wait()
+
+	if err := failedRun(subscriptionIDs, runReport); err != nil {
+		telemetry.RecordError(span, err)
+		return runReport, err
+	}
+
+	return runReport, nil
+}
+
+// failedRun returns an error when every subscription in scope failed to be processed, naming each
+// subscription's failure
+func failedRun(subscriptionIDs []string, runReport *report.Report) error {
+	if len(subscriptionIDs) == 0 || len(runReport.Failures) < len(subscriptionIDs) {
+		return nil
+	}
+
+	errs := make([]error, 0, len(runReport.Failures))
+
+	for _, failure := range runReport.Failures {
+		errs = append(errs, fmt.Errorf("subscription %s: %w", failure.SubscriptionID, failure.Err))
+	}
+
+	return fmt.Errorf("no subscription could be processed: %w", errors.Join(errs...))
+}
+
+// withAuditRun returns a context carrying the run recorded in the audit log, when there is one. The
+// run ID is the run's trace ID when tracing is enabled, so that the two can be correlated.
+func (s *Scheduler) withAuditRun(ctx context.Context, span trace.Span) context.Context {
+	if s.Options == nil || s.Options.Audit == nil || s.Options.DryRun {
+		return ctx
+	}
+
+	run := audit.Run{ID: audit.NewRunID()}
+	if span.SpanContext().HasTraceID() {
+		run.ID = span.SpanContext().TraceID().String()
+	}
+
+	identity, err := azure.Identity(ctx, s.Credential)
+	if err != nil {
+		log.Warn().Err(err).Msg("Unable to determine the identity used, it will be missing from audit records")
+	}
+
+	run.Identity = identity
+
+	log.Debug().Str("runId", run.ID).Str("identity", run.Identity).Msg("Starting audited run")
+
+	return audit.WithRun(ctx, run)
+}
+
+// processSubscription checks on operations issued by earlier runs, then assesses and actions every
+// instance within a single subscription, adding the results to the report. When the instances have
+// not already been discovered they are listed from the compute API.
+func (s *Scheduler) processSubscription(ctx context.Context, subscriptionID string, instances []azure.Instance,
+	isDiscovered bool, runReport *report.Report) error {
+	log.Info().Str("subscription", subscriptionID).Msg("Processing subscription")
+
+	client, err := azure.NewComputeClient(ctx, subscriptionID, s.Credential, s.Tags, s.Options)
+	if err != nil {
+		return err
+	}
+
+	runReport.AddOperations(client.TrackOperations()...)
+
+	if !isDiscovered {
+		instances, err = client.ListInstances()
+		if err != nil {
+			return err
+		}
+	}
+
+	runReport.Add(client.AssessInstancesAndAction(instances)...)
+
+	return nil
+}
+
+// Inventory returns every instance within the scope, whether or not it has scheduling enabled. The
+// subscriptions that could not be listed are returned alongside the instances.
+func (s *Scheduler) Inventory(ctx context.Context) ([]azure.Instance, []report.SubscriptionFailure, error) {
+	var instances []azure.Instance
+	var failures []report.SubscriptionFailure
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	subscriptionIDs, err := s.Scope.Resolve(ctx, s.Credential)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to resolve subscriptions: %w", err)
+	}
+
+	if s.Discovery == DiscoveryResourceGraph {
+		discovered, err := azure.DiscoverInstances(ctx, s.Credential, subscriptionIDs, azure.InventoryQuery(), s.Options)
+		if err == nil {
+			for _, subscriptionID := range subscriptionIDs {
+				instances = append(instances, discovered[strings.ToLower(subscriptionID)]...)
+			}
+
+			return instances, nil, nil
+		}
+
+		log.Warn().Err(err).Msg("Resource Graph discovery failed, falling back to listing instances per subscription")
+	}
+
+	for _, subscriptionID := range subscriptionIDs {
+		wg.Add(1)
+		go func(subscriptionID string) {
+			defer wg.Done()
+
+			listed, err := s.listInstances(ctx, subscriptionID)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				failures = append(failures, report.SubscriptionFailure{SubscriptionID: subscriptionID, Err: err})
+				return
+			}
+
+			instances = append(instances, listed...)
+		}(subscriptionID)
+	}
+
+	wg.Wait()
+
+	return instances, failures, nil
+}
+
+// listInstances returns every instance within a single subscription from the compute API
+func (s *Scheduler) listInstances(ctx context.Context, subscriptionID string) ([]azure.Instance, error) {
+	client, err := azure.NewComputeClient(ctx, subscriptionID, s.Credential, s.Tags, s.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.ListInstances()
+}
@@ -0,0 +1,80 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"instancescheduler/internal/azure"
+	"instancescheduler/internal/report"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// failingCredential fails every request before it is sent
+type failingCredential struct{}
+
+func (failingCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken,
+	error) {
+	return azcore.AccessToken{}, errors.New("no credential")
+}
+
+// TestFailedRun checks a run only fails when every subscription in scope failed
+func TestFailedRun(t *testing.T) {
+	testCases := []struct {
+		name     string
+		failures []string
+		wantErr  bool
+	}{
+		{name: "none_failed"},
+		{name: "some_failed", failures: []string{"sub-1"}},
+		{name: "all_failed", failures: []string{"sub-1", "sub-2"}, wantErr: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			runReport := report.New()
+			for _, subscriptionID := range test.failures {
+				runReport.AddFailure(subscriptionID, errors.New("failed"))
+			}
+
+			err := failedRun([]string{"sub-1", "sub-2"}, runReport)
+
+			if (err != nil) != test.wantErr {
+				t.Errorf("got: %v, want error: %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+// TestRunEverySubscriptionFails checks a run returns an error, along with the report of the
+// failures, when no subscription could be processed
+func TestRunEverySubscriptionFails(t *testing.T) {
+	s := &Scheduler{
+		Credential: failingCredential{},
+		Tags:       &azure.Tags{InstanceSchedulingEnabled: "AutoShutdownEnabled"},
+		Scope:      azure.Scope{SubscriptionIDs: []string{"sub-1", "sub-2"}},
+		Discovery:  DiscoveryCompute,
+		Options:    &azure.Options{},
+	}
+
+	runReport, err := s.Run(context.Background())
+	if err == nil {
+		t.Fatal("got: no error, want: an error")
+	}
+
+	if runReport == nil || len(runReport.Failures) != 2 {
+		t.Errorf("got: %+v, want: a report with 2 failures", runReport)
+	}
+}
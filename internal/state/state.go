@@ -0,0 +1,272 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operation is a long-running power action that has been issued but not yet confirmed as finished
+type Operation struct {
+	InstanceID     string    `json:"instanceId"`
+	SubscriptionID string    `json:"subscriptionId"`
+	ResourceGroup  string    `json:"resourceGroup"`
+	Instance       string    `json:"instance"`
+	Method         string    `json:"method"`
+	ResumeToken    string    `json:"resumeToken"`
+	StartedAt      time.Time `json:"startedAt"`
+	// Tags and Reason describe the instance and why it was actioned, for the events published once
+	// the operation finishes
+	Tags   map[string]string `json:"tags,omitempty"`
+	Reason string            `json:"reason,omitempty"`
+}
+
+// Failure is an instance that could not be assessed or actioned, it is retried on the next run
+type Failure struct {
+	InstanceID  string    `json:"instanceId"`
+	Error       string    `json:"error"`
+	Attempts    int       `json:"attempts"`
+	LastAttempt time.Time `json:"lastAttempt"`
+}
+
+// History is what the scheduler last did to an instance, and the power state it last saw it in
+type History struct {
+	InstanceID string `json:"instanceId"`
+	// Running is whether the instance was last seen running, or expected to be after the last action
+	Running bool `json:"running"`
+	// RunningSince is when the instance entered its current power state, as far as it is known
+	RunningSince time.Time `json:"runningSince"`
+	LastAction   string    `json:"lastAction,omitempty"`
+	LastActionAt time.Time `json:"lastActionAt,omitempty"`
+	// ManualChangeAt is when the instance's power state was last changed by something other than the
+	// scheduler
+	ManualChangeAt time.Time `json:"manualChangeAt,omitempty"`
+	// ManualChangeBy is who made the last manual change, when it is known
+	ManualChangeBy string `json:"manualChangeBy,omitempty"`
+	// RespectUntil is when the scheduler stops leaving a manually changed instance alone
+	RespectUntil time.Time `json:"respectUntil,omitempty"`
+	// WarnedFor is the stop the instance's owner was last warned of, so that each stop is only
+	// warned of once
+	WarnedFor time.Time `json:"warnedFor,omitempty"`
+	// HeldBack is the skipped or failed event last published for the instance, as its type, action
+	// and reason code, so that a decision held back on every run is only published once
+	HeldBack string `json:"heldBack,omitempty"`
+}
+
+// Store is the scheduler's local state, persisted as JSON between runs. It is safe for concurrent
+// use.
+type Store struct {
+	Operations map[string]Operation `json:"operations"`
+	Failures   map[string]Failure   `json:"failures"`
+	Histories  map[string]History   `json:"history"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// Load reads the state file at `path`, returning an empty store when the file does not exist yet
+func Load(path string) (*Store, error) {
+	store := &Store{
+		Operations: make(map[string]Operation),
+		Failures:   make(map[string]Failure),
+		Histories:  make(map[string]History),
+		path:       path,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, store)
+	if err != nil {
+		return nil, err
+	}
+
+	if store.Operations == nil {
+		store.Operations = make(map[string]Operation)
+	}
+
+	if store.Failures == nil {
+		store.Failures = make(map[string]Failure)
+	}
+
+	if store.Histories == nil {
+		store.Histories = make(map[string]History)
+	}
+
+	return store, nil
+}
+
+// Operation returns the in-flight operation for an instance, if there is one
+func (s *Store) Operation(instanceID string) (Operation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	operation, ok := s.Operations[key(instanceID)]
+
+	return operation, ok
+}
+
+// PendingOperations returns every in-flight operation within a subscription
+func (s *Store) PendingOperations(subscriptionID string) []Operation {
+	var operations []Operation
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, operation := range s.Operations {
+		if strings.EqualFold(operation.SubscriptionID, subscriptionID) {
+			operations = append(operations, operation)
+		}
+	}
+
+	return operations
+}
+
+// TrackOperation records an in-flight operation and saves the store
+func (s *Store) TrackOperation(operation Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Operations[key(operation.InstanceID)] = operation
+
+	return s.save()
+}
+
+// CompleteOperation removes an operation once it has finished, successfully or not, and saves the
+// store
+func (s *Store) CompleteOperation(instanceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.Operations, key(instanceID))
+
+	return s.save()
+}
+
+// Failure returns the last failure recorded for an instance, if there is one
+func (s *Store) Failure(instanceID string) (Failure, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failure, ok := s.Failures[key(instanceID)]
+
+	return failure, ok
+}
+
+// RecordFailure records that an instance failed, incrementing its number of attempts, and saves the
+// store
+func (s *Store) RecordFailure(instanceID string, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failure := s.Failures[key(instanceID)]
+	failure.InstanceID = instanceID
+	failure.Error = err.Error()
+	failure.Attempts++
+	failure.LastAttempt = time.Now().UTC()
+
+	s.Failures[key(instanceID)] = failure
+
+	return s.save()
+}
+
+// ClearFailure removes an instance's failure, saving the store only when there was one to remove
+func (s *Store) ClearFailure(instanceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Failures[key(instanceID)]; !ok {
+		return nil
+	}
+
+	delete(s.Failures, key(instanceID))
+
+	return s.save()
+}
+
+// History returns what is known about an instance's past power states, if anything
+func (s *Store) History(instanceID string) (History, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history, ok := s.Histories[key(instanceID)]
+
+	return history, ok
+}
+
+// UpdateHistory applies `update` to an instance's history, saving the store only when the history
+// changed so that instances left as they were do not cause a write
+func (s *Store) UpdateHistory(instanceID string, update func(*History)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := s.Histories[key(instanceID)]
+	previous := history
+
+	history.InstanceID = instanceID
+	update(&history)
+
+	if history == previous {
+		return nil
+	}
+
+	s.Histories[key(instanceID)] = history
+
+	return s.save()
+}
+
+// Save writes the store to disk
+func (s *Store) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.save()
+}
+
+// save writes the store to a temporary file before renaming it over the state file, so that a
+// process dying mid-write does not leave a truncated file behind. The caller must hold the lock.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func key(instanceID string) string {
+	return strings.ToLower(instanceID)
+}
@@ -0,0 +1,63 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package state
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestOperationsPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	store, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.TrackOperation(Operation{
+		InstanceID:     "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm",
+		SubscriptionID: "SUB",
+		Method:         "start",
+		ResumeToken:    "token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	operation, ok := reloaded.Operation("/subscriptions/SUB/resourceGroups/RG/providers/Microsoft.Compute/virtualMachines/VM")
+	if !ok || operation.ResumeToken != "token" {
+		t.Errorf("got: %+v, want the tracked operation", operation)
+	}
+
+	if got := len(reloaded.PendingOperations("sub")); got != 1 {
+		t.Errorf("got: %d pending operations, want: 1", got)
+	}
+
+	err = reloaded.CompleteOperation(operation.InstanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := reloaded.Operation(operation.InstanceID); ok {
+		t.Error("expected the operation to be removed")
+	}
+}
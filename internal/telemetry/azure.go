@@ -0,0 +1,107 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AzureProvider returns a tracing provider for the Azure SDK that records its spans, such as each
+// HTTP request, with the global OpenTelemetry tracer provider so that they are children of the
+// scheduler's spans
+func AzureProvider() tracing.Provider {
+	return tracing.NewProvider(func(name, version string) tracing.Tracer {
+		tracer := otel.Tracer(name, trace.WithInstrumentationVersion(version))
+
+		return tracing.NewTracer(func(ctx context.Context, spanName string,
+			options *tracing.SpanOptions) (context.Context, tracing.Span) {
+			var opts []trace.SpanStartOption
+
+			if options != nil {
+				opts = append(opts, trace.WithSpanKind(trace.SpanKind(options.Kind)),
+					trace.WithAttributes(attributes(options.Attributes)...))
+			}
+
+			ctx, span := tracer.Start(ctx, spanName, opts...)
+
+			return ctx, azureSpan(span)
+		}, nil)
+	}, nil)
+}
+
+// azureSpan adapts an OpenTelemetry span to the Azure SDK's span
+func azureSpan(span trace.Span) tracing.Span {
+	return tracing.NewSpan(tracing.SpanImpl{
+		End: func() { span.End() },
+		SetAttributes: func(attrs ...tracing.Attribute) {
+			span.SetAttributes(attributes(attrs)...)
+		},
+		AddEvent: func(name string, attrs ...tracing.Attribute) {
+			span.AddEvent(name, trace.WithAttributes(attributes(attrs)...))
+		},
+		SetStatus: func(status tracing.SpanStatus, description string) {
+			switch status {
+			case tracing.SpanStatusError:
+				span.SetStatus(codes.Error, description)
+			case tracing.SpanStatusOK:
+				span.SetStatus(codes.Ok, description)
+			}
+		},
+	})
+}
+
+func attributes(attrs []tracing.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+
+	for _, attr := range attrs {
+		switch value := attr.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(attr.Key, value))
+		case int:
+			kvs = append(kvs, attribute.Int(attr.Key, value))
+		case int64:
+			kvs = append(kvs, attribute.Int64(attr.Key, value))
+		case float64:
+			kvs = append(kvs, attribute.Float64(attr.Key, value))
+		case bool:
+			kvs = append(kvs, attribute.Bool(attr.Key, value))
+		default:
+			kvs = append(kvs, attribute.String(attr.Key, fmt.Sprintf("%v", value)))
+		}
+	}
+
+	return kvs
+}
+
+// PropagationPolicy returns a pipeline policy adding the trace context of the request's span to its
+// headers, as `traceparent`, so that requests can be correlated with Azure's own logs
+func PropagationPolicy() policy.Policy {
+	return propagationPolicy{}
+}
+
+type propagationPolicy struct{}
+
+// Do injects the trace context into the request's headers before sending it
+func (propagationPolicy) Do(req *policy.Request) (*http.Response, error) {
+	otel.GetTextMapPropagator().Inject(req.Raw().Context(), propagation.HeaderCarrier(req.Raw().Header))
+
+	return req.Next()
+}
@@ -0,0 +1,87 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestAzurePipeline checks requests made through an Azure pipeline are recorded as children of the
+// scheduler's span and carry its trace context
+func TestAzurePipeline(t *testing.T) {
+	var traceparent string
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	client, err := azcore.NewClient("test", "v1.0.0", runtime.PipelineOptions{
+		Tracing: runtime.TracingOptions{Namespace: "Microsoft.Compute"},
+	}, &policy.ClientOptions{
+		TracingProvider:  AzureProvider(),
+		PerRetryPolicies: []policy.Policy{PropagationPolicy()},
+	})
+	if err != nil {
+		t.Fatalf("unable to create client: %v", err)
+	}
+
+	ctx, span := Start(context.Background(), "evaluate")
+
+	// generated clients start a span for each method, which also hands the tracer to the pipeline
+	ctx, endSpan := runtime.StartSpan(ctx, "Client.Get", client.Tracer(), nil)
+
+	req, err := runtime.NewRequest(ctx, http.MethodGet, server.URL)
+	if err != nil {
+		t.Fatalf("unable to create request: %v", err)
+	}
+
+	_, err = client.Pipeline().Do(req)
+	endSpan(err)
+	span.End()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	traceID := span.SpanContext().TraceID().String()
+
+	if !strings.Contains(traceparent, traceID) {
+		t.Errorf("got: %v, want: a traceparent for trace %v", traceparent, traceID)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got: %v spans, want: %v", len(spans), 3)
+	}
+
+	for _, got := range spans {
+		if got.SpanContext().TraceID() != span.SpanContext().TraceID() {
+			t.Errorf("got: %v, want: %v", got.SpanContext().TraceID(), span.SpanContext().TraceID())
+		}
+	}
+}
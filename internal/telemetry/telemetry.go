@@ -0,0 +1,113 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExporterNone disables tracing
+	ExporterNone = "none"
+	// ExporterOTLP exports spans over OTLP/HTTP, configured by the standard `OTEL_EXPORTER_OTLP_*`
+	// environment variables
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans to stderr as JSON, for local debugging
+	ExporterStdout = "stdout"
+)
+
+// tracerName is the instrumentation scope of the scheduler's own spans
+const tracerName = "instancescheduler"
+
+// Attribute keys used on the scheduler's spans
+const (
+	AttributeSubscription  = attribute.Key("azure.subscription_id")
+	AttributeResourceGroup = attribute.Key("azure.resource_group")
+	AttributeInstance      = attribute.Key("azure.vm.name")
+	AttributeInstanceID    = attribute.Key("azure.vm.id")
+	AttributeAction        = attribute.Key("instancescheduler.action")
+	AttributeRule          = attribute.Key("instancescheduler.rule")
+	AttributeReason        = attribute.Key("instancescheduler.reason")
+	AttributeMethod        = attribute.Key("instancescheduler.method")
+)
+
+// Setup installs the global tracer provider and W3C trace context propagator for the exporter,
+// returning a function that flushes and stops it. With `ExporterNone` nothing is installed and
+// spans are not recorded.
+func Setup(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	var spanExporter sdktrace.SpanExporter
+	var err error
+
+	switch strings.ToLower(exporter) {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		spanExporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr), stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown trace exporter '%s', expected one of none, otlp or stdout", exporter)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to create %s trace exporter: %w", exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(tracerName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(spanExporter), sdktrace.WithResource(res))
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider.Shutdown, nil
+}
+
+// Enabled determines if an exporter records spans
+func Enabled(exporter string) bool {
+	return exporter != "" && !strings.EqualFold(exporter, ExporterNone)
+}
+
+// Start starts a span of the scheduler's own work, a child of any span in `ctx`
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// RecordError records `err` on the span and marks it as failed, it does nothing when `err` is nil
+func RecordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// End records `err` on the span, when there is one, and ends it
+func End(span trace.Span, err error) {
+	RecordError(span, err)
+	span.End()
+}
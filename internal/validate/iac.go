@@ -0,0 +1,356 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"instancescheduler/internal/azure"
+)
+
+// Format is the kind of infrastructure as code document being validated
+type Format string
+
+const (
+	FormatAuto      Format = "auto"
+	FormatTerraform Format = "terraform"
+	FormatARM       Format = "arm"
+	FormatResources Format = "resources"
+)
+
+// ParseFormat converts a format name into a `Format`
+func ParseFormat(data string) (Format, error) {
+	switch format := Format(strings.ToLower(data)); format {
+	case FormatAuto, FormatTerraform, FormatARM, FormatResources:
+		return format, nil
+	}
+
+	return "", fmt.Errorf("invalid format '%s', expected one of auto, terraform, arm or resources", data)
+}
+
+// virtualMachineTypes are the resource types, in Terraform and ARM, that the scheduler manages
+var virtualMachineTypes = map[string]bool{
+	"azurerm_linux_virtual_machine":     true,
+	"azurerm_windows_virtual_machine":   true,
+	"azurerm_virtual_machine":           true,
+	"microsoft.compute/virtualmachines": true,
+}
+
+// Resource is a virtual machine found in an infrastructure as code document
+type Resource struct {
+	// File is the document the resource was read from
+	File string `json:"file"`
+	// Address is the Terraform address or ARM name of the resource
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	// Path is the location of the resource within the document, such as `resources[2]`
+	Path string             `json:"path"`
+	Tags map[string]*string `json:"-"`
+	// Unresolved are the tags whose values are expressions that cannot be checked offline
+	Unresolved []string `json:"unresolved,omitempty"`
+}
+
+// ResourceResult is the outcome of validating a single resource's tags
+type ResourceResult struct {
+	Resource
+	Problems []Problem `json:"problems"`
+}
+
+// Valid determines if the resource's tags had no problems
+func (r ResourceResult) Valid() bool {
+	return len(r.Problems) == 0
+}
+
+// ParseResources reads the virtual machines from a `terraform show -json` plan, an ARM template
+// (including those compiled from Bicep) or a JSON list of resources, such as `az vm list`. With
+// `FormatAuto` the format is detected from the document.
+func ParseResources(file string, data []byte, format Format) ([]Resource, error) {
+	var document any
+
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("%s is not valid JSON: %w", file, err)
+	}
+
+	if format == FormatAuto || format == "" {
+		format = detectFormat(document)
+	}
+
+	var resources []Resource
+
+	switch format {
+	case FormatTerraform:
+		object, _ := document.(map[string]any)
+		if object == nil {
+			return nil, fmt.Errorf("%s is not a Terraform plan", file)
+		}
+
+		plannedValues, _ := object["planned_values"].(map[string]any)
+		rootModule, _ := plannedValues["root_module"].(map[string]any)
+		resources = terraformResources(file, rootModule, "planned_values.root_module")
+	case FormatARM:
+		object, _ := document.(map[string]any)
+		if object == nil {
+			return nil, fmt.Errorf("%s is not an ARM template", file)
+		}
+
+		resources = armResources(file, object["resources"], "resources")
+	case FormatResources:
+		list, ok := document.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a JSON list of resources", file)
+		}
+
+		resources = armResources(file, list, "")
+	default:
+		return nil, errors.New("unable to detect the format of " + file)
+	}
+
+	return resources, nil
+}
+
+// detectFormat guesses the format of a document from its shape
+func detectFormat(document any) Format {
+	switch document := document.(type) {
+	case []any:
+		return FormatResources
+	case map[string]any:
+		if _, ok := document["planned_values"]; ok {
+			return FormatTerraform
+		}
+
+		if _, ok := document["format_version"]; ok {
+			return FormatTerraform
+		}
+
+		if schema, _ := document["$schema"].(string); strings.Contains(strings.ToLower(schema), "deploymenttemplate") {
+			return FormatARM
+		}
+
+		if _, ok := document["resources"]; ok {
+			return FormatARM
+		}
+	}
+
+	return ""
+}
+
+// terraformResources returns the virtual machines in a plan's module, including its child modules
+func terraformResources(file string, module map[string]any, path string) []Resource {
+	var resources []Resource
+
+	if module == nil {
+		return nil
+	}
+
+	items, _ := module["resources"].([]any)
+	for i, item := range items {
+		object, _ := item.(map[string]any)
+		resourceType, _ := object["type"].(string)
+
+		if !virtualMachineTypes[strings.ToLower(resourceType)] {
+			continue
+		}
+
+		address, _ := object["address"].(string)
+		values, _ := object["values"].(map[string]any)
+		tags, unresolved := stringTags(values["tags"])
+
+		resources = append(resources, Resource{
+			File:       file,
+			Address:    address,
+			Type:       resourceType,
+			Path:       fmt.Sprintf("%s.resources[%d]", path, i),
+			Tags:       tags,
+			Unresolved: unresolved,
+		})
+	}
+
+	children, _ := module["child_modules"].([]any)
+	for i, child := range children {
+		object, _ := child.(map[string]any)
+		resources = append(resources, terraformResources(file, object, fmt.Sprintf("%s.child_modules[%d]", path, i))...)
+	}
+
+	return resources
+}
+
+// deploymentType is the type of a nested deployment, whose template's resources are deployed with it
+const deploymentType = "Microsoft.Resources/deployments"
+
+// armResources returns the virtual machines in a list of ARM resources, including nested resources
+// and the resources of nested deployment templates. Templates using symbolic names hold their
+// resources in an object rather than a list.
+func armResources(file string, items any, path string) []Resource {
+	var resources []Resource
+
+	visit := func(item any, itemPath string) {
+		object, _ := item.(map[string]any)
+		if object == nil {
+			return
+		}
+
+		resourceType, _ := object["type"].(string)
+		if virtualMachineTypes[strings.ToLower(resourceType)] {
+			address, _ := object["id"].(string)
+			if address == "" {
+				address, _ = object["name"].(string)
+			}
+
+			tags, unresolved := stringTags(object["tags"])
+
+			resources = append(resources, Resource{
+				File:       file,
+				Address:    address,
+				Type:       resourceType,
+				Path:       itemPath,
+				Tags:       tags,
+				Unresolved: unresolved,
+			})
+		}
+
+		if nested, ok := object["resources"]; ok {
+			resources = append(resources, armResources(file, nested, itemPath+".resources")...)
+		}
+
+		// Bicep compiles every module into a nested deployment holding the module's template
+		if strings.EqualFold(resourceType, deploymentType) {
+			properties, _ := object["properties"].(map[string]any)
+			template, _ := properties["template"].(map[string]any)
+
+			if nested, ok := template["resources"]; ok {
+				resources = append(resources, armResources(file, nested, itemPath+".properties.template.resources")...)
+			}
+		}
+	}
+
+	switch items := items.(type) {
+	case []any:
+		for i, item := range items {
+			visit(item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	case map[string]any:
+		names := make([]string, 0, len(items))
+		for name := range items {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			visit(items[name], fmt.Sprintf("%s.%s", path, name))
+		}
+	}
+
+	return resources
+}
+
+// stringTags converts a tags object into tag values. ARM expressions, such as
+// `[parameters('schedule')]`, cannot be resolved offline and are returned separately, while values
+// escaped with `[[` keep their literal `[`.
+func stringTags(data any) (map[string]*string, []string) {
+	var unresolved []string
+
+	object, _ := data.(map[string]any)
+	if object == nil {
+		return nil, nil
+	}
+
+	tags := make(map[string]*string, len(object))
+
+	for key, value := range object {
+		var tag string
+
+		switch value := value.(type) {
+		case string:
+			if strings.HasPrefix(value, "[[") {
+				value = value[1:]
+			} else if strings.HasPrefix(value, "[") {
+				unresolved = append(unresolved, key)
+				continue
+			}
+
+			tag = value
+		case nil:
+			continue
+		default:
+			tag = fmt.Sprint(value)
+		}
+
+		tags[key] = &tag
+	}
+
+	sort.Strings(unresolved)
+
+	return tags, unresolved
+}
+
+// Resources validates the scheduler tags of every resource. Resources without any of the
+// scheduler's tags are left out, as are problems with tags that could not be resolved.
+func Resources(tags *azure.Tags, resources []Resource) []ResourceResult {
+	var results []ResourceResult
+
+	for _, resource := range resources {
+		values := tags.LoadValues(resource.Tags)
+		unresolved := unresolvedTags(tags, resource)
+
+		if !values.Enabled && values.Schedule == "" && values.PatchWindow == "" && values.StopMode == "" &&
+			len(unresolved) == 0 {
+			continue
+		}
+
+		result := ResourceResult{Resource: resource, Problems: []Problem{}}
+
+		for _, problem := range Values(tags, values) {
+			if !slices.Contains(unresolved, problem.Tag) {
+				result.Problems = append(result.Problems, problem)
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// unresolvedTags returns the current names of the scheduler's tags whose values could not be
+// resolved. The resource's tag keys are matched as the scheduler matches them, case-insensitively
+// and through aliases, so that an expression under an alias hides the problems of its tag unless a
+// resolved value takes precedence over it.
+func unresolvedTags(tags *azure.Tags, resource Resource) []string {
+	var names []string
+
+	if len(resource.Unresolved) == 0 {
+		return nil
+	}
+
+	all := make(map[string]*string, len(resource.Tags)+len(resource.Unresolved))
+	for key, value := range resource.Tags {
+		all[key] = value
+	}
+
+	unresolved := make(map[string]bool, len(resource.Unresolved))
+	for _, key := range resource.Unresolved {
+		all[key], unresolved[key] = new(string), true
+	}
+
+	for _, tag := range azure.LogicalTags {
+		if key, _, ok := tags.Lookup(all, tag); ok && unresolved[key] {
+			names = append(names, tags.Name(tag))
+		}
+	}
+
+	return names
+}
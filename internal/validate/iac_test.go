@@ -0,0 +1,254 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package validate
+
+import (
+	"testing"
+
+	"instancescheduler/internal/azure"
+)
+
+const terraformPlan = `{
+  "format_version": "1.2",
+  "planned_values": {
+    "root_module": {
+      "resources": [
+        {"address": "azurerm_resource_group.main", "type": "azurerm_resource_group", "values": {"tags": {"AutoShutdownEnabled": "true"}}},
+        {"address": "azurerm_linux_virtual_machine.good", "type": "azurerm_linux_virtual_machine", "values": {"tags": {"AutoShutdownEnabled": "true", "AutoShutdownSchedule": "{\"default\": \"09:00-17:00\"}"}}}
+      ],
+      "child_modules": [
+        {
+          "address": "module.app",
+          "resources": [
+            {"address": "module.app.azurerm_windows_virtual_machine.bad", "type": "azurerm_windows_virtual_machine", "values": {"tags": {"AutoShutdownEnabled": "true", "AutoShutdownSchedule": "{\"default\": \"17:00-09:00\"}"}}}
+          ]
+        }
+      ]
+    }
+  }
+}`
+
+const armTemplate = `{
+  "$schema": "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#",
+  "resources": [
+    {"type": "Microsoft.Compute/virtualMachines", "name": "unresolved", "tags": {"AutoShutdownEnabled": "true", "AutoShutdownSchedule": "[parameters('schedule')]"}},
+    {"type": "Microsoft.Compute/virtualMachines", "name": "untagged", "tags": {"Owner": "ops"}},
+    {"type": "Microsoft.Compute/virtualMachines", "name": "bad-stop-mode", "tags": {"AutoShutdownEnabled": "true", "AutoShutdownSchedule": "{\"default\": \"09:00-17:00\"}", "AutoShutdownStopMode": "suspend"}}
+  ]
+}`
+
+// bicepModule is a template compiled by Bicep from a file deploying a virtual machine through a
+// module, which in turn deploys a second one through its own module
+const bicepModule = `{
+  "$schema": "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#",
+  "contentVersion": "1.0.0.0",
+  "metadata": {"_generator": {"name": "bicep", "version": "0.30.23.60470", "templateHash": "1234567890"}},
+  "resources": [
+    {
+      "type": "Microsoft.Resources/deployments",
+      "apiVersion": "2022-09-01",
+      "name": "app",
+      "properties": {
+        "expressionEvaluationOptions": {"scope": "inner"},
+        "mode": "Incremental",
+        "parameters": {"schedule": {"value": "{\"default\": \"17:00-09:00\"}"}},
+        "template": {
+          "$schema": "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#",
+          "contentVersion": "1.0.0.0",
+          "parameters": {"schedule": {"type": "string"}},
+          "resources": [
+            {"type": "Microsoft.Compute/virtualMachines", "apiVersion": "2023-03-01", "name": "app-vm", "location": "[resourceGroup().location]", "tags": {"AutoShutdownEnabled": "true", "AutoShutdownSchedule": "{\"default\": \"17:00-09:00\"}"}},
+            {
+              "type": "Microsoft.Resources/deployments",
+              "apiVersion": "2022-09-01",
+              "name": "worker",
+              "properties": {
+                "expressionEvaluationOptions": {"scope": "inner"},
+                "mode": "Incremental",
+                "template": {
+                  "$schema": "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#",
+                  "contentVersion": "1.0.0.0",
+                  "resources": [
+                    {"type": "Microsoft.Compute/virtualMachines", "apiVersion": "2023-03-01", "name": "worker-vm", "location": "[resourceGroup().location]", "tags": {"AutoShutdownEnabled": "true", "AutoShutdownSchedule": "{\"default\": \"09:00-17:00\"}"}}
+                  ]
+                }
+              }
+            }
+          ]
+        }
+      }
+    }
+  ]
+}`
+
+const resourceList = `[
+  {"id": "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm", "type": "Microsoft.Compute/virtualMachines", "tags": {"AutoShutdownEnabled": "true", "AutoShutdownPatchWindow": "not json"}}
+]`
+
+// TestResources validates the tags of virtual machines in each supported format
+func TestResources(t *testing.T) {
+	tags := &azure.Tags{
+		InstanceSchedulingEnabled:     "AutoShutdownEnabled",
+		InstanceSchedulingSchedule:    "AutoShutdownSchedule",
+		InstanceSchedulingPatchWindow: "AutoShutdownPatchWindow",
+		InstanceSchedulingStopMode:    "AutoShutdownStopMode",
+	}
+
+	testCases := []struct {
+		name          string
+		data          string
+		format        Format
+		wantResources int
+		wantInvalid   map[string]string
+	}{
+		{
+			name:          "terraform plan",
+			data:          terraformPlan,
+			format:        FormatAuto,
+			wantResources: 2,
+			wantInvalid: map[string]string{
+				"module.app.azurerm_windows_virtual_machine.bad": "planned_values.root_module.child_modules[0].resources[0]",
+			},
+		},
+		{
+			name:          "arm template",
+			data:          armTemplate,
+			format:        FormatAuto,
+			wantResources: 3,
+			wantInvalid: map[string]string{
+				"bad-stop-mode": "resources[2]",
+			},
+		},
+		{
+			name:          "bicep module",
+			data:          bicepModule,
+			format:        FormatAuto,
+			wantResources: 2,
+			wantInvalid: map[string]string{
+				"app-vm": "resources[0].properties.template.resources[0]",
+			},
+		},
+		{
+			name:          "resource list",
+			data:          resourceList,
+			format:        FormatResources,
+			wantResources: 1,
+			wantInvalid: map[string]string{
+				"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm": "[0]",
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			resources, err := ParseResources("input.json", []byte(test.data), test.format)
+			if err != nil {
+				t.Fatalf("got: %v, want: nil", err)
+			}
+
+			if len(resources) != test.wantResources {
+				t.Errorf("got: %v resources, want: %v", len(resources), test.wantResources)
+			}
+
+			invalid := make(map[string]string)
+			for _, result := range Resources(tags, resources) {
+				if !result.Valid() {
+					invalid[result.Address] = result.Path
+				}
+			}
+
+			if len(invalid) != len(test.wantInvalid) {
+				t.Errorf("got: %v, want: %v", invalid, test.wantInvalid)
+			}
+
+			for address, path := range test.wantInvalid {
+				if invalid[address] != path {
+					t.Errorf("got: %v, want: %v", invalid[address], path)
+				}
+			}
+		})
+	}
+}
+
+// TestResourcesUnresolved checks an expression hides the problems of its tag when it is found under
+// an alias or in a different case, as the scheduler would read it
+func TestResourcesUnresolved(t *testing.T) {
+	tags := &azure.Tags{
+		InstanceSchedulingEnabled:  "AutoShutdownEnabled",
+		InstanceSchedulingSchedule: "AutoShutdownSchedule",
+		Aliases: map[string][]string{
+			azure.TagSchedule: {"Schedule"},
+		},
+	}
+
+	enabled := "true"
+	invalid := "not json"
+
+	testCases := []struct {
+		name         string
+		tags         map[string]*string
+		unresolved   []string
+		wantIncluded bool
+		wantValid    bool
+	}{
+		{
+			name:         "current name",
+			tags:         map[string]*string{"AutoShutdownEnabled": &enabled},
+			unresolved:   []string{"AutoShutdownSchedule"},
+			wantIncluded: true,
+			wantValid:    true,
+		},
+		{
+			name:         "different case",
+			tags:         map[string]*string{"AutoShutdownEnabled": &enabled},
+			unresolved:   []string{"autoshutdownschedule"},
+			wantIncluded: true,
+			wantValid:    true,
+		},
+		{
+			name:         "alias",
+			tags:         map[string]*string{"AutoShutdownEnabled": &enabled},
+			unresolved:   []string{"schedule"},
+			wantIncluded: true,
+			wantValid:    true,
+		},
+		{
+			name:         "resolved current name takes precedence",
+			tags:         map[string]*string{"AutoShutdownEnabled": &enabled, "AutoShutdownSchedule": &invalid},
+			unresolved:   []string{"Schedule"},
+			wantIncluded: true,
+		},
+		{
+			name:         "unrelated tag",
+			tags:         map[string]*string{"AutoShutdownEnabled": &enabled},
+			unresolved:   []string{"CostCenter"},
+			wantIncluded: true,
+		},
+		{
+			name:       "unrelated tag without scheduler tags",
+			unresolved: []string{"CostCenter"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			results := Resources(tags, []Resource{{Address: "vm", Tags: test.tags, Unresolved: test.unresolved}})
+
+			if (len(results) == 1) != test.wantIncluded {
+				t.Fatalf("got: %v, want included: %v", results, test.wantIncluded)
+			}
+
+			if test.wantIncluded && results[0].Valid() != test.wantValid {
+				t.Errorf("got: %v, want valid: %v", results[0].Problems, test.wantValid)
+			}
+		})
+	}
+}
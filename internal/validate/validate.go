@@ -0,0 +1,111 @@
+/*
+Copyright Brendan Thompson
+
+Licensed under the PolyForm Internal Use License, Version 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+A copy of the License may be obtained at
+
+https://polyformproject.org/licenses/internal-use/1.0.0/
+*/
+
+package validate
+
+import (
+	"instancescheduler/internal/azure"
+	"instancescheduler/internal/override"
+	"instancescheduler/internal/patchwindow"
+	"instancescheduler/internal/schedule"
+)
+
+// Problem is a single invalid tag value
+type Problem struct {
+	Tag     string `json:"tag"`
+	Value   string `json:"value"`
+	Message string `json:"message"`
+}
+
+// Values checks the scheduler's tag values without calling Azure, returning every problem found
+func Values(tags *azure.Tags, values azure.TagValues) []Problem {
+	var problems []Problem
+
+	if values.Schedule == "" {
+		problems = append(problems, Problem{
+			Tag:     tags.InstanceSchedulingSchedule,
+			Message: "schedule is not set",
+		})
+	} else if s, err := schedule.NewSchedule([]byte(values.Schedule)); err != nil {
+		problems = append(problems, Problem{
+			Tag:     tags.InstanceSchedulingSchedule,
+			Value:   values.Schedule,
+			Message: "schedule is not valid JSON: " + err.Error(),
+		})
+	} else {
+		if !s.Validate() {
+			problems = append(problems, Problem{
+				Tag:     tags.InstanceSchedulingSchedule,
+				Value:   values.Schedule,
+				Message: "default window is not a valid 'HH:MM-HH:MM' range ending after it starts",
+			})
+		}
+
+		if !s.ValidateOverrides() {
+			problems = append(problems, Problem{
+				Tag:     tags.InstanceSchedulingSchedule,
+				Value:   values.Schedule,
+				Message: "overrides must be keyed by weekday with valid 'HH:MM-HH:MM' ranges or '-'",
+			})
+		}
+	}
+
+	if values.PatchWindow != "" {
+		if _, err := patchwindow.New([]byte(values.PatchWindow)); err != nil {
+			problems = append(problems, Problem{
+				Tag:     tags.InstanceSchedulingPatchWindow,
+				Value:   values.PatchWindow,
+				Message: "patch window is not valid: " + err.Error(),
+			})
+		}
+	}
+
+	if values.StopMode != "" {
+		if _, err := azure.ParseStopMode(values.StopMode); err != nil {
+			problems = append(problems, Problem{
+				Tag:     tags.InstanceSchedulingStopMode,
+				Value:   values.StopMode,
+				Message: err.Error(),
+			})
+		}
+	}
+
+	if values.ManualChanges != "" {
+		if _, err := azure.ParseManualChanges(values.ManualChanges); err != nil {
+			problems = append(problems, Problem{
+				Tag:     tags.InstanceSchedulingManualChanges,
+				Value:   values.ManualChanges,
+				Message: err.Error(),
+			})
+		}
+	}
+
+	if values.OverrideUntil != "" {
+		if _, err := override.Parse(values.OverrideUntil); err != nil {
+			problems = append(problems, Problem{
+				Tag:     tags.InstanceSchedulingOverrideUntil,
+				Value:   values.OverrideUntil,
+				Message: err.Error(),
+			})
+		}
+	}
+
+	if values.SnoozeUntil != "" {
+		if _, err := override.ParseTime(values.SnoozeUntil); err != nil {
+			problems = append(problems, Problem{
+				Tag:     tags.InstanceSchedulingSnoozeUntil,
+				Value:   values.SnoozeUntil,
+				Message: err.Error(),
+			})
+		}
+	}
+
+	return problems
+}